@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"foocipe-recipe-service/internal/config"
 	"foocipe-recipe-service/internal/database"
+	"foocipe-recipe-service/internal/handlers"
+	"foocipe-recipe-service/internal/jobs"
 	"foocipe-recipe-service/internal/routes"
+	"io"
 	"log"
+	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
@@ -36,6 +46,14 @@ func main() {
 		log.Fatalf("Failed to create tables: %v", err)
 	}
 
+	// Run a maintenance subcommand instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -43,17 +61,85 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "access_token", "refresh_token"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "access_token", "refresh_token", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
 		AllowCredentials: true,
 	}))
 
 	// Setup routes
 	routes.SetupRoutes(r, db)
 
+	// Release stock held by checkouts that were never completed
+	go jobs.RunReservationSweeper(context.Background(), db, time.Minute)
+	// Publish and unpublish products at their scheduled times
+	go jobs.RunProductScheduler(context.Background(), db, time.Minute)
+
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
 	if err := r.Run(":" + cfg.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// runCommand runs a maintenance subcommand such as
+//
+//	export-catalog [-o catalog.ndjson]
+//	import-catalog [-dry-run] [-owner 12] catalog.ndjson
+func runCommand(db *pgxpool.Pool, name string, args []string) error {
+	ctx := context.Background()
+
+	switch name {
+	case "export-catalog":
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		output := flags.String("o", "", "file to write the catalog to (default stdout)")
+		flags.Parse(args)
+
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			file, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+
+		summary, err := handlers.ExportCatalog(ctx, db, w)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %d recipes, %d ingredients and %d tools", summary.Recipes, summary.Ingredients, summary.Tools)
+		return nil
+
+	case "import-catalog":
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "report what would be imported without writing anything")
+		owner := flags.Int("owner", 0, "user ID owning the imported recipes (default: the owner in the file)")
+		flags.Parse(args)
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: %s [-dry-run] [-owner ID] FILE", name)
+		}
+
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		report, err := handlers.ImportCatalog(ctx, db, file, handlers.CatalogImportOptions{DryRun: *dryRun, OwnerID: *owner})
+		if err != nil {
+			return err
+		}
+
+		if failed := handlers.ReindexRecipes(ctx, db, report.CreatedRecipeIDs); len(failed) > 0 {
+			log.Printf("Could not index recipes %v in Elasticsearch", failed)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+
+	default:
+		return fmt.Errorf("unknown command %q (expected export-catalog or import-catalog)", name)
+	}
+}
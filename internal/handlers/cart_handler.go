@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -35,9 +41,23 @@ func AddProductToCart(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		// Thêm sản phẩm vào giỏ hàng
-		_, err = db.Exec(c, `INSERT INTO carts (user_id, product_id, quantity) VALUES ($1, $2, $3)`, userID, productID, quantity)
-		if err != nil {
+		// Products with variants are added by ?variant_id
+		var variantID *int
+		if value := c.Query("variant_id"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+				return
+			}
+			variantID = &id
+		}
+
+		// Thêm sản phẩm vào giỏ hàng, gộp với dòng đã có cùng sản phẩm
+		if err := addCartItem(c, db, userID.(int), productID, variantID, quantity); err != nil {
+			if status, ok := cartErrorStatus(err); ok {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add product to cart"})
 			return
 		}
@@ -47,17 +67,219 @@ func AddProductToCart(db *pgxpool.Pool) gin.HandlerFunc {
 }
 
 type CartResponse struct {
-	ID           int      `json:"id"`
-	UserID       int      `json:"user_id"`
-	ProductID    int      `json:"product_id"`
-	Quantity     int      `json:"quantity"`
-	IngredientID *int     `json:"ingredient_id"`
-	ToolID       *int     `json:"tool_id"`
-	RecipeID     *int     `json:"recipe_id"`
-	Title        string   `json:"title"`
-	Price        float64  `json:"price"`
-	Stock        int      `json:"stock"`
-	ImageURLs    []string `json:"image_urls"`
+	ID           int    `json:"id"`
+	UserID       int    `json:"user_id"`
+	ProductID    int    `json:"product_id"`
+	SellerID     int    `json:"seller_id"`
+	Quantity     int    `json:"quantity"`
+	IngredientID *int   `json:"ingredient_id"`
+	ToolID       *int   `json:"tool_id"`
+	RecipeID     *int   `json:"recipe_id"`
+	Title        string `json:"title"`
+	// VariantID and Options identify the variant of a product with variants; Price and Stock are then the variant's
+	VariantID  *int              `json:"variant_id,omitempty"`
+	Options    map[string]string `json:"options,omitempty"`
+	Price      Money             `json:"price"`
+	PriceAtAdd Money             `json:"price_at_add"`
+	// SalePrice is the price under a running automatic promotion; LineTotal uses it when present
+	SalePrice       *Money `json:"sale_price,omitempty"`
+	SalePromotionID *int   `json:"sale_promotion_id,omitempty"`
+	LineTotal       Money  `json:"line_total"`
+	// Stock is the available stock, not counting what pending checkouts hold
+	Stock     int      `json:"stock"`
+	IsActive  bool     `json:"is_active"`
+	ImageURLs []string `json:"image_urls"`
+
+	category string
+}
+
+// displayTitle is the product title followed by the variant's option values, if any
+func (item CartResponse) displayTitle() string {
+	if item.VariantID == nil {
+		return item.Title
+	}
+	return item.Title + " (" + variantLabel(item.Options) + ")"
+}
+
+func (item CartResponse) promotionTarget() promotionTarget {
+	return promotionTarget{ProductID: item.ProductID, SellerID: item.SellerID, Category: item.category, Price: item.Price}
+}
+
+type CartSellerSubtotal struct {
+	SellerID  int   `json:"seller_id"`
+	ItemCount int   `json:"item_count"`
+	Subtotal  Money `json:"subtotal"`
+}
+
+// CartWarning flags something that changed since it was put in the cart: inactive, price_changed,
+// insufficient_stock, or coupon_invalid for an applied coupon that no longer applies
+type CartWarning struct {
+	CartID    int    `json:"cart_id,omitempty"`
+	ProductID int    `json:"product_id,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+type CartCoupon struct {
+	PromotionID int    `json:"promotion_id"`
+	Code        string `json:"code"`
+	Discount    Money  `json:"discount"`
+}
+
+type CartSummary struct {
+	Items []CartResponse `json:"items"`
+	// Sellers holds the subtotal of each seller's products per currency; inactive products are left out of every total
+	Sellers   []CartSellerSubtotal `json:"sellers"`
+	ItemCount int                  `json:"item_count"`
+	// Subtotals and Totals hold one amount per currency in the cart, before and after the coupon
+	Subtotals []Money       `json:"subtotals"`
+	Coupon    *CartCoupon   `json:"coupon,omitempty"`
+	Totals    []Money       `json:"totals"`
+	Warnings  []CartWarning `json:"warnings"`
+}
+
+// priceCart prices the user's cart at current prices with running sales and the applied coupon.
+// A line without a variant of a product that has since gained variants counts as inactive.
+// Checkout runs it again inside its transaction, so promotions are validated once more before an order is placed.
+func priceCart(ctx context.Context, q querier, userID int) (CartSummary, error) {
+	rows, err := q.Query(ctx, `
+		SELECT c.id, c.user_id, c.product_id, p.seller_id, c.quantity,
+		       p.ingredient_id, p.tool_id, p.recipe_id, p.title, c.variant_id, v.options,
+		       COALESCE(v.price, p.price), p.currency, c.price_at_add, c.currency,
+		       CASE WHEN c.variant_id IS NULL THEN p.stock - `+reservedStock("p")+` ELSE v.stock - `+reservedVariantStock("v")+` END,
+		       p.is_active AND COALESCE(v.is_active, NOT EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id)),
+		       CASE WHEN cardinality(v.image_urls) > 0 THEN v.image_urls ELSE p.image_urls END
+		FROM carts c
+		JOIN products p ON c.product_id = p.id
+		LEFT JOIN product_variants v ON c.variant_id = v.id
+		WHERE c.user_id = $1
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return CartSummary{}, err
+	}
+	defer rows.Close()
+
+	summary := CartSummary{Items: []CartResponse{}, Sellers: []CartSellerSubtotal{}, Subtotals: []Money{}, Totals: []Money{}, Warnings: []CartWarning{}}
+	var productIDs []int
+	for rows.Next() {
+		var cart CartResponse
+		var price, priceAtAdd pgtype.Numeric
+		var currency, currencyAtAdd string
+		if err := rows.Scan(&cart.ID, &cart.UserID, &cart.ProductID, &cart.SellerID, &cart.Quantity,
+			&cart.IngredientID, &cart.ToolID, &cart.RecipeID, &cart.Title, &cart.VariantID, &cart.Options,
+			&price, &currency, &priceAtAdd, &currencyAtAdd, &cart.Stock, &cart.IsActive, &cart.ImageURLs); err != nil {
+			return CartSummary{}, err
+		}
+		if cart.Price, err = moneyFromNumeric(price, currency); err != nil {
+			return CartSummary{}, err
+		}
+		if cart.PriceAtAdd, err = moneyFromNumeric(priceAtAdd, currencyAtAdd); err != nil {
+			return CartSummary{}, err
+		}
+		summary.Items = append(summary.Items, cart)
+		productIDs = append(productIDs, cart.ProductID)
+	}
+	if err := rows.Err(); err != nil {
+		return CartSummary{}, err
+	}
+	rows.Close()
+
+	sales, err := loadActiveSales(ctx, q)
+	if err != nil {
+		return CartSummary{}, err
+	}
+	categories, err := loadProductCategories(ctx, q, productIDs)
+	if err != nil {
+		return CartSummary{}, err
+	}
+
+	type sellerCurrency struct {
+		sellerID int
+		currency string
+	}
+	subtotals := make(map[sellerCurrency]*CartSellerSubtotal)
+	totals := make(map[string]Money)
+
+	for i := range summary.Items {
+		cart := &summary.Items[i]
+		cart.category = categories[cart.ProductID]
+		cart.SalePrice, cart.SalePromotionID = bestSalePrice(sales, cart.promotionTarget())
+		cart.LineTotal = cart.Price.Mul(cart.Quantity)
+		if cart.SalePrice != nil {
+			cart.LineTotal = cart.SalePrice.Mul(cart.Quantity)
+		}
+
+		if !cart.IsActive {
+			summary.Warnings = append(summary.Warnings, CartWarning{cart.ID, cart.ProductID, "inactive",
+				fmt.Sprintf("%s is no longer available", cart.displayTitle())})
+			continue
+		}
+		if cart.Price != cart.PriceAtAdd {
+			summary.Warnings = append(summary.Warnings, CartWarning{cart.ID, cart.ProductID, "price_changed",
+				fmt.Sprintf("The price of %s changed from %s %s to %s %s", cart.displayTitle(), cart.PriceAtAdd, cart.PriceAtAdd.Currency, cart.Price, cart.Price.Currency)})
+		}
+		if cart.Stock < cart.Quantity {
+			summary.Warnings = append(summary.Warnings, CartWarning{cart.ID, cart.ProductID, "insufficient_stock",
+				fmt.Sprintf("Only %d of %s left in stock", cart.Stock, cart.displayTitle())})
+		}
+
+		key := sellerCurrency{cart.SellerID, cart.Price.Currency}
+		subtotal, ok := subtotals[key]
+		if !ok {
+			subtotal = &CartSellerSubtotal{SellerID: cart.SellerID, Subtotal: Money{Currency: cart.Price.Currency}}
+			subtotals[key] = subtotal
+		}
+		subtotal.ItemCount += cart.Quantity
+		subtotal.Subtotal.Amount += cart.LineTotal.Amount
+		summary.ItemCount += cart.Quantity
+		total := totals[cart.Price.Currency]
+		total.Currency = cart.Price.Currency
+		total.Amount += cart.LineTotal.Amount
+		totals[cart.Price.Currency] = total
+	}
+
+	for _, subtotal := range subtotals {
+		summary.Sellers = append(summary.Sellers, *subtotal)
+	}
+	sort.Slice(summary.Sellers, func(i, j int) bool {
+		a, b := summary.Sellers[i], summary.Sellers[j]
+		if a.SellerID != b.SellerID {
+			return a.SellerID < b.SellerID
+		}
+		return a.Subtotal.Currency < b.Subtotal.Currency
+	})
+	for _, total := range totals {
+		summary.Subtotals = append(summary.Subtotals, total)
+	}
+	sort.Slice(summary.Subtotals, func(i, j int) bool { return summary.Subtotals[i].Currency < summary.Subtotals[j].Currency })
+
+	coupon, err := scanPromotion(q.QueryRow(ctx, `
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE id = (SELECT promotion_id FROM cart_coupons WHERE user_id = $1)`, userID))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return CartSummary{}, err
+	}
+	if err == nil {
+		discount, err := couponDiscount(ctx, q, userID, coupon, summary.Items)
+		switch {
+		case errors.Is(err, errCouponNotApplicable):
+			summary.Warnings = append(summary.Warnings, CartWarning{Code: "coupon_invalid", Message: err.Error()})
+		case err != nil:
+			return CartSummary{}, err
+		default:
+			summary.Coupon = &CartCoupon{PromotionID: coupon.ID, Code: *coupon.Code, Discount: discount}
+			total := totals[discount.Currency]
+			total.Amount -= discount.Amount
+			totals[discount.Currency] = total
+		}
+	}
+
+	for _, total := range totals {
+		summary.Totals = append(summary.Totals, total)
+	}
+	sort.Slice(summary.Totals, func(i, j int) bool { return summary.Totals[i].Currency < summary.Totals[j].Currency })
+	return summary, nil
 }
 
 func GetCartsByUserID(db *pgxpool.Pool) gin.HandlerFunc {
@@ -68,35 +290,13 @@ func GetCartsByUserID(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		// Update the query to join with the products table
-		query := `
-			SELECT c.id, c.user_id, c.product_id, c.quantity, 
-			       p.ingredient_id, p.tool_id, p.recipe_id, p.title, p.price, p.stock, p.image_urls
-			FROM carts c
-			JOIN products p ON c.product_id = p.id
-			WHERE c.user_id = $1`
-
-		rows, err := db.Query(c, query, userID)
+		summary, err := priceCart(c, db, userID.(int))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch carts"})
 			return
 		}
-		defer rows.Close()
-
-		var carts []CartResponse
 
-		for rows.Next() {
-			var cart CartResponse
-			if err := rows.Scan(&cart.ID, &cart.UserID, &cart.ProductID, &cart.Quantity,
-				&cart.IngredientID, &cart.ToolID, &cart.RecipeID, &cart.Title,
-				&cart.Price, &cart.Stock, &cart.ImageURLs); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan cart data"})
-				return
-			}
-			carts = append(carts, cart)
-		}
-
-		c.JSON(http.StatusOK, carts)
+		c.JSON(http.StatusOK, summary)
 	}
 }
 
@@ -120,7 +320,28 @@ func UpdateQuantityCart(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(c, `UPDATE carts SET quantity = $1 WHERE id = $2 AND user_id = $3`, quantity, cartID, userID)
+		var productID int
+		var variantID *int
+		err = db.QueryRow(c, `SELECT product_id, variant_id FROM carts WHERE id = $1 AND user_id = $2`, cartID, userID).Scan(&productID, &variantID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart item"})
+			return
+		}
+
+		if err := checkCartQuantity(c, db, productID, variantID, quantity); err != nil {
+			if status, ok := cartErrorStatus(err); ok {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart quantity"})
+			return
+		}
+
+		_, err = db.Exec(c, `UPDATE carts SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND user_id = $3`, quantity, cartID, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart quantity"})
 			return
@@ -171,3 +392,105 @@ func DeleteCarts(db *pgxpool.Pool) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "All cart items cleared successfully"})
 	}
 }
+
+// maxCartItemQuantity caps how many of one product a cart line can hold
+const maxCartItemQuantity = 99
+
+var (
+	errCartProductNotFound   = errors.New("product not found")
+	errCartVariantNotFound   = errors.New("variant not found")
+	errCartVariantRequired   = errors.New("choose a variant of this product")
+	errCartProductInactive   = errors.New("product is not available")
+	errCartQuantityRange     = fmt.Errorf("quantity must be between 1 and %d", maxCartItemQuantity)
+	errCartInsufficientStock = errors.New("not enough stock")
+)
+
+// cartErrorStatus maps the validation errors of cart changes to a response status
+func cartErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, errCartProductNotFound), errors.Is(err, errCartVariantNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, errCartQuantityRange), errors.Is(err, errCartVariantRequired):
+		return http.StatusBadRequest, true
+	case errors.Is(err, errCartProductInactive), errors.Is(err, errCartInsufficientStock):
+		return http.StatusConflict, true
+	}
+	return 0, false
+}
+
+// checkCartQuantity verifies that a cart line may hold quantity of a product or of one of its variants: it exists,
+// is active and has the stock available once pending checkouts are served. A product with variants needs a variant.
+func checkCartQuantity(ctx context.Context, q querier, productID int, variantID *int, quantity int) error {
+	if quantity < 1 || quantity > maxCartItemQuantity {
+		return errCartQuantityRange
+	}
+
+	var stock int
+	var isActive, hasVariants bool
+	err := q.QueryRow(ctx, `
+		SELECT p.stock - `+reservedStock("p")+`, p.is_active, EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id)
+		FROM products p WHERE p.id = $1`, productID).Scan(&stock, &isActive, &hasVariants)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errCartProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if variantID == nil && hasVariants {
+		return errCartVariantRequired
+	}
+	if variantID != nil {
+		var variantActive bool
+		err := q.QueryRow(ctx, `SELECT v.stock - `+reservedVariantStock("v")+`, v.is_active FROM product_variants v WHERE v.id = $1 AND v.product_id = $2`,
+			*variantID, productID).Scan(&stock, &variantActive)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errCartVariantNotFound
+		}
+		if err != nil {
+			return err
+		}
+		isActive = isActive && variantActive
+	}
+	if !isActive {
+		return errCartProductInactive
+	}
+	if stock < quantity {
+		return fmt.Errorf("%w: only %d left", errCartInsufficientStock, stock)
+	}
+	return nil
+}
+
+// addCartItem adds quantity of a product, or of the variant variantID of it, to the user's cart, merging with a line
+// already holding it. The line's price_at_add is reset to the current price, since adding more means the buyer accepted it.
+func addCartItem(ctx context.Context, q querier, userID, productID int, variantID *int, quantity int) error {
+	if quantity < 1 {
+		return errCartQuantityRange
+	}
+
+	var inCart int
+	err := q.QueryRow(ctx, `SELECT quantity FROM carts WHERE user_id = $1 AND product_id = $2 AND variant_id IS NOT DISTINCT FROM $3`,
+		userID, productID, variantID).Scan(&inCart)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if err := checkCartQuantity(ctx, q, productID, variantID, inCart+quantity); err != nil {
+		return err
+	}
+
+	// Lines of plain products and of variants have separate unique indexes
+	conflict := `(user_id, product_id) WHERE variant_id IS NULL`
+	if variantID != nil {
+		conflict = `(user_id, variant_id) WHERE variant_id IS NOT NULL`
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO carts (user_id, product_id, variant_id, quantity, price_at_add, currency)
+		SELECT $1, p.id, v.id, $4, COALESCE(v.price, p.price), p.currency
+		FROM products p
+		LEFT JOIN product_variants v ON v.id = $3 AND v.product_id = p.id
+		WHERE p.id = $2
+		ON CONFLICT `+conflict+` DO UPDATE
+		SET quantity = carts.quantity + EXCLUDED.quantity, price_at_add = EXCLUDED.price_at_add, currency = EXCLUDED.currency,
+		    updated_at = CURRENT_TIMESTAMP
+	`, userID, productID, variantID, quantity)
+	return err
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Strategies for choosing which product to buy for an ingredient
+const (
+	productStrategyCheapest = "cheapest"
+	productStrategyTopRated = "top_rated"
+	productStrategySeller   = "seller"
+)
+
+type RecipeCartLine struct {
+	IngredientID     int     `json:"ingredient_id"`
+	IngredientName   string  `json:"ingredient_name"`
+	RequiredQuantity float64 `json:"required_quantity"`
+	Unit             string  `json:"unit"`
+	ProductID        int     `json:"product_id,omitempty"`
+	Title            string  `json:"title,omitempty"`
+	SellerID         int     `json:"seller_id,omitempty"`
+	Price            *Money  `json:"price,omitempty"`
+	Quantity         int     `json:"quantity,omitempty"`
+}
+
+type RecipeCartResult struct {
+	RecipeID int              `json:"recipe_id"`
+	Strategy string           `json:"strategy"`
+	Added    []RecipeCartLine `json:"added"`
+	// Partial lists lines added with less than needed because no product had enough stock or room left in the cart,
+	// which holds at most maxCartItemQuantity of a product; a line with no quantity had nothing added
+	Partial     []RecipeCartLine `json:"partial"`
+	Unavailable []RecipeCartLine `json:"unavailable"`
+}
+
+// loadIngredientProducts returns active products with available stock for the given ingredients, best first according
+// to strategy: cheapest, highest average rating, or the preferred seller's products ahead of the cheapest.
+// Callers ranking by cost for a quantity re-sort with productsForQuantity once pack sizes are known.
+// Products with variants are left out, since picking one of their variants is up to the buyer.
+func loadIngredientProducts(ctx context.Context, q querier, ingredientIDs []int, strategy string, sellerID int) (map[int][]ShoppingListProduct, error) {
+	args := []interface{}{ingredientIDs}
+	order := "p.price, p.id"
+	switch strategy {
+	case productStrategyTopRated:
+		order = "r.average_rating DESC NULLS LAST, p.price, p.id"
+	case productStrategySeller:
+		args = append(args, sellerID)
+		order = "(p.seller_id = $2) DESC, p.price, p.id"
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT p.id, p.seller_id, p.ingredient_id, p.title, p.price, p.currency, p.stock - `+reservedStock("p")+`, r.average_rating, p.pack_quantity, COALESCE(p.pack_unit, '')
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, ROUND(AVG(rating), 2)::float8 AS average_rating
+			FROM product_rating
+			WHERE reply_id IS NULL
+			GROUP BY product_id
+		) r ON r.product_id = p.id
+		WHERE p.ingredient_id = ANY($1) AND p.is_active AND p.stock > `+reservedStock("p")+`
+		  AND NOT EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id)
+		ORDER BY `+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make(map[int][]ShoppingListProduct)
+	for rows.Next() {
+		var product ShoppingListProduct
+		var ingredientID int
+		var price pgtype.Numeric
+		var currency string
+		if err := rows.Scan(&product.ID, &product.SellerID, &ingredientID, &product.Title, &price, &currency, &product.Stock, &product.Rating,
+			&product.PackQuantity, &product.PackUnit); err != nil {
+			return nil, err
+		}
+		if product.Price, err = moneyFromNumeric(price, currency); err != nil {
+			return nil, err
+		}
+		product.UnitPrice, product.UnitPriceUnit = productUnitPrice(product.Price, product.PackQuantity, product.PackUnit)
+		products[ingredientID] = append(products[ingredientID], product)
+	}
+	return products, rows.Err()
+}
+
+// cartQuantityFor returns how many of a product to buy to cover quantity (in unit) of its ingredient.
+// Products without a pack size, or whose pack cannot be compared, count as one product per line.
+func cartQuantityFor(quantity float64, unit string, product ShoppingListProduct) int {
+	if product.PackQuantity == nil || *product.PackQuantity <= 0 {
+		return 1
+	}
+	needed, ok := convertQuantity(quantity, unit, product.PackUnit)
+	if !ok {
+		return 1
+	}
+	// Tolerate rounding so 1000 g from 2 x 500 g packs does not become three packs
+	return max(1, int(math.Ceil(needed / *product.PackQuantity - 1e-9)))
+}
+
+// loadCartQuantities returns how many of each product without variants the user's cart holds
+func loadCartQuantities(ctx context.Context, q querier, userID int) (map[int]int, error) {
+	rows, err := q.Query(ctx, `SELECT product_id, quantity FROM carts WHERE user_id = $1 AND variant_id IS NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]int)
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return nil, err
+		}
+		quantities[productID] = quantity
+	}
+	return quantities, rows.Err()
+}
+
+// productsForQuantity sets the cart quantity of each product for the needed amount and, when byCost is set,
+// orders them by what that quantity costs, so a large cheap pack can beat a small one
+func productsForQuantity(products []ShoppingListProduct, quantity float64, unit string, byCost bool) []ShoppingListProduct {
+	sized := make([]ShoppingListProduct, len(products))
+	for i, product := range products {
+		product.CartQuantity = cartQuantityFor(quantity, unit, product)
+		sized[i] = product
+	}
+	if byCost {
+		sort.SliceStable(sized, func(i, j int) bool {
+			return sized[i].Price.Mul(sized[i].CartQuantity).Less(sized[j].Price.Mul(sized[j].CartQuantity))
+		})
+	}
+	return sized
+}
+
+// AddRecipeToCart puts a product for every ingredient of a recipe into the user's cart in one transaction.
+// ?strategy picks products (cheapest, top_rated or seller with ?seller_id) and ?servings scales the recipe.
+// Ingredients without a purchasable product are returned as unavailable, those only partly covered as partial.
+func AddRecipeToCart(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		recipeID, err := strconv.Atoi(c.Param("recipe_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			return
+		}
+
+		strategy := c.DefaultQuery("strategy", productStrategyCheapest)
+		var sellerID int
+		switch strategy {
+		case productStrategyCheapest, productStrategyTopRated:
+		case productStrategySeller:
+			sellerID, err = strconv.Atoi(c.Query("seller_id"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "seller_id is required for the seller strategy"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown strategy %q, expected cheapest, top_rated or seller", strategy)})
+			return
+		}
+
+		servings := 0
+		if value := c.Query("servings"); value != "" {
+			servings, err = strconv.Atoi(value)
+			if err != nil || servings <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidServings.Error()})
+				return
+			}
+		}
+
+		// Another user's private recipe gets the same 404 as a missing one
+		recipe, err := fetchRecipe(c, db, recipeID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !recipe.RecipeData.IsPublic && recipe.RecipeData.UserID != userID.(int)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+			return
+		}
+
+		items, err := aggregateShoppingList(c, db, userID.(int), []ShoppingListRecipe{{RecipeID: recipeID, Servings: servings}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe ingredients"})
+			return
+		}
+		ids := make([]int, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.IngredientID)
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		products, err := loadIngredientProducts(c, tx, ids, strategy, sellerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+			return
+		}
+
+		// Products already in the cart leave less room for the recipe's quantity
+		inCart, err := loadCartQuantities(c, tx, userID.(int))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch carts"})
+			return
+		}
+
+		result := RecipeCartResult{RecipeID: recipeID, Strategy: strategy, Added: []RecipeCartLine{}, Partial: []RecipeCartLine{}, Unavailable: []RecipeCartLine{}}
+		for _, item := range items {
+			line := RecipeCartLine{
+				IngredientID:     item.IngredientID,
+				IngredientName:   item.IngredientName,
+				RequiredQuantity: math.Round(item.RequiredQuantity*1000) / 1000,
+				Unit:             item.Unit,
+			}
+			candidates := productsForQuantity(products[item.IngredientID], item.RequiredQuantity, item.Unit, strategy == productStrategyCheapest)
+			if len(candidates) == 0 {
+				result.Unavailable = append(result.Unavailable, line)
+				continue
+			}
+
+			// Take the best product with room for the whole quantity, otherwise the first one with the most room.
+			// The room is what stock and the cart quantity limit allow on top of what the cart already holds.
+			chosen, quantity, enough := candidates[0], 0, false
+			for _, candidate := range candidates {
+				room := min(candidate.Stock, maxCartItemQuantity) - inCart[candidate.ID]
+				if room >= candidate.CartQuantity {
+					chosen, quantity, enough = candidate, candidate.CartQuantity, true
+					break
+				}
+				if room > quantity {
+					chosen, quantity = candidate, room
+				}
+			}
+
+			if quantity > 0 {
+				err := addCartItem(c, tx, userID.(int), chosen.ID, nil, quantity)
+				if _, ok := cartErrorStatus(err); ok {
+					// Stock changed since it was loaded; the product is still reported, with nothing added
+					quantity, enough = 0, false
+				} else if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add products to cart"})
+					return
+				}
+				inCart[chosen.ID] += quantity
+			}
+			line.ProductID, line.Title, line.SellerID, line.Price, line.Quantity = chosen.ID, chosen.Title, chosen.SellerID, &chosen.Price, quantity
+			if enough {
+				result.Added = append(result.Added, line)
+			} else {
+				result.Partial = append(result.Partial, line)
+			}
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
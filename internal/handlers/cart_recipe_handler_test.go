@@ -0,0 +1,31 @@
+package handlers
+
+import "testing"
+
+func TestCartQuantityFor(t *testing.T) {
+	pack := func(quantity float64, unit string) ShoppingListProduct {
+		return ShoppingListProduct{PackQuantity: &quantity, PackUnit: unit}
+	}
+
+	tests := []struct {
+		name     string
+		quantity float64
+		unit     string
+		product  ShoppingListProduct
+		want     int
+	}{
+		{"exact number of packs", 1000, "g", pack(500, "g"), 2},
+		{"partial pack rounds up", 1100, "g", pack(500, "g"), 3},
+		{"converted units", 1.5, "kg", pack(500, "g"), 3},
+		{"less than one pack", 100, "g", pack(500, "g"), 1},
+		{"unconvertible units", 2, "cup", pack(500, "g"), 1},
+		{"no pack size", 1000, "g", ShoppingListProduct{}, 1},
+		{"zero pack size", 1000, "g", pack(0, "g"), 1},
+	}
+
+	for _, tt := range tests {
+		if got := cartQuantityFor(tt.quantity, tt.unit, tt.product); got != tt.want {
+			t.Errorf("%s: cartQuantityFor(%v %s) = %d; want %d", tt.name, tt.quantity, tt.unit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	catalogFormat      = "foocipe-catalog"
+	catalogVersion     = 1
+	maxCatalogLineSize = 16 << 20
+	// maxCatalogImportSize caps a catalog uploaded to the admin endpoint; the CLI reads files of any size
+	maxCatalogImportSize = 256 << 20
+)
+
+const (
+	catalogRecordHeader     = "header"
+	catalogRecordIngredient = "ingredient"
+	catalogRecordTool       = "tool"
+	catalogRecordRecipe     = "recipe"
+)
+
+// catalogRecord is one NDJSON line of a catalog file
+type catalogRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type catalogHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+type CatalogExportSummary struct {
+	Ingredients int `json:"ingredients"`
+	Tools       int `json:"tools"`
+	Recipes     int `json:"recipes"`
+}
+
+type CatalogConflict struct {
+	Line       int    `json:"line"`
+	Type       string `json:"type"`
+	SourceID   int    `json:"source_id,omitempty"`
+	ExistingID int    `json:"existing_id,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+type CatalogImportCounts struct {
+	Created  int `json:"created"`
+	Existing int `json:"existing"`
+	Skipped  int `json:"skipped"`
+}
+
+type CatalogImportReport struct {
+	DryRun      bool                `json:"dry_run"`
+	Ingredients CatalogImportCounts `json:"ingredients"`
+	Tools       CatalogImportCounts `json:"tools"`
+	Recipes     CatalogImportCounts `json:"recipes"`
+	// IDMap maps the IDs in the file to the IDs in this database, per record type
+	IDMap struct {
+		Ingredients map[int]int `json:"ingredients"`
+		Tools       map[int]int `json:"tools"`
+		Recipes     map[int]int `json:"recipes"`
+	} `json:"id_map"`
+	Conflicts []CatalogConflict `json:"conflicts"`
+	// CreatedRecipeIDs lists the new recipes so they can be indexed in Elasticsearch after commit
+	CreatedRecipeIDs []int `json:"-"`
+}
+
+// CatalogImportOptions controls ImportCatalog. OwnerID, when not zero, assigns every imported recipe to
+// that user instead of the owner recorded in the file.
+type CatalogImportOptions struct {
+	DryRun  bool
+	OwnerID int
+}
+
+// ExportCatalog writes every recipe, with the ingredient and tool rows they reference, as NDJSON.
+// Catalog rows come first so that an import can remap their IDs before reading the recipes.
+func ExportCatalog(ctx context.Context, db *pgxpool.Pool, w io.Writer) (CatalogExportSummary, error) {
+	var summary CatalogExportSummary
+
+	// A repeatable read snapshot keeps recipes and catalog rows consistent while the file is written
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback(ctx)
+
+	encoder := json.NewEncoder(w)
+	write := func(recordType string, data interface{}) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(catalogRecord{Type: recordType, Data: raw})
+	}
+
+	if err := write(catalogRecordHeader, catalogHeader{Format: catalogFormat, Version: catalogVersion, ExportedAt: time.Now().UTC()}); err != nil {
+		return summary, err
+	}
+
+	ingredients, err := loadCatalogIngredients(ctx, tx, `WHERE id IN (SELECT ingredient_id FROM recipe_ingredient)`)
+	if err != nil {
+		return summary, err
+	}
+	for _, ingredient := range ingredients {
+		if err := write(catalogRecordIngredient, ingredient); err != nil {
+			return summary, err
+		}
+		summary.Ingredients++
+	}
+
+	tools, err := loadCatalogTools(ctx, tx, `WHERE id IN (SELECT tool_id FROM recipe_tool)`)
+	if err != nil {
+		return summary, err
+	}
+	for _, tool := range tools {
+		if err := write(catalogRecordTool, tool); err != nil {
+			return summary, err
+		}
+		summary.Tools++
+	}
+
+	recipeIDs, err := loadRecipeIDs(ctx, tx)
+	if err != nil {
+		return summary, err
+	}
+	for _, recipeID := range recipeIDs {
+		recipe, err := fetchRecipe(ctx, tx, recipeID)
+		if err != nil {
+			return summary, err
+		}
+		if err := write(catalogRecordRecipe, recipe); err != nil {
+			return summary, err
+		}
+		summary.Recipes++
+	}
+
+	return summary, nil
+}
+
+// ImportCatalog reads an NDJSON catalog in one transaction. Ingredients and tools are matched to existing
+// rows by name (case-insensitive) and created otherwise; recipes already present for the same owner and
+// name are left alone, which makes importing the same file twice a no-op. Mismatches are reported as
+// conflicts rather than overwriting data. In dry-run mode the transaction is rolled back.
+func ImportCatalog(ctx context.Context, db *pgxpool.Pool, r io.Reader, options CatalogImportOptions) (CatalogImportReport, error) {
+	report := CatalogImportReport{DryRun: options.DryRun, Conflicts: make([]CatalogConflict, 0)}
+	report.IDMap.Ingredients = make(map[int]int)
+	report.IDMap.Tools = make(map[int]int)
+	report.IDMap.Recipes = make(map[int]int)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback(ctx)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxCatalogLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var record catalogRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Reason: "invalid JSON: " + err.Error()})
+			continue
+		}
+
+		switch record.Type {
+		case catalogRecordHeader:
+			var header catalogHeader
+			if err := json.Unmarshal(record.Data, &header); err != nil || header.Format != catalogFormat || header.Version > catalogVersion {
+				return report, fmt.Errorf("line %d: unsupported catalog header", line)
+			}
+		case catalogRecordIngredient:
+			var ingredient Ingredients
+			if err := json.Unmarshal(record.Data, &ingredient); err != nil {
+				report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Type: record.Type, Reason: "invalid ingredient: " + err.Error()})
+				continue
+			}
+			if err := importCatalogIngredient(ctx, tx, line, ingredient, &report); err != nil {
+				return report, fmt.Errorf("line %d: %w", line, err)
+			}
+		case catalogRecordTool:
+			var tool Tools
+			if err := json.Unmarshal(record.Data, &tool); err != nil {
+				report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Type: record.Type, Reason: "invalid tool: " + err.Error()})
+				continue
+			}
+			if err := importCatalogTool(ctx, tx, line, tool, &report); err != nil {
+				return report, fmt.Errorf("line %d: %w", line, err)
+			}
+		case catalogRecordRecipe:
+			var recipe RecipeRequest
+			if err := json.Unmarshal(record.Data, &recipe); err != nil {
+				report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Type: record.Type, Reason: "invalid recipe: " + err.Error()})
+				continue
+			}
+			if err := importCatalogRecipe(ctx, tx, line, recipe, options.OwnerID, &report); err != nil {
+				return report, fmt.Errorf("line %d: %w", line, err)
+			}
+		default:
+			report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Type: record.Type, Reason: "unknown record type"})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	if options.DryRun {
+		report.CreatedRecipeIDs = nil
+		return report, nil
+	}
+	return report, tx.Commit(ctx)
+}
+
+func importCatalogIngredient(ctx context.Context, tx pgx.Tx, line int, ingredient Ingredients, report *CatalogImportReport) error {
+	sourceID := ingredient.ID
+	existing, err := loadCatalogIngredients(ctx, tx, `WHERE lower(name) = lower($1) ORDER BY id LIMIT 1`, ingredient.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		// Quantities are stored in the ingredient's unit, so a different unit would silently change recipes
+		if normalizeUnit(existing[0].Unit) != normalizeUnit(ingredient.Unit) {
+			report.Ingredients.Skipped++
+			report.Conflicts = append(report.Conflicts, CatalogConflict{
+				Line: line, Type: catalogRecordIngredient, SourceID: sourceID, ExistingID: existing[0].ID,
+				Reason: fmt.Sprintf("unit %q does not match existing unit %q", ingredient.Unit, existing[0].Unit),
+			})
+			return nil
+		}
+		report.Ingredients.Existing++
+		report.IDMap.Ingredients[sourceID] = existing[0].ID
+		return nil
+	}
+
+	allergens, err := normalizeAllergens(ingredient.Allergens)
+	if err != nil {
+		report.Ingredients.Skipped++
+		report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Type: catalogRecordIngredient, SourceID: sourceID, Reason: err.Error()})
+		return nil
+	}
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO ingredients (name, category, sub_categories, description, image_urls, unit, is_vegetarian, is_vegan, allergens)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, ingredient.Name, ingredient.Category, ingredient.SubCategories, ingredient.Description, ingredient.ImageURLs,
+		ingredient.Unit, ingredient.IsVegetarian, ingredient.IsVegan, allergens).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	report.Ingredients.Created++
+	report.IDMap.Ingredients[sourceID] = id
+	return nil
+}
+
+func importCatalogTool(ctx context.Context, tx pgx.Tx, line int, tool Tools, report *CatalogImportReport) error {
+	sourceID := tool.ID
+	existing, err := loadCatalogTools(ctx, tx, `WHERE lower(name) = lower($1) ORDER BY id LIMIT 1`, tool.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		report.Tools.Existing++
+		report.IDMap.Tools[sourceID] = existing[0].ID
+		return nil
+	}
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tools (name, category, sub_categories, description, image_urls, unit)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, tool.Name, tool.Category, tool.SubCategories, tool.Description, tool.ImageURLs, tool.Unit).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	report.Tools.Created++
+	report.IDMap.Tools[sourceID] = id
+	return nil
+}
+
+func importCatalogRecipe(ctx context.Context, tx pgx.Tx, line int, recipe RecipeRequest, ownerID int, report *CatalogImportReport) error {
+	sourceID := recipe.RecipeData.ID
+	skip := func(existingID int, reason string) error {
+		report.Recipes.Skipped++
+		report.Conflicts = append(report.Conflicts, CatalogConflict{Line: line, Type: catalogRecordRecipe, SourceID: sourceID, ExistingID: existingID, Reason: reason})
+		return nil
+	}
+
+	if ownerID == 0 {
+		ownerID = recipe.RecipeData.UserID
+	}
+	recipe.RecipeData.UserID = ownerID
+
+	// Steps refer to ingredient and tool IDs from here on, which are remapped below
+	detachRecipeChildren(&recipe)
+	for i, ingredient := range recipe.RecipeIngredientData {
+		id, ok := report.IDMap.Ingredients[ingredient.IngredientID]
+		if !ok {
+			return skip(0, fmt.Sprintf("ingredient %d is missing or was skipped", ingredient.IngredientID))
+		}
+		recipe.RecipeIngredientData[i].IngredientID = id
+	}
+	for i, tool := range recipe.RecipeToolData {
+		id, ok := report.IDMap.Tools[tool.ToolID]
+		if !ok {
+			return skip(0, fmt.Sprintf("tool %d is missing or was skipped", tool.ToolID))
+		}
+		recipe.RecipeToolData[i].ToolID = id
+	}
+	for i := range recipe.StepsData {
+		step := &recipe.StepsData[i]
+		for j, ingredientID := range step.IngredientIDs {
+			id, ok := report.IDMap.Ingredients[ingredientID]
+			if !ok {
+				return skip(0, fmt.Sprintf("step %d refers to ingredient %d, which is missing or was skipped", i+1, ingredientID))
+			}
+			step.IngredientIDs[j] = id
+		}
+		for j, toolID := range step.ToolIDs {
+			id, ok := report.IDMap.Tools[toolID]
+			if !ok {
+				return skip(0, fmt.Sprintf("step %d refers to tool %d, which is missing or was skipped", i+1, toolID))
+			}
+			step.ToolIDs[j] = id
+		}
+	}
+
+	var existingID int
+	err := tx.QueryRow(ctx, `SELECT id FROM recipes WHERE user_id = $1 AND name = $2 ORDER BY id LIMIT 1`, ownerID, recipe.RecipeData.Name).Scan(&existingID)
+	if err == nil {
+		existing, err := fetchRecipe(ctx, tx, existingID)
+		if err != nil {
+			return err
+		}
+		detachRecipeChildren(&existing)
+
+		diff := diffRecipes(0, 0, existing, recipe)
+		report.IDMap.Recipes[sourceID] = existingID
+		if len(diff.Fields) > 0 || recipeCollectionChanged(diff.Ingredients) || recipeCollectionChanged(diff.Tools) || recipeCollectionChanged(diff.Steps) {
+			return skip(existingID, "a recipe with the same owner and name exists with different content")
+		}
+		report.Recipes.Existing++
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	// Keep the fork lineage when the parent was imported earlier in the file
+	var forkedFromID *int
+	if recipe.RecipeData.ForkedFromID != nil {
+		if parentID, ok := report.IDMap.Recipes[*recipe.RecipeData.ForkedFromID]; ok {
+			forkedFromID = &parentID
+		}
+	}
+
+	// A savepoint lets a recipe with invalid content be skipped without its partially inserted rows
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(ctx)
+
+	id, err := insertRecipe(ctx, savepoint, ownerID, recipe, forkedFromID)
+	if err != nil {
+		var childErr invalidRecipeChildError
+		var stepErr invalidStepError
+		if errors.As(err, &childErr) || errors.As(err, &stepErr) {
+			return skip(0, err.Error())
+		}
+		return err
+	}
+	if err := savepoint.Commit(ctx); err != nil {
+		return err
+	}
+
+	report.Recipes.Created++
+	report.IDMap.Recipes[sourceID] = id
+	report.CreatedRecipeIDs = append(report.CreatedRecipeIDs, id)
+	return nil
+}
+
+func recipeCollectionChanged(diff RecipeCollectionDiff) bool {
+	return len(diff.Added) > 0 || len(diff.Removed) > 0 || len(diff.Changed) > 0
+}
+
+func loadCatalogIngredients(ctx context.Context, q querier, where string, args ...interface{}) ([]Ingredients, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, name, category, COALESCE(sub_categories, '{}'), description, COALESCE(image_urls, '{}'), unit,
+		       is_vegetarian, is_vegan, allergens
+		FROM ingredients `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ingredients []Ingredients
+	for rows.Next() {
+		var ingredient Ingredients
+		if err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Category, &ingredient.SubCategories, &ingredient.Description,
+			&ingredient.ImageURLs, &ingredient.Unit, &ingredient.IsVegetarian, &ingredient.IsVegan, &ingredient.Allergens); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+func loadCatalogTools(ctx context.Context, q querier, where string, args ...interface{}) ([]Tools, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, name, category, COALESCE(sub_categories, '{}'), description, COALESCE(image_urls, '{}'), unit
+		FROM tools `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tools []Tools
+	for rows.Next() {
+		var tool Tools
+		if err := rows.Scan(&tool.ID, &tool.Name, &tool.Category, &tool.SubCategories, &tool.Description, &tool.ImageURLs, &tool.Unit); err != nil {
+			return nil, err
+		}
+		tools = append(tools, tool)
+	}
+	return tools, rows.Err()
+}
+
+func loadRecipeIDs(ctx context.Context, q querier) ([]int, error) {
+	rows, err := q.Query(ctx, `SELECT id FROM recipes ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReindexRecipes refreshes the Elasticsearch documents of the given recipes, returning the IDs that failed
+func ReindexRecipes(ctx context.Context, db *pgxpool.Pool, recipeIDs []int) []int {
+	var failed []int
+	for _, id := range recipeIDs {
+		if err := reindexRecipe(ctx, db, id); err != nil {
+			failed = append(failed, id)
+		}
+	}
+	sort.Ints(failed)
+	return failed
+}
+
+func ExportCatalogNDJSON(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="catalog-%s.ndjson"`, time.Now().UTC().Format("20060102-150405")))
+		c.Status(http.StatusOK)
+
+		// Headers are already sent once streaming starts, so a failure can only be logged
+		if _, err := ExportCatalog(c, db, c.Writer); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+func ImportCatalogNDJSON(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		options := CatalogImportOptions{DryRun: c.Query("dry_run") == "true"}
+		if owner := c.Query("owner_id"); owner != "" {
+			ownerID, err := strconv.Atoi(owner)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner_id"})
+				return
+			}
+			options.OwnerID = ownerID
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogImportSize)
+
+		var reader io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			file, _, err := c.Request.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+				return
+			}
+			defer file.Close()
+			reader = file
+		}
+
+		report, err := ImportCatalog(c, db, reader, options)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Catalog is larger than %d MB, nothing was imported", maxCatalogImportSize>>20)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Catalog import failed, nothing was imported", "details": err.Error(), "report": report})
+			return
+		}
+
+		if failed := ReindexRecipes(c, db, report.CreatedRecipeIDs); len(failed) > 0 {
+			c.JSON(http.StatusOK, gin.H{"report": report, "warning": "Some imported recipes could not be indexed in Elasticsearch", "unindexed_recipe_ids": failed})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"report": report})
+	}
+}
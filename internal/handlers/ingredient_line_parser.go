@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type ParsedIngredientLine struct {
+	Raw      string   `json:"raw"`
+	Quantity *float64 `json:"quantity"`
+	// QuantityMax is the upper bound of a range such as "2-3", in which case Quantity is the lower bound
+	QuantityMax *float64 `json:"quantity_max,omitempty"`
+	Unit        string   `json:"unit"`
+	Name        string   `json:"name"`
+	Note        string   `json:"note,omitempty"`
+}
+
+var unicodeFractions = map[rune]string{
+	'¼': "1/4", '½': "1/2", '¾': "3/4",
+	'⅐': "1/7", '⅑': "1/9", '⅒': "1/10",
+	'⅓': "1/3", '⅔': "2/3",
+	'⅕': "1/5", '⅖': "2/5", '⅗': "3/5", '⅘': "4/5",
+	'⅙': "1/6", '⅚': "5/6",
+	'⅛': "1/8", '⅜': "3/8", '⅝': "5/8", '⅞': "7/8",
+	'↉': "0/3",
+}
+
+// scriptDigits maps superscript and subscript digits, used in fractions like "¹⁄₂", to plain digits
+var scriptDigits = map[rune]rune{
+	'⁰': '0', '¹': '1', '²': '2', '³': '3', '⁴': '4', '⁵': '5', '⁶': '6', '⁷': '7', '⁸': '8', '⁹': '9',
+	'₀': '0', '₁': '1', '₂': '2', '₃': '3', '₄': '4', '₅': '5', '₆': '6', '₇': '7', '₈': '8', '₉': '9',
+}
+
+// countUnits are units that do not convert to mass or volume but are still written as units in recipes
+var countUnits = map[string]string{
+	"clove": "clove", "cloves": "clove",
+	"piece": "piece", "pieces": "piece", "pc": "piece", "pcs": "piece",
+	"pinch": "pinch", "pinches": "pinch",
+	"dash": "dash", "dashes": "dash",
+	"can": "can", "cans": "can",
+	"slice": "slice", "slices": "slice",
+	"bunch": "bunch", "bunches": "bunch",
+	"sprig": "sprig", "sprigs": "sprig",
+	"stick": "stick", "sticks": "stick",
+	"handful": "handful", "handfuls": "handful",
+	"pack": "pack", "packs": "pack", "packet": "pack", "packets": "pack",
+	"box": "box", "boxes": "box",
+
+	// Vietnamese units, mapped to the English unit where one exists
+	"tép": "clove", "miếng": "piece", "nhúm": "pinch", "lon": "can", "lát": "slice",
+	"bó": "bunch", "nắm": "handful", "gói": "pack", "hộp": "box",
+	"trái": "quả", "quả": "quả", "củ": "củ", "nhánh": "nhánh", "cây": "cây",
+	"chén": "chén", "bát": "bát",
+}
+
+// quantityRangeWords join the two bounds of a written range such as "2 to 3" or "2 đến 3"
+var quantityRangeWords = map[string]bool{"-": true, "to": true, "or": true, "đến": true, "tới": true, "hoặc": true}
+
+var (
+	parenthesisPattern = regexp.MustCompile(`\(([^)]*)\)`)
+	// noteCommaPattern finds the comma before a preparation note, skipping decimal commas such as "1,5"
+	noteCommaPattern     = regexp.MustCompile(`,(?:\D|$)`)
+	numericRangePattern  = regexp.MustCompile(`(\d)\s*[-–—]\s*(\d)`)
+	attachedUnitPattern  = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)(\pL+\.?)$`)
+	decimalNumberPattern = regexp.MustCompile(`^(?:\d+(?:\.\d*)?|\.\d+)$`)
+)
+
+// expandUnicodeFractions rewrites "1½", "½" and "1¹⁄₂" as "1 1/2" and "1/2" so they parse like typed fractions
+func expandUnicodeFractions(line string) string {
+	var b strings.Builder
+	previous := ' '
+	for _, r := range line {
+		if fraction, ok := unicodeFractions[r]; ok {
+			b.WriteString(" " + fraction + " ")
+			previous = ' '
+			continue
+		}
+		if r == '⁄' {
+			r = '/'
+		}
+		if digit, ok := scriptDigits[r]; ok {
+			// Separate the whole part in "1¹⁄₂" from the fraction
+			if previous >= '0' && previous <= '9' {
+				b.WriteRune(' ')
+			}
+			b.WriteRune(digit)
+			previous = r
+			continue
+		}
+		b.WriteRune(r)
+		previous = r
+	}
+	return b.String()
+}
+
+// parseQuantityToken parses "2", "1.5", "1,5" or "3/4"
+func parseQuantityToken(token string) (float64, bool) {
+	token = strings.ReplaceAll(token, ",", ".")
+	if numerator, denominator, ok := strings.Cut(token, "/"); ok {
+		n, okN := parseDecimalNumber(numerator)
+		d, okD := parseDecimalNumber(denominator)
+		if !okN || !okD || d == 0 {
+			return 0, false
+		}
+		return n / d, true
+	}
+	return parseDecimalNumber(token)
+}
+
+// parseDecimalNumber parses a plain decimal such as "2" or "1.5". Unlike strconv.ParseFloat it rejects words
+// like "inf" or "nan", signs, exponents and hex, which are never quantities in an ingredient line.
+func parseDecimalNumber(value string) (float64, bool) {
+	if !decimalNumberPattern.MatchString(value) {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	return number, err == nil && !math.IsInf(number, 0)
+}
+
+// parseIngredientLine splits a free-text ingredient line such as "1 ½ cups flour, sifted" or
+// "2-3 muỗng canh nước mắm" into quantity, unit, name and note. Lines without a leading quantity
+// (e.g. "salt to taste") keep a nil quantity.
+func parseIngredientLine(line string) ParsedIngredientLine {
+	parsed := ParsedIngredientLine{Raw: strings.TrimSpace(line)}
+	text := expandUnicodeFractions(norm.NFC.String(parsed.Raw))
+
+	var notes []string
+	for _, match := range parenthesisPattern.FindAllStringSubmatch(text, -1) {
+		if note := strings.TrimSpace(match[1]); note != "" {
+			notes = append(notes, note)
+		}
+	}
+	text = parenthesisPattern.ReplaceAllString(text, " ")
+	if at := noteCommaPattern.FindStringIndex(text); at != nil {
+		if note := strings.TrimSpace(text[at[0]+1:]); note != "" {
+			notes = append(notes, note)
+		}
+		text = text[:at[0]]
+	}
+	parsed.Note = strings.Join(notes, "; ")
+
+	text = numericRangePattern.ReplaceAllString(text, "$1 - $2")
+	var tokens []string
+	for _, token := range strings.Fields(text) {
+		// "200g" and "1,5kg" carry their unit on the number
+		if match := attachedUnitPattern.FindStringSubmatch(token); match != nil && isIngredientUnit(match[2]) {
+			tokens = append(tokens, match[1], match[2])
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+
+	quantity, consumed := parseLeadingQuantity(tokens)
+	if consumed > 0 {
+		parsed.Quantity = &quantity
+		tokens = tokens[consumed:]
+		if len(tokens) > 1 && quantityRangeWords[strings.ToLower(tokens[0])] {
+			if upper, n := parseLeadingQuantity(tokens[1:]); n > 0 && upper >= quantity {
+				parsed.QuantityMax = &upper
+				tokens = tokens[1+n:]
+			}
+		}
+	}
+
+	// Unit, trying multi-word units such as "fl oz" or "muỗng cà phê" first
+	for words := min(3, len(tokens)); words > 0 && parsed.Unit == ""; words-- {
+		if unit, ok := ingredientUnit(strings.Join(tokens[:words], " ")); ok {
+			parsed.Unit = unit
+			tokens = tokens[words:]
+		}
+	}
+	if parsed.Unit != "" && len(tokens) > 0 && strings.EqualFold(tokens[0], "of") {
+		tokens = tokens[1:]
+	}
+
+	parsed.Name = strings.ToLower(strings.Join(tokens, " "))
+	return parsed
+}
+
+// parseLeadingQuantity reads a quantity from the start of tokens, including mixed numbers like "1 1/2",
+// and returns how many tokens it used
+func parseLeadingQuantity(tokens []string) (float64, int) {
+	var quantity float64
+	consumed := 0
+	for consumed < len(tokens) && consumed < 2 {
+		value, ok := parseQuantityToken(tokens[consumed])
+		if !ok || (consumed == 1 && !strings.Contains(tokens[consumed], "/")) {
+			break
+		}
+		quantity += value
+		consumed++
+	}
+	return quantity, consumed
+}
+
+// ingredientUnit resolves a unit written in an ingredient line, either a convertible unit or a count unit
+func ingredientUnit(word string) (string, bool) {
+	if info, ok := lookupUnit(word); ok {
+		return info.Name, true
+	}
+	unit, ok := countUnits[strings.ToLower(strings.TrimSuffix(word, "."))]
+	return unit, ok
+}
+
+func isIngredientUnit(word string) bool {
+	_, ok := ingredientUnit(word)
+	return ok
+}
+
+// loadIngredientCatalog returns every ingredient with the fields needed for matching parsed lines
+func loadIngredientCatalog(ctx context.Context, q querier) ([]Ingredients, error) {
+	rows, err := q.Query(ctx, `SELECT id, name, unit FROM ingredients ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ingredients []Ingredients
+	for rows.Next() {
+		var ingredient Ingredients
+		if err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Unit); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+// minIngredientMatchScore is the trigram similarity below which a name is not considered a match
+const minIngredientMatchScore = 0.45
+
+// matchIngredientName finds the catalog ingredient whose name is most similar to name
+func matchIngredientName(name string, catalog []Ingredients) (Ingredients, float64, bool) {
+	target := normalizeIngredientName(name)
+	if target == "" {
+		return Ingredients{}, 0, false
+	}
+
+	var best Ingredients
+	bestScore := 0.0
+	for _, ingredient := range catalog {
+		score := ingredientNameScore(target, ingredient.Name)
+		if score > bestScore {
+			best, bestScore = ingredient, score
+		}
+	}
+
+	if bestScore < minIngredientMatchScore {
+		return Ingredients{}, bestScore, false
+	}
+	return best, bestScore, true
+}
+
+// ingredientNameScore rates how well a catalog name matches an already normalized parsed name, from 0 to 1
+func ingredientNameScore(target, name string) float64 {
+	candidate := normalizeIngredientName(name)
+	score := trigramSimilarity(target, candidate)
+	// Prefer a catalog name contained in the line, e.g. "flour" in "all-purpose flour"
+	if score < 1 && candidate != "" && strings.Contains(" "+target+" ", " "+candidate+" ") {
+		score = max(score, 0.8)
+	}
+	return score
+}
+
+// normalizeIngredientName lowercases a name, drops punctuation and naive plural endings
+func normalizeIngredientName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == ' ' || r == '-' || r == ',' || r == '.' || r == '\t'
+	})
+	for i, word := range words {
+		switch {
+		case strings.HasSuffix(word, "ies") && len(word) > 4:
+			words[i] = strings.TrimSuffix(word, "ies") + "y"
+		case strings.HasSuffix(word, "oes") && len(word) > 4:
+			words[i] = strings.TrimSuffix(word, "es")
+		case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && len(word) > 3:
+			words[i] = strings.TrimSuffix(word, "s")
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// trigramSimilarity mirrors pg_trgm: the share of distinct three-letter groups two strings have in common
+func trigramSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import "testing"
+
+func TestParseQuantityToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  float64
+		ok    bool
+	}{
+		{"2", 2, true},
+		{"1.5", 1.5, true},
+		{"1,5", 1.5, true},
+		{".5", 0.5, true},
+		{"1/2", 0.5, true},
+		{"3/4", 0.75, true},
+		{"1/0", 0, false},
+		{"inf", 0, false},
+		{"NaN", 0, false},
+		{"1e3", 0, false},
+		{"-1", 0, false},
+		{"inf/2", 0, false},
+		{"", 0, false},
+		{"a", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseQuantityToken(tt.token)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseQuantityToken(%q) = %v, %v; want %v, %v", tt.token, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseIngredientLine(t *testing.T) {
+	tests := []struct {
+		line        string
+		quantity    float64
+		quantityMax float64
+		unit        string
+		name        string
+		note        string
+	}{
+		{"1,5 kg flour", 1.5, 0, "kg", "flour", ""},
+		{"2 cups sugar, sifted", 2, 0, "cup", "sugar", "sifted"},
+		{"½ tsp salt", 0.5, 0, "tsp", "salt", ""},
+		{"1 1/2 cups milk", 1.5, 0, "cup", "milk", ""},
+		{"2-3 eggs", 2, 3, "", "eggs", ""},
+		{"200g chicken (skinless)", 200, 0, "g", "chicken", "skinless"},
+		{"salt to taste", 0, 0, "", "salt to taste", ""},
+		{"inf g butter", 0, 0, "", "inf g butter", ""},
+		{"nan cups water", 0, 0, "", "nan cups water", ""},
+	}
+
+	for _, tt := range tests {
+		got := parseIngredientLine(tt.line)
+
+		var quantity, quantityMax float64
+		if got.Quantity != nil {
+			quantity = *got.Quantity
+		}
+		if got.QuantityMax != nil {
+			quantityMax = *got.QuantityMax
+		}
+		if quantity != tt.quantity || quantityMax != tt.quantityMax || got.Unit != tt.unit || got.Name != tt.name || got.Note != tt.note {
+			t.Errorf("parseIngredientLine(%q) = %v-%v %q %q (%q); want %v-%v %q %q (%q)", tt.line,
+				quantity, quantityMax, got.Unit, got.Name, got.Note, tt.quantity, tt.quantityMax, tt.unit, tt.name, tt.note)
+		}
+		if tt.quantity == 0 && got.Quantity != nil {
+			t.Errorf("parseIngredientLine(%q) quantity = %v; want none", tt.line, *got.Quantity)
+		}
+	}
+}
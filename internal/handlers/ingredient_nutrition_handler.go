@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	nutritionBasisPer100g = "per_100g"
+	nutritionBasisPerUnit = "per_unit"
+
+	// maxNutrientValue and maxGramsPerUnit bound what the DECIMAL(10, 2) and DECIMAL(10, 3) columns hold
+	maxNutrientValue = 1e8
+	maxGramsPerUnit  = 1e7
+)
+
+type NutritionFacts struct {
+	Kcal    float64 `json:"kcal"`
+	Protein float64 `json:"protein"`
+	Fat     float64 `json:"fat"`
+	Carbs   float64 `json:"carbs"`
+	Fiber   float64 `json:"fiber"`
+	Sugar   float64 `json:"sugar"`
+	Sodium  float64 `json:"sodium"`
+}
+
+type IngredientNutrition struct {
+	IngredientID int      `json:"ingredient_id"`
+	Basis        string   `json:"basis" binding:"required,oneof=per_100g per_unit"`
+	GramsPerUnit *float64 `json:"grams_per_unit"`
+	NutritionFacts
+}
+
+type RecipeNutrition struct {
+	Total                NutritionFacts  `json:"total"`
+	PerServing           *NutritionFacts `json:"per_serving"`
+	Incomplete           bool            `json:"incomplete"`
+	MissingIngredientIDs []int           `json:"missing_ingredient_ids"`
+}
+
+type ingredientNutritionRow struct {
+	IngredientNutrition
+	Unit string
+}
+
+func GetIngredientNutrition(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ingredientID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+			return
+		}
+
+		nutrition, err := loadIngredientNutrition(c, db, []int{ingredientID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredient nutrition"})
+			return
+		}
+
+		row, ok := nutrition[ingredientID]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Nutrition data not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, row.IngredientNutrition)
+	}
+}
+
+func UpsertIngredientNutrition(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ingredientID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+			return
+		}
+
+		var req IngredientNutrition
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.IngredientID = ingredientID
+		if err := validateIngredientNutrition(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var exists bool
+		if err := db.QueryRow(c, `SELECT EXISTS(SELECT 1 FROM ingredients WHERE id = $1)`, ingredientID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredient"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+			return
+		}
+
+		if err := saveIngredientNutrition(c, db, req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save ingredient nutrition"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Ingredient nutrition saved successfully"})
+	}
+}
+
+// nutritionCSVColumns maps normalized CSV headers (lowercase, letters and digits only) to nutrition fields.
+// It accepts our own column names as well as the ones used by USDA FoodData Central exports.
+var nutritionCSVColumns = map[string]string{
+	"ingredientid":              "ingredient_id",
+	"id":                        "ingredient_id",
+	"name":                      "name",
+	"description":               "name",
+	"food":                      "name",
+	"foodname":                  "name",
+	"basis":                     "basis",
+	"gramsperunit":              "grams_per_unit",
+	"gramweight":                "grams_per_unit",
+	"portiongramweight":         "grams_per_unit",
+	"kcal":                      "kcal",
+	"calories":                  "kcal",
+	"energy":                    "kcal",
+	"energykcal":                "kcal",
+	"protein":                   "protein",
+	"proteing":                  "protein",
+	"fat":                       "fat",
+	"fatg":                      "fat",
+	"totalfat":                  "fat",
+	"totallipidfat":             "fat",
+	"totallipidfatg":            "fat",
+	"carbs":                     "carbs",
+	"carbohydrate":              "carbs",
+	"carbohydrates":             "carbs",
+	"carbohydrateg":             "carbs",
+	"carbohydratebydifference":  "carbs",
+	"carbohydratebydifferenceg": "carbs",
+	"fiber":                     "fiber",
+	"fiberg":                    "fiber",
+	"dietaryfiber":              "fiber",
+	"fibertotaldietary":         "fiber",
+	"fibertotaldietaryg":        "fiber",
+	"sugar":                     "sugar",
+	"sugars":                    "sugar",
+	"sugarg":                    "sugar",
+	"sugarstotal":               "sugar",
+	"sugarstotalg":              "sugar",
+	"sugarstotalincludingnlea":  "sugar",
+	"sodium":                    "sodium",
+	"sodiummg":                  "sodium",
+	"sodiumna":                  "sodium",
+	"sodiumnamg":                "sodium",
+}
+
+type nutritionImportIssue struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+func ImportIngredientNutritionCSV(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required"})
+			return
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open CSV file"})
+			return
+		}
+		defer f.Close()
+
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		header, err := reader.Read()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read CSV header"})
+			return
+		}
+
+		columns := make(map[string]int)
+		for i, name := range header {
+			if field, ok := nutritionCSVColumns[normalizeCSVHeader(name)]; ok {
+				if _, seen := columns[field]; !seen {
+					columns[field] = i
+				}
+			}
+		}
+		_, hasID := columns["ingredient_id"]
+		_, hasName := columns["name"]
+		if !hasID && !hasName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CSV must contain an ingredient_id or name column"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		imported := 0
+		unmatched := make([]nutritionImportIssue, 0)
+		failed := make([]nutritionImportIssue, 0)
+
+		for line := 2; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				failed = append(failed, nutritionImportIssue{Line: line, Error: err.Error()})
+				continue
+			}
+
+			field := func(name string) string {
+				if i, ok := columns[name]; ok && i < len(record) {
+					return strings.TrimSpace(record[i])
+				}
+				return ""
+			}
+
+			nutrition, err := parseNutritionCSVRecord(field)
+			if err != nil {
+				failed = append(failed, nutritionImportIssue{Line: line, Name: field("name"), Error: err.Error()})
+				continue
+			}
+
+			ingredientID, err := matchNutritionIngredient(c, tx, field("ingredient_id"), field("name"))
+			if errors.Is(err, pgx.ErrNoRows) {
+				unmatched = append(unmatched, nutritionImportIssue{Line: line, Name: field("name"), Error: "No matching ingredient"})
+				continue
+			}
+			if err != nil {
+				failed = append(failed, nutritionImportIssue{Line: line, Name: field("name"), Error: err.Error()})
+				continue
+			}
+
+			nutrition.IngredientID = ingredientID
+			if err := saveNutritionCSVRow(c, tx, nutrition); err != nil {
+				if pgErrorCode(err) == pgNumericOutOfRange {
+					failed = append(failed, nutritionImportIssue{Line: line, Name: field("name"), Error: "value out of range"})
+					continue
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save ingredient nutrition", "line": line})
+				return
+			}
+			imported++
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"imported":  imported,
+			"unmatched": unmatched,
+			"failed":    failed,
+		})
+	}
+}
+
+func normalizeCSVHeader(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func parseNutritionCSVRecord(field func(string) string) (IngredientNutrition, error) {
+	nutrition := IngredientNutrition{Basis: nutritionBasisPer100g}
+	if basis := field("basis"); basis != "" {
+		if basis != nutritionBasisPer100g && basis != nutritionBasisPerUnit {
+			return nutrition, fmt.Errorf("invalid basis %q", basis)
+		}
+		nutrition.Basis = basis
+	}
+
+	if value := field("grams_per_unit"); value != "" {
+		grams, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nutrition, fmt.Errorf("invalid grams_per_unit %q", value)
+		}
+		nutrition.GramsPerUnit = &grams
+	}
+
+	targets := map[string]*float64{
+		"kcal":    &nutrition.Kcal,
+		"protein": &nutrition.Protein,
+		"fat":     &nutrition.Fat,
+		"carbs":   &nutrition.Carbs,
+		"fiber":   &nutrition.Fiber,
+		"sugar":   &nutrition.Sugar,
+		"sodium":  &nutrition.Sodium,
+	}
+	for name, target := range targets {
+		value := field(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nutrition, fmt.Errorf("invalid %s value %q", name, value)
+		}
+		*target = parsed
+	}
+
+	return nutrition, validateIngredientNutrition(nutrition)
+}
+
+// validateIngredientNutrition checks nutrition from the API or a CSV row before it is saved: values must be
+// finite, not negative and fit their columns, and per-unit data needs the weight of a unit
+func validateIngredientNutrition(nutrition IngredientNutrition) error {
+	if nutrition.GramsPerUnit != nil {
+		grams := *nutrition.GramsPerUnit
+		if !isFiniteNumber(grams) || math.Round(grams*1000) <= 0 || math.Round(grams*1000)/1000 >= maxGramsPerUnit {
+			return fmt.Errorf("grams_per_unit must be at least 0.001 and less than %.0f", float64(maxGramsPerUnit))
+		}
+	}
+	if nutrition.Basis == nutritionBasisPerUnit && nutrition.GramsPerUnit == nil {
+		return errors.New("grams_per_unit is required for the per_unit basis")
+	}
+
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"kcal", nutrition.Kcal},
+		{"protein", nutrition.Protein},
+		{"fat", nutrition.Fat},
+		{"carbs", nutrition.Carbs},
+		{"fiber", nutrition.Fiber},
+		{"sugar", nutrition.Sugar},
+		{"sodium", nutrition.Sodium},
+	}
+	for _, v := range values {
+		if !isFiniteNumber(v.value) || v.value < 0 || math.Round(v.value*100)/100 >= maxNutrientValue {
+			return fmt.Errorf("%s must be at least 0 and less than %.0f", v.name, float64(maxNutrientValue))
+		}
+	}
+	return nil
+}
+
+// isFiniteNumber rejects the inf and nan values strconv.ParseFloat accepts
+func isFiniteNumber(value float64) bool {
+	return !math.IsInf(value, 0) && !math.IsNaN(value)
+}
+
+func matchNutritionIngredient(ctx context.Context, q querier, id, name string) (int, error) {
+	var ingredientID int
+	if id != "" {
+		parsed, err := strconv.Atoi(id)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ingredient_id %q", id)
+		}
+		err = q.QueryRow(ctx, `SELECT id FROM ingredients WHERE id = $1`, parsed).Scan(&ingredientID)
+		return ingredientID, err
+	}
+
+	err := q.QueryRow(ctx, `
+		SELECT id FROM ingredients
+		WHERE LOWER(name) = LOWER($1)
+		ORDER BY id
+		LIMIT 1
+	`, name).Scan(&ingredientID)
+	return ingredientID, err
+}
+
+// saveNutritionCSVRow saves one imported row under a savepoint, so a row the database rejects does not abort the import
+func saveNutritionCSVRow(ctx context.Context, tx pgx.Tx, nutrition IngredientNutrition) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(ctx)
+
+	if err := saveIngredientNutrition(ctx, savepoint, nutrition); err != nil {
+		return err
+	}
+	return savepoint.Commit(ctx)
+}
+
+func saveIngredientNutrition(ctx context.Context, q querier, nutrition IngredientNutrition) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO ingredient_nutrition (ingredient_id, basis, grams_per_unit, kcal, protein, fat, carbs, fiber, sugar, sodium)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (ingredient_id) DO UPDATE SET
+		basis = EXCLUDED.basis, grams_per_unit = EXCLUDED.grams_per_unit, kcal = EXCLUDED.kcal,
+		protein = EXCLUDED.protein, fat = EXCLUDED.fat, carbs = EXCLUDED.carbs,
+		fiber = EXCLUDED.fiber, sugar = EXCLUDED.sugar, sodium = EXCLUDED.sodium
+	`, nutrition.IngredientID, nutrition.Basis, nutrition.GramsPerUnit, nutrition.Kcal, nutrition.Protein,
+		nutrition.Fat, nutrition.Carbs, nutrition.Fiber, nutrition.Sugar, nutrition.Sodium)
+	return err
+}
+
+func loadIngredientNutrition(ctx context.Context, q querier, ingredientIDs []int) (map[int]ingredientNutritionRow, error) {
+	rows, err := q.Query(ctx, `
+		SELECT n.ingredient_id, n.basis, n.grams_per_unit, n.kcal, n.protein, n.fat, n.carbs, n.fiber, n.sugar, n.sodium, i.unit
+		FROM ingredient_nutrition n
+		JOIN ingredients i ON n.ingredient_id = i.id
+		WHERE n.ingredient_id = ANY($1)
+	`, ingredientIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nutrition := make(map[int]ingredientNutritionRow)
+	for rows.Next() {
+		var row ingredientNutritionRow
+		if err := rows.Scan(&row.IngredientID, &row.Basis, &row.GramsPerUnit, &row.Kcal, &row.Protein, &row.Fat,
+			&row.Carbs, &row.Fiber, &row.Sugar, &row.Sodium, &row.Unit); err != nil {
+			return nil, err
+		}
+		nutrition[row.IngredientID] = row
+	}
+	return nutrition, rows.Err()
+}
+
+// nutritionMultiplier returns how many times an ingredient's reference amount (100 g or one unit)
+// is contained in the given recipe quantity, or false when the units cannot be reconciled
+func nutritionMultiplier(quantity float64, unit string, nutrition ingredientNutritionRow) (float64, bool) {
+	inIngredientUnit, sameUnit := convertQuantity(quantity, unit, nutrition.Unit)
+
+	switch nutrition.Basis {
+	case nutritionBasisPerUnit:
+		if !sameUnit {
+			return 0, false
+		}
+		return inIngredientUnit, true
+	case nutritionBasisPer100g:
+		if grams, ok := convertQuantity(quantity, unit, "g"); ok {
+			return grams / 100, true
+		}
+		if sameUnit && nutrition.GramsPerUnit != nil {
+			return inIngredientUnit * *nutrition.GramsPerUnit / 100, true
+		}
+	}
+	return 0, false
+}
+
+func (n *NutritionFacts) add(other NutritionFacts, multiplier float64) {
+	n.Kcal += other.Kcal * multiplier
+	n.Protein += other.Protein * multiplier
+	n.Fat += other.Fat * multiplier
+	n.Carbs += other.Carbs * multiplier
+	n.Fiber += other.Fiber * multiplier
+	n.Sugar += other.Sugar * multiplier
+	n.Sodium += other.Sodium * multiplier
+}
+
+func (n NutritionFacts) rounded() NutritionFacts {
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	return NutritionFacts{
+		Kcal:    round(n.Kcal),
+		Protein: round(n.Protein),
+		Fat:     round(n.Fat),
+		Carbs:   round(n.Carbs),
+		Fiber:   round(n.Fiber),
+		Sugar:   round(n.Sugar),
+		Sodium:  round(n.Sodium),
+	}
+}
+
+// computeRecipeNutrition totals the nutrition of a recipe's ingredients and divides it per serving.
+// Ingredients without nutrition data, or whose quantity cannot be converted, are reported as missing.
+func computeRecipeNutrition(ctx context.Context, q querier, ingredients []RecipeIngredientData, servings int) (*RecipeNutrition, error) {
+	ids := make([]int, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		ids = append(ids, ingredient.IngredientID)
+	}
+
+	nutrition, err := loadIngredientNutrition(ctx, q, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var total NutritionFacts
+	result := &RecipeNutrition{MissingIngredientIDs: make([]int, 0)}
+	for _, ingredient := range ingredients {
+		row, ok := nutrition[ingredient.IngredientID]
+		if !ok {
+			result.MissingIngredientIDs = append(result.MissingIngredientIDs, ingredient.IngredientID)
+			continue
+		}
+		multiplier, ok := nutritionMultiplier(ingredient.Quantity, ingredient.Unit, row)
+		if !ok {
+			result.MissingIngredientIDs = append(result.MissingIngredientIDs, ingredient.IngredientID)
+			continue
+		}
+		total.add(row.NutritionFacts, multiplier)
+	}
+
+	result.Total = total.rounded()
+	result.Incomplete = len(result.MissingIngredientIDs) > 0
+	if servings > 0 {
+		var perServing NutritionFacts
+		perServing.add(total, 1/float64(servings))
+		perServing = perServing.rounded()
+		result.PerServing = &perServing
+	}
+
+	return result, nil
+}
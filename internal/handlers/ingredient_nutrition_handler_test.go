@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidateIngredientNutrition(t *testing.T) {
+	grams := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name      string
+		nutrition IngredientNutrition
+		wantErr   bool
+	}{
+		{"per 100 g", IngredientNutrition{Basis: nutritionBasisPer100g, NutritionFacts: NutritionFacts{Kcal: 52, Carbs: 14}}, false},
+		{"per unit with its weight", IngredientNutrition{Basis: nutritionBasisPerUnit, GramsPerUnit: grams(50)}, false},
+		{"per unit without a weight", IngredientNutrition{Basis: nutritionBasisPerUnit}, true},
+		{"zero weight", IngredientNutrition{Basis: nutritionBasisPerUnit, GramsPerUnit: grams(0.0001)}, true},
+		{"weight beyond the column", IngredientNutrition{Basis: nutritionBasisPer100g, GramsPerUnit: grams(1e7)}, true},
+		{"negative kcal", IngredientNutrition{Basis: nutritionBasisPer100g, NutritionFacts: NutritionFacts{Kcal: -1}}, true},
+		{"sodium beyond the column", IngredientNutrition{Basis: nutritionBasisPer100g, NutritionFacts: NutritionFacts{Sodium: 99999999.996}}, true},
+		{"infinite fat", IngredientNutrition{Basis: nutritionBasisPer100g, NutritionFacts: NutritionFacts{Fat: math.Inf(1)}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := validateIngredientNutrition(tt.nutrition); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateIngredientNutrition error = %v; want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"foocipe-recipe-service/internal/config"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	maxParsedIngredientLines    = 100
+	defaultIngredientCandidates = 3
+	maxIngredientCandidates     = 10
+	// minIngredientCandidateScore keeps weak suggestions out of the candidate list
+	minIngredientCandidateScore = 0.2
+)
+
+type IngredientMatchCandidate struct {
+	ID         int     `json:"id"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	Confidence float64 `json:"confidence"`
+	// Quantity and QuantityMax are the parsed amounts converted to the unit of this ingredient, when possible
+	Quantity    *float64 `json:"quantity,omitempty"`
+	QuantityMax *float64 `json:"quantity_max,omitempty"`
+}
+
+type ParsedIngredientMatch struct {
+	ParsedIngredientLine
+	Matched    bool                       `json:"matched"`
+	Candidates []IngredientMatchCandidate `json:"candidates"`
+}
+
+type ParseIngredientLinesRequest struct {
+	Lines []string `json:"lines" binding:"required"`
+}
+
+// ParseIngredientLines parses free-text ingredient lines and suggests the ingredients each one refers to.
+// Candidates come from the Elasticsearch ingredient index, falling back to the database catalog when search is unavailable.
+func ParseIngredientLines(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ParseIngredientLinesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Lines) == 0 || len(req.Lines) > maxParsedIngredientLines {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Between 1 and %d lines are required", maxParsedIngredientLines)})
+			return
+		}
+
+		limit := defaultIngredientCandidates
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > maxIngredientCandidates {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxIngredientCandidates)})
+				return
+			}
+			limit = parsed
+		}
+
+		source := "search"
+		var catalog []Ingredients
+		results := make([]ParsedIngredientMatch, 0, len(req.Lines))
+		for _, line := range req.Lines {
+			result := ParsedIngredientMatch{ParsedIngredientLine: parseIngredientLine(line), Candidates: []IngredientMatchCandidate{}}
+			if result.Name == "" {
+				results = append(results, result)
+				continue
+			}
+
+			var ingredients []Ingredients
+			if source == "search" {
+				found, err := searchIngredientCandidates(c, result.Name, limit*3)
+				if err != nil {
+					source = "catalog"
+				} else {
+					ingredients = found
+				}
+			}
+			if source == "catalog" {
+				if catalog == nil {
+					loaded, err := loadIngredientCatalog(c, db)
+					if err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load ingredients"})
+						return
+					}
+					catalog = loaded
+				}
+				ingredients = catalog
+			}
+
+			result.Candidates = rankIngredientCandidates(result.ParsedIngredientLine, ingredients, limit)
+			result.Matched = len(result.Candidates) > 0 && result.Candidates[0].Confidence >= minIngredientMatchScore
+			results = append(results, result)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"lines": results, "match_source": source})
+	}
+}
+
+// searchIngredientCandidates asks the ingredient index for names close to name, tolerating typos
+func searchIngredientCandidates(ctx context.Context, name string, size int) ([]Ingredients, error) {
+	esClient := config.GetESClientIngredients()
+	if esClient == nil {
+		return nil, errors.New("ingredient search is not configured")
+	}
+
+	query := map[string]interface{}{
+		"size":    size,
+		"_source": []string{"id", "name", "unit"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []map[string]interface{}{
+					{"match": map[string]interface{}{"name": map[string]interface{}{"query": name, "fuzziness": "AUTO"}}},
+					{"match_phrase": map[string]interface{}{"name": map[string]interface{}{"query": name, "boost": 2}}},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := esClient.Search(
+		esClient.Search.WithContext(ctx),
+		esClient.Search.WithIndex("ingredients"),
+		esClient.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("ingredient search failed: %s", res.Status())
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source Ingredients `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	ingredients := make([]Ingredients, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		ingredients = append(ingredients, hit.Source)
+	}
+	return ingredients, nil
+}
+
+// rankIngredientCandidates scores ingredients against a parsed line and keeps the best few. Search relevance
+// is not comparable between queries, so confidence is always the name similarity used for recipe imports.
+func rankIngredientCandidates(parsed ParsedIngredientLine, ingredients []Ingredients, limit int) []IngredientMatchCandidate {
+	target := normalizeIngredientName(parsed.Name)
+	seen := make(map[int]bool)
+	candidates := []IngredientMatchCandidate{}
+	for _, ingredient := range ingredients {
+		if seen[ingredient.ID] {
+			continue
+		}
+		seen[ingredient.ID] = true
+
+		score := ingredientNameScore(target, ingredient.Name)
+		if score < minIngredientCandidateScore {
+			continue
+		}
+		candidate := IngredientMatchCandidate{
+			ID:         ingredient.ID,
+			Name:       ingredient.Name,
+			Unit:       ingredient.Unit,
+			Confidence: math.Round(score*100) / 100,
+		}
+		candidate.Quantity = convertParsedQuantity(parsed.Quantity, parsed.Unit, ingredient.Unit)
+		candidate.QuantityMax = convertParsedQuantity(parsed.QuantityMax, parsed.Unit, ingredient.Unit)
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// convertParsedQuantity converts a parsed amount to an ingredient's unit; a line without a unit is taken to use it already
+func convertParsedQuantity(quantity *float64, from, to string) *float64 {
+	if quantity == nil {
+		return nil
+	}
+	if from == "" {
+		from = to
+	}
+	converted, ok := convertQuantity(*quantity, from, to)
+	if !ok {
+		return nil
+	}
+	converted = math.Round(converted*1000) / 1000
+	return &converted
+}
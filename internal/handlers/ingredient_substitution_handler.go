@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IngredientSubstitution struct {
+	ID             int      `json:"id"`
+	IngredientID   int      `json:"ingredient_id" binding:"required"`
+	SubstituteID   int      `json:"substitute_id" binding:"required"`
+	Ratio          float64  `json:"ratio"`
+	Notes          string   `json:"notes"`
+	DietReasons    []string `json:"diet_reasons"`
+	SubstituteName string   `json:"substitute_name,omitempty"`
+	SubstituteUnit string   `json:"substitute_unit,omitempty"`
+}
+
+type AdaptedIngredient struct {
+	RecipeIngredientData
+	Substituted            bool   `json:"substituted"`
+	OriginalIngredientID   int    `json:"original_ingredient_id,omitempty"`
+	OriginalIngredientName string `json:"original_ingredient_name,omitempty"`
+	Notes                  string `json:"notes,omitempty"`
+	Unresolved             bool   `json:"unresolved"`
+}
+
+func validateSubstitution(substitution *IngredientSubstitution) error {
+	if substitution.IngredientID == substitution.SubstituteID {
+		return errors.New("an ingredient cannot substitute itself")
+	}
+	if substitution.Ratio == 0 {
+		substitution.Ratio = 1
+	}
+	// ratio is stored as DECIMAL(10, 3), so smaller values would round to 0 and larger ones would not fit
+	if substitution.Ratio < 0.001 || math.Round(substitution.Ratio*1000) >= 1e10 {
+		return errors.New("ratio must be at least 0.001 and less than 10000000")
+	}
+
+	diets, err := normalizeDiets(substitution.DietReasons)
+	if err != nil {
+		return err
+	}
+	substitution.DietReasons = diets
+	return nil
+}
+
+// respondSubstitutionWriteError reports unknown ingredients and duplicate substitutions as client errors
+func respondSubstitutionWriteError(c *gin.Context, err error, fallback string) {
+	switch pgErrorCode(err) {
+	case pgForeignKeyViolation:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ingredient or substitute does not exist"})
+	case pgUniqueViolation:
+		c.JSON(http.StatusConflict, gin.H{"error": "This substitution already exists"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+func CreateSubstitution(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req IngredientSubstitution
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validateSubstitution(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var id int
+		err := db.QueryRow(c, `
+			INSERT INTO ingredient_substitutions (ingredient_id, substitute_id, ratio, notes, diet_reasons)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, req.IngredientID, req.SubstituteID, req.Ratio, req.Notes, req.DietReasons).Scan(&id)
+		if err != nil {
+			respondSubstitutionWriteError(c, err, "Failed to create substitution")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Substitution created successfully"})
+	}
+}
+
+func UpdateSubstitution(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		substitutionID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid substitution ID"})
+			return
+		}
+
+		var req IngredientSubstitution
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validateSubstitution(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := db.Exec(c, `
+			UPDATE ingredient_substitutions SET
+			ingredient_id = $1, substitute_id = $2, ratio = $3, notes = $4, diet_reasons = $5
+			WHERE id = $6
+		`, req.IngredientID, req.SubstituteID, req.Ratio, req.Notes, req.DietReasons, substitutionID)
+		if err != nil {
+			respondSubstitutionWriteError(c, err, "Failed to update substitution")
+			return
+		}
+		if result.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Substitution not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Substitution updated successfully"})
+	}
+}
+
+func DeleteSubstitution(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		substitutionID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid substitution ID"})
+			return
+		}
+
+		result, err := db.Exec(c, `DELETE FROM ingredient_substitutions WHERE id = $1`, substitutionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete substitution"})
+			return
+		}
+		if result.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Substitution not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Substitution deleted successfully"})
+	}
+}
+
+func GetIngredientSubstitutes(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ingredientID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+			return
+		}
+
+		diets, err := parseDietList(c.Query("diet"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		candidates, err := loadSubstitutes(c, db, ingredientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch substitutes"})
+			return
+		}
+
+		substitutes := make([]IngredientSubstitution, 0, len(candidates))
+		for _, candidate := range candidates {
+			if substituteFitsDiets(candidate, diets) {
+				substitutes = append(substitutes, candidate.IngredientSubstitution)
+			}
+		}
+
+		c.JSON(http.StatusOK, substitutes)
+	}
+}
+
+type substituteCandidate struct {
+	IngredientSubstitution
+	Substitute Ingredients
+}
+
+func loadSubstitutes(ctx context.Context, q querier, ingredientID int) ([]substituteCandidate, error) {
+	rows, err := q.Query(ctx, `
+		SELECT s.id, s.ingredient_id, s.substitute_id, s.ratio, COALESCE(s.notes, ''), s.diet_reasons,
+		       i.name, i.unit, i.is_vegetarian, i.is_vegan, i.allergens
+		FROM ingredient_substitutions s
+		JOIN ingredients i ON s.substitute_id = i.id
+		WHERE s.ingredient_id = $1
+		ORDER BY s.id
+	`, ingredientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []substituteCandidate
+	for rows.Next() {
+		var candidate substituteCandidate
+		if err := rows.Scan(&candidate.ID, &candidate.IngredientID, &candidate.SubstituteID, &candidate.Ratio,
+			&candidate.Notes, &candidate.DietReasons, &candidate.SubstituteName, &candidate.SubstituteUnit,
+			&candidate.Substitute.IsVegetarian, &candidate.Substitute.IsVegan, &candidate.Substitute.Allergens); err != nil {
+			return nil, err
+		}
+		candidate.Substitute.ID = candidate.SubstituteID
+		candidate.Substitute.Name = candidate.SubstituteName
+		candidate.Substitute.Unit = candidate.SubstituteUnit
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
+
+func substituteFitsDiets(candidate substituteCandidate, diets []string) bool {
+	for _, diet := range diets {
+		if !ingredientFitsDiet(candidate.Substitute, diet) {
+			return false
+		}
+	}
+	return true
+}
+
+// adaptIngredientsForDiets swaps every ingredient that breaks one of the diets for the substitute that fits
+// all of them, preferring substitutes registered for the diets being broken. Ingredients without a suitable
+// substitute are kept and flagged as unresolved.
+func adaptIngredientsForDiets(ctx context.Context, q querier, ingredients []RecipeIngredientData, diets []string) ([]AdaptedIngredient, error) {
+	ids := make([]int, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		ids = append(ids, ingredient.IngredientID)
+	}
+	attributes, err := loadIngredientsByIDs(ctx, q, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	adapted := make([]AdaptedIngredient, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		original := attributes[ingredient.IngredientID]
+
+		var broken []string
+		for _, diet := range diets {
+			if !ingredientFitsDiet(original, diet) {
+				broken = append(broken, diet)
+			}
+		}
+		if len(broken) == 0 {
+			adapted = append(adapted, AdaptedIngredient{RecipeIngredientData: ingredient})
+			continue
+		}
+
+		candidates, err := loadSubstitutes(ctx, q, ingredient.IngredientID)
+		if err != nil {
+			return nil, err
+		}
+
+		var best *substituteCandidate
+		bestScore := -1
+		for i := range candidates {
+			if !substituteFitsDiets(candidates[i], diets) {
+				continue
+			}
+			score := 0
+			for _, diet := range broken {
+				for _, reason := range candidates[i].DietReasons {
+					if reason == diet {
+						score++
+					}
+				}
+			}
+			if score > bestScore {
+				best, bestScore = &candidates[i], score
+			}
+		}
+
+		if best == nil {
+			adapted = append(adapted, AdaptedIngredient{RecipeIngredientData: ingredient, Unresolved: true})
+			continue
+		}
+
+		// The ratio is expressed in substitute units per unit of the original ingredient
+		quantity, ok := convertQuantity(ingredient.Quantity, ingredient.Unit, original.Unit)
+		if !ok {
+			quantity = ingredient.Quantity
+		}
+		substitute := RecipeIngredientData{
+			IngredientID:   best.SubstituteID,
+			NonScalable:    ingredient.NonScalable,
+			IngredientName: best.SubstituteName,
+		}
+		var unit string
+		quantity, unit = toKitchenUnit(quantity*best.Ratio, best.SubstituteUnit)
+		substitute.Quantity, substitute.DisplayQuantity = roundKitchenQuantity(quantity, unit)
+		substitute.Unit = unit
+
+		adapted = append(adapted, AdaptedIngredient{
+			RecipeIngredientData:   substitute,
+			Substituted:            true,
+			OriginalIngredientID:   ingredient.IngredientID,
+			OriginalIngredientName: ingredient.IngredientName,
+			Notes:                  best.Notes,
+		})
+	}
+
+	return adapted, nil
+}
+
+func loadIngredientsByIDs(ctx context.Context, q querier, ids []int) (map[int]Ingredients, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, name, unit, is_vegetarian, is_vegan, allergens
+		FROM ingredients
+		WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ingredients := make(map[int]Ingredients)
+	for rows.Next() {
+		var ingredient Ingredients
+		if err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Unit, &ingredient.IsVegetarian, &ingredient.IsVegan, &ingredient.Allergens); err != nil {
+			return nil, err
+		}
+		ingredients[ingredient.ID] = ingredient
+	}
+	return ingredients, rows.Err()
+}
+
+// parseDietList splits a comma separated dietary profile such as "vegan,gluten-free"
+func parseDietList(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	return normalizeDiets(strings.Split(value, ","))
+}
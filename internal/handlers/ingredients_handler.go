@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"foocipe-recipe-service/internal/config"
 	"net/http"
@@ -19,6 +20,9 @@ type Ingredients struct {
 	Description   string   `json:"description" binding:"required"`
 	ImageURLs     []string `json:"image_urls"`
 	Unit          string   `json:"unit" binding:"required"`
+	IsVegetarian  bool     `json:"is_vegetarian"`
+	IsVegan       bool     `json:"is_vegan"`
+	Allergens     []string `json:"allergens"`
 }
 
 func CreateIngredient(db *pgxpool.Pool) gin.HandlerFunc {
@@ -29,20 +33,30 @@ func CreateIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		allergens, err := normalizeAllergens(ingredient.Allergens)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ingredient.Allergens = allergens
+
 		// Add the ingredient to PostgreSQL
 		query := `
-			INSERT INTO ingredients (name, category, sub_categories, description, image_urls, unit)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO ingredients (name, category, sub_categories, description, image_urls, unit, is_vegetarian, is_vegan, allergens)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 			RETURNING id
 		`
 		var id int
-		err := db.QueryRow(c, query,
+		err = db.QueryRow(c, query,
 			ingredient.Name,
 			ingredient.Category,
 			ingredient.SubCategories,
 			ingredient.Description,
 			ingredient.ImageURLs,
 			ingredient.Unit,
+			ingredient.IsVegetarian,
+			ingredient.IsVegan,
+			ingredient.Allergens,
 		).Scan(&id)
 
 		if err != nil {
@@ -85,20 +99,30 @@ func CreateListIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 		esClient := config.GetESClientIngredients()
 
 		for _, ingredient := range ingredients {
+			allergens, err := normalizeAllergens(ingredient.Allergens)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			ingredient.Allergens = allergens
+
 			query := `
-				INSERT INTO ingredients (name, category, sub_categories, description, image_urls, unit)
-				VALUES ($1, $2, $3, $4, $5, $6)
+				INSERT INTO ingredients (name, category, sub_categories, description, image_urls, unit, is_vegetarian, is_vegan, allergens)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 				RETURNING id
 			`
 
 			var id int
-			err := db.QueryRow(c, query,
+			err = db.QueryRow(c, query,
 				ingredient.Name,
 				ingredient.Category,
 				ingredient.SubCategories,
 				ingredient.Description,
 				ingredient.ImageURLs,
 				ingredient.Unit,
+				ingredient.IsVegetarian,
+				ingredient.IsVegan,
+				ingredient.Allergens,
 			).Scan(&id)
 
 			if err != nil {
@@ -148,12 +172,20 @@ func UpdateIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		req.Allergens, err = normalizeAllergens(req.Allergens)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		query := `
 			UPDATE ingredients SET
-			name = $1, category = $2, sub_categories = $3, description = $4, image_urls = $5, unit = $6
-			WHERE id = $7
+			name = $1, category = $2, sub_categories = $3, description = $4, image_urls = $5, unit = $6,
+			is_vegetarian = $7, is_vegan = $8, allergens = $9
+			WHERE id = $10
 		`
-		_, err = db.Exec(c, query, req.Name, req.Category, req.SubCategories, req.Description, req.ImageURLs, req.Unit, ingredientID)
+		_, err = db.Exec(c, query, req.Name, req.Category, req.SubCategories, req.Description, req.ImageURLs, req.Unit,
+			req.IsVegetarian, req.IsVegan, req.Allergens, ingredientID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ingredient"})
 			return
@@ -163,16 +195,16 @@ func UpdateIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 	}
 }
 
-func GetIngredientByID(db *pgxpool.Pool, ingredientID int) func(*gin.Context) (Ingredients, error) {
-	return func(c *gin.Context) (Ingredients, error) {
+func GetIngredientByID(db *pgxpool.Pool, ingredientID int) func(context.Context) (Ingredients, error) {
+	return func(ctx context.Context) (Ingredients, error) {
 		var ingredient Ingredients
 		query := `
-			SELECT id, name, category, sub_categories, description, image_urls, unit
+			SELECT id, name, category, sub_categories, description, image_urls, unit, is_vegetarian, is_vegan, allergens
 			FROM ingredients
 			WHERE id = $1
 		`
 
-		err := db.QueryRow(c, query, ingredientID).Scan(
+		err := db.QueryRow(ctx, query, ingredientID).Scan(
 			&ingredient.ID,
 			&ingredient.Name,
 			&ingredient.Category,
@@ -180,6 +212,9 @@ func GetIngredientByID(db *pgxpool.Pool, ingredientID int) func(*gin.Context) (I
 			&ingredient.Description,
 			&ingredient.ImageURLs,
 			&ingredient.Unit,
+			&ingredient.IsVegetarian,
+			&ingredient.IsVegan,
+			&ingredient.Allergens,
 		)
 
 		if err != nil {
@@ -199,8 +234,8 @@ func GINGetIngredientByID(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 
 		var ingredient Ingredients
-		query := `SELECT id, name, category, sub_categories, description, image_urls, unit FROM ingredients WHERE id = $1`
-		err = db.QueryRow(c, query, ingredientID).Scan(&ingredient.ID, &ingredient.Name, &ingredient.Category, &ingredient.SubCategories, &ingredient.Description, &ingredient.ImageURLs, &ingredient.Unit)
+		query := `SELECT id, name, category, sub_categories, description, image_urls, unit, is_vegetarian, is_vegan, allergens FROM ingredients WHERE id = $1`
+		err = db.QueryRow(c, query, ingredientID).Scan(&ingredient.ID, &ingredient.Name, &ingredient.Category, &ingredient.SubCategories, &ingredient.Description, &ingredient.ImageURLs, &ingredient.Unit, &ingredient.IsVegetarian, &ingredient.IsVegan, &ingredient.Allergens)
 
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
@@ -0,0 +1,589 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const mealPlanDateLayout = "2006-01-02"
+
+// mealSlotOrder sorts a day's entries in the order the meals are eaten
+const mealSlotOrder = `CASE e.meal_slot WHEN 'breakfast' THEN 0 WHEN 'lunch' THEN 1 WHEN 'dinner' THEN 2 ELSE 3 END`
+
+type MealPlan struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	Name      string          `json:"name"`
+	WeekStart string          `json:"week_start"`
+	Entries   []MealPlanEntry `json:"entries,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type MealPlanEntry struct {
+	ID         int    `json:"id"`
+	Date       string `json:"date" binding:"required"`
+	MealSlot   string `json:"meal_slot" binding:"required,oneof=breakfast lunch dinner snack"`
+	RecipeID   int    `json:"recipe_id" binding:"required"`
+	RecipeName string `json:"recipe_name"`
+	Servings   int    `json:"servings" binding:"required,min=1"`
+	Note       string `json:"note"`
+}
+
+type MealPlanRequest struct {
+	Name      string `json:"name"`
+	WeekStart string `json:"week_start" binding:"required"`
+}
+
+type MealPlanDaySummary struct {
+	Date                string         `json:"date"`
+	Meals               int            `json:"meals"`
+	PrepTime            int            `json:"prep_time"`
+	CookTime            int            `json:"cook_time"`
+	TotalTime           int            `json:"total_time"`
+	Nutrition           NutritionFacts `json:"nutrition"`
+	NutritionIncomplete bool           `json:"nutrition_incomplete"`
+}
+
+type MealPlanSummary struct {
+	MealPlanID          int                  `json:"meal_plan_id"`
+	WeekStart           string               `json:"week_start"`
+	Days                []MealPlanDaySummary `json:"days"`
+	TotalTime           int                  `json:"total_time"`
+	Nutrition           NutritionFacts       `json:"nutrition"`
+	NutritionIncomplete bool                 `json:"nutrition_incomplete"`
+}
+
+// weekStartOf returns the Monday of the week containing date
+func weekStartOf(date time.Time) time.Time {
+	return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+}
+
+func parseMealPlanDate(value string) (time.Time, error) {
+	date, err := time.Parse(mealPlanDateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return date, nil
+}
+
+func defaultMealPlanName(weekStart time.Time) string {
+	return "Week of " + weekStart.Format(mealPlanDateLayout)
+}
+
+// authorizeMealPlan resolves the :id meal plan of the authenticated user, writing the error response when it cannot
+func authorizeMealPlan(c *gin.Context, db *pgxpool.Pool) (MealPlan, bool) {
+	planID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal plan ID"})
+		return MealPlan{}, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return MealPlan{}, false
+	}
+
+	var plan MealPlan
+	var weekStart time.Time
+	err = db.QueryRow(c, `
+		SELECT id, user_id, name, week_start, created_at, updated_at
+		FROM meal_plans
+		WHERE id = $1 AND user_id = $2
+	`, planID, userID).Scan(&plan.ID, &plan.UserID, &plan.Name, &weekStart, &plan.CreatedAt, &plan.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		return MealPlan{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return MealPlan{}, false
+	}
+	plan.WeekStart = weekStart.Format(mealPlanDateLayout)
+	return plan, true
+}
+
+// validateMealPlanEntry checks that an entry falls inside the plan's week and uses a recipe the user can see
+func validateMealPlanEntry(c *gin.Context, db *pgxpool.Pool, plan MealPlan, entry *MealPlanEntry) (time.Time, bool) {
+	date, err := parseMealPlanDate(entry.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return time.Time{}, false
+	}
+	weekStart, _ := parseMealPlanDate(plan.WeekStart)
+	if date.Before(weekStart) || !date.Before(weekStart.AddDate(0, 0, 7)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Date must fall within the week starting %s", plan.WeekStart)})
+		return time.Time{}, false
+	}
+
+	err = db.QueryRow(c, `SELECT name FROM recipes WHERE id = $1 AND (is_public OR user_id = $2)`, entry.RecipeID, plan.UserID).
+		Scan(&entry.RecipeName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return time.Time{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func loadMealPlanEntries(c *gin.Context, db *pgxpool.Pool, planID int) ([]MealPlanEntry, error) {
+	rows, err := db.Query(c, `
+		SELECT e.id, e.date, e.meal_slot, e.recipe_id, r.name, e.servings, COALESCE(e.note, '')
+		FROM meal_plan_entries e
+		JOIN recipes r ON r.id = e.recipe_id
+		WHERE e.meal_plan_id = $1
+		ORDER BY e.date, `+mealSlotOrder+`, e.id
+	`, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []MealPlanEntry{}
+	for rows.Next() {
+		var entry MealPlanEntry
+		var date time.Time
+		if err := rows.Scan(&entry.ID, &date, &entry.MealSlot, &entry.RecipeID, &entry.RecipeName, &entry.Servings, &entry.Note); err != nil {
+			return nil, err
+		}
+		entry.Date = date.Format(mealPlanDateLayout)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func CreateMealPlan(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var req MealPlanRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		date, err := parseMealPlanDate(req.WeekStart)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		weekStart := weekStartOf(date)
+		if req.Name == "" {
+			req.Name = defaultMealPlanName(weekStart)
+		}
+
+		var id int
+		err = db.QueryRow(c, `
+			INSERT INTO meal_plans (user_id, name, week_start)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, week_start) DO NOTHING
+			RETURNING id
+		`, userID, req.Name, weekStart).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A meal plan already exists for this week"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create meal plan"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "week_start": weekStart.Format(mealPlanDateLayout), "message": "Meal plan created successfully"})
+	}
+}
+
+// ListMealPlans returns the user's plans, optionally limited to weeks starting between ?from and ?to
+func ListMealPlans(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var from, to *time.Time
+		if value := c.Query("from"); value != "" {
+			date, err := parseMealPlanDate(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			from = &date
+		}
+		if value := c.Query("to"); value != "" {
+			date, err := parseMealPlanDate(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			to = &date
+		}
+
+		rows, err := db.Query(c, `
+			SELECT id, user_id, name, week_start, created_at, updated_at
+			FROM meal_plans
+			WHERE user_id = $1
+			  AND ($2::date IS NULL OR week_start >= $2)
+			  AND ($3::date IS NULL OR week_start <= $3)
+			ORDER BY week_start DESC
+		`, userID, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plans"})
+			return
+		}
+		defer rows.Close()
+
+		plans := []MealPlan{}
+		for rows.Next() {
+			var plan MealPlan
+			var weekStart time.Time
+			if err := rows.Scan(&plan.ID, &plan.UserID, &plan.Name, &weekStart, &plan.CreatedAt, &plan.UpdatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan meal plan data"})
+				return
+			}
+			plan.WeekStart = weekStart.Format(mealPlanDateLayout)
+			plans = append(plans, plan)
+		}
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plans"})
+			return
+		}
+
+		c.JSON(http.StatusOK, plans)
+	}
+}
+
+func GetMealPlan(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		entries, err := loadMealPlanEntries(c, db, plan.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan entries"})
+			return
+		}
+		plan.Entries = entries
+
+		c.JSON(http.StatusOK, plan)
+	}
+}
+
+func UpdateMealPlan(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := db.Exec(c, `UPDATE meal_plans SET name = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, req.Name, plan.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update meal plan"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Meal plan updated successfully"})
+	}
+}
+
+func DeleteMealPlan(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		if _, err := db.Exec(c, `DELETE FROM meal_plans WHERE id = $1`, plan.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete meal plan"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Meal plan deleted successfully"})
+	}
+}
+
+func AddMealPlanEntry(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		var entry MealPlanEntry
+		if err := c.ShouldBindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		date, ok := validateMealPlanEntry(c, db, plan, &entry)
+		if !ok {
+			return
+		}
+
+		err := db.QueryRow(c, `
+			INSERT INTO meal_plan_entries (meal_plan_id, date, meal_slot, recipe_id, servings, note)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+			RETURNING id
+		`, plan.ID, date, entry.MealSlot, entry.RecipeID, entry.Servings, entry.Note).Scan(&entry.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add meal plan entry"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+func UpdateMealPlanEntry(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		entryID, err := strconv.Atoi(c.Param("entry_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+			return
+		}
+
+		var entry MealPlanEntry
+		if err := c.ShouldBindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		date, ok := validateMealPlanEntry(c, db, plan, &entry)
+		if !ok {
+			return
+		}
+
+		tag, err := db.Exec(c, `
+			UPDATE meal_plan_entries
+			SET date = $1, meal_slot = $2, recipe_id = $3, servings = $4, note = NULLIF($5, '')
+			WHERE id = $6 AND meal_plan_id = $7
+		`, date, entry.MealSlot, entry.RecipeID, entry.Servings, entry.Note, entryID, plan.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update meal plan entry"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan entry not found"})
+			return
+		}
+
+		entry.ID = entryID
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+func DeleteMealPlanEntry(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		entryID, err := strconv.Atoi(c.Param("entry_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+			return
+		}
+
+		tag, err := db.Exec(c, `DELETE FROM meal_plan_entries WHERE id = $1 AND meal_plan_id = $2`, entryID, plan.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete meal plan entry"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan entry not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Meal plan entry deleted successfully"})
+	}
+}
+
+// CopyMealPlan copies a plan's entries into a new plan for another week, by default the following one.
+// Entries whose recipe the user can no longer see are left out.
+func CopyMealPlan(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Name      string `json:"name"`
+			WeekStart string `json:"week_start"`
+		}
+		if c.Request.Body != http.NoBody {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		source, _ := parseMealPlanDate(plan.WeekStart)
+		target := source.AddDate(0, 0, 7)
+		if req.WeekStart != "" {
+			date, err := parseMealPlanDate(req.WeekStart)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			target = weekStartOf(date)
+		}
+		if target.Equal(source) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target week must differ from the source week"})
+			return
+		}
+		if req.Name == "" {
+			req.Name = defaultMealPlanName(target)
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		var id int
+		err = tx.QueryRow(c, `
+			INSERT INTO meal_plans (user_id, name, week_start)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, week_start) DO NOTHING
+			RETURNING id
+		`, plan.UserID, req.Name, target).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A meal plan already exists for the target week"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create meal plan"})
+			return
+		}
+
+		days := int(target.Sub(source).Hours() / 24)
+		tag, err := tx.Exec(c, `
+			INSERT INTO meal_plan_entries (meal_plan_id, date, meal_slot, recipe_id, servings, note)
+			SELECT $1, e.date + $2::int, e.meal_slot, e.recipe_id, e.servings, e.note
+			FROM meal_plan_entries e
+			JOIN recipes r ON r.id = e.recipe_id
+			WHERE e.meal_plan_id = $3 AND (r.is_public OR r.user_id = $4)
+			ORDER BY e.id
+		`, id, days, plan.ID, plan.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy meal plan entries"})
+			return
+		}
+
+		var total int
+		if err := tx.QueryRow(c, `SELECT COUNT(*) FROM meal_plan_entries WHERE meal_plan_id = $1`, plan.ID).Scan(&total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy meal plan entries"})
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"id":              id,
+			"week_start":      target.Format(mealPlanDateLayout),
+			"copied_entries":  tag.RowsAffected(),
+			"skipped_entries": int64(total) - tag.RowsAffected(),
+			"message":         "Meal plan copied successfully",
+		})
+	}
+}
+
+// GetMealPlanSummary totals preparation time and nutrition for each day of the plan. Nutrition is the
+// recipe's per-serving value times the planned servings, and is flagged incomplete when a recipe lacks data.
+func GetMealPlanSummary(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, ok := authorizeMealPlan(c, db)
+		if !ok {
+			return
+		}
+
+		entries, err := loadMealPlanEntries(c, db, plan.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan entries"})
+			return
+		}
+
+		weekStart, _ := parseMealPlanDate(plan.WeekStart)
+		summary := MealPlanSummary{MealPlanID: plan.ID, WeekStart: plan.WeekStart, Days: make([]MealPlanDaySummary, 7)}
+		for i := range summary.Days {
+			summary.Days[i].Date = weekStart.AddDate(0, 0, i).Format(mealPlanDateLayout)
+		}
+
+		recipes := make(map[int]RecipeRequest)
+		for _, entry := range entries {
+			recipe, cached := recipes[entry.RecipeID]
+			if !cached {
+				recipe, err = fetchRecipe(c, db, entry.RecipeID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+					return
+				}
+				recipe.Nutrition, err = computeRecipeNutrition(c, db, recipe.RecipeIngredientData, recipe.RecipeData.Servings)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute nutrition"})
+					return
+				}
+				recipes[entry.RecipeID] = recipe
+			}
+
+			date, _ := parseMealPlanDate(entry.Date)
+			day := &summary.Days[int(date.Sub(weekStart).Hours()/24)]
+			day.Meals++
+			day.PrepTime += recipe.RecipeData.PrepTime
+			day.CookTime += recipe.RecipeData.CookTime
+			if recipe.Nutrition.PerServing == nil {
+				day.NutritionIncomplete = true
+				continue
+			}
+			day.Nutrition.add(*recipe.Nutrition.PerServing, float64(entry.Servings))
+			day.NutritionIncomplete = day.NutritionIncomplete || recipe.Nutrition.Incomplete
+		}
+
+		var week NutritionFacts
+		for i := range summary.Days {
+			day := &summary.Days[i]
+			day.TotalTime = day.PrepTime + day.CookTime
+			week.add(day.Nutrition, 1)
+			day.Nutrition = day.Nutrition.rounded()
+			summary.TotalTime += day.TotalTime
+			summary.NutritionIncomplete = summary.NutritionIncomplete || day.NutritionIncomplete
+		}
+		summary.Nutrition = week.rounded()
+
+		c.JSON(http.StatusOK, summary)
+	}
+}
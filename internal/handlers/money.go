@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fallbackCurrency is used when DEFAULT_CURRENCY is not set
+const fallbackCurrency = "VND"
+
+// maxMoneyMajorDigits is how many digits the major part of a price can have, as prices are stored as DECIMAL(10, 2)
+const maxMoneyMajorDigits = 8
+
+// currencyExponents lists the supported currencies with their number of decimal places.
+// Prices are stored as DECIMAL(10, 2), so currencies with more than two decimals cannot be supported.
+var currencyExponents = map[string]int{
+	"VND": 0,
+	"JPY": 0,
+	"KRW": 0,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"SGD": 2,
+	"THB": 2,
+	"AUD": 2,
+}
+
+var errInvalidMoney = errors.New("invalid money")
+
+// Money is an exact amount in the minor unit of its currency, e.g. cents for USD and dong for VND.
+// It serializes as {"amount": "12.50", "currency": "USD"} so clients never see binary floating point.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// defaultCurrency returns the DEFAULT_CURRENCY setting, or VND when it is unset or unsupported
+func defaultCurrency() string {
+	currency := strings.ToUpper(strings.TrimSpace(os.Getenv("DEFAULT_CURRENCY")))
+	if _, ok := currencyExponents[currency]; !ok {
+		return fallbackCurrency
+	}
+	return currency
+}
+
+// normalizeCurrency upper-cases a currency code and applies the default to an empty one
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return defaultCurrency(), nil
+	}
+	if _, ok := currencyExponents[currency]; !ok {
+		return "", fmt.Errorf("%w: unsupported currency %q", errInvalidMoney, currency)
+	}
+	return currency, nil
+}
+
+// roundToMinor rounds a major-unit amount to the currency's minor unit, half away from zero.
+// Every conversion from a decimal or a computed amount to Money goes through here. Results beyond
+// the int64 range saturate rather than wrap around.
+func roundToMinor(value *big.Rat, currency string) int64 {
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(pow10(currencyExponents[currency])))
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	// Round half away from zero: |remainder| * 2 >= denominator
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(scaled.Denom()) >= 0 {
+		if scaled.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	if !quotient.IsInt64() {
+		if quotient.Sign() < 0 {
+			return math.MinInt64
+		}
+		return math.MaxInt64
+	}
+	return quotient.Int64()
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+// parseMoney reads a decimal amount such as "12.5" in the given currency (the default when empty)
+func parseMoney(amount, currency string) (Money, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	value, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: amount %q is not a number", errInvalidMoney, amount)
+	}
+	minor := roundToMinor(value, currency)
+	if limit := pow10(maxMoneyMajorDigits + currencyExponents[currency]).Int64(); minor >= limit || minor <= -limit {
+		return Money{}, fmt.Errorf("%w: amount %q must be less than %s", errInvalidMoney, amount, pow10(maxMoneyMajorDigits))
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// moneyFromNumeric converts a DECIMAL column read with pgtype.Numeric to Money in the given currency
+func moneyFromNumeric(n pgtype.Numeric, currency string) (Money, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	value, ok := ratFromNumeric(n)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: amount is not a finite number", errInvalidMoney)
+	}
+	return Money{Amount: roundToMinor(value, currency), Currency: currency}, nil
+}
+
+// ratFromNumeric returns the exact value of a DECIMAL column, or false when it is NULL or not finite
+func ratFromNumeric(n pgtype.Numeric) (*big.Rat, bool) {
+	if !n.Valid || n.NaN || n.InfinityModifier != pgtype.Finite {
+		return nil, false
+	}
+	value := new(big.Rat).SetInt(n.Int)
+	if n.Exp > 0 {
+		value.Mul(value, new(big.Rat).SetInt(pow10(int(n.Exp))))
+	} else if n.Exp < 0 {
+		value.Quo(value, new(big.Rat).SetInt(pow10(int(-n.Exp))))
+	}
+	return value, true
+}
+
+// NumericValue lets Money be passed directly as a DECIMAL query argument
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(m.Amount), Exp: -int32(currencyExponents[m.Currency]), Valid: true}, nil
+}
+
+// String formats the amount in major units with the currency's decimals, e.g. "12.50"
+func (m Money) String() string {
+	exponent := currencyExponents[m.Currency]
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if exponent == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	divisor := pow10(exponent).Int64()
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/divisor, exponent, amount%divisor)
+}
+
+// Mul returns the amount for quantity items
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// Scale multiplies the amount by a factor, rounding the result to the minor unit
+func (m Money) Scale(factor *big.Rat) Money {
+	value := new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(currencyExponents[m.Currency]))
+	return Money{Amount: roundToMinor(value.Mul(value, factor), m.Currency), Currency: m.Currency}
+}
+
+// Add sums two amounts of the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: cannot add %s to %s", errInvalidMoney, other.Currency, m.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub subtracts an amount of the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: cannot subtract %s from %s", errInvalidMoney, other.Currency, m.Currency)
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Less orders amounts by currency first, since amounts in different currencies are not comparable
+func (m Money) Less(other Money) bool {
+	if m.Currency != other.Currency {
+		return m.Currency < other.Currency
+	}
+	return m.Amount < other.Amount
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.Currency == "" {
+		m.Currency = defaultCurrency()
+	}
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.String(), m.Currency})
+}
+
+// UnmarshalJSON accepts {"amount": "12.50", "currency": "USD"}, with the amount as a string or a number,
+// or a bare amount in the default currency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var value moneyJSON
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+	} else {
+		value.Amount = data
+	}
+
+	amount := strings.Trim(string(value.Amount), `"`)
+	if amount == "" {
+		return fmt.Errorf("%w: amount is required", errInvalidMoney)
+	}
+	parsed, err := parseMoney(amount, value.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
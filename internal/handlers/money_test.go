@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"12.5", "usd", Money{Amount: 1250, Currency: "USD"}, false},
+		{"12.345", "USD", Money{Amount: 1235, Currency: "USD"}, false},
+		{"-12.345", "USD", Money{Amount: -1235, Currency: "USD"}, false},
+		{"0.004", "EUR", Money{Amount: 0, Currency: "EUR"}, false},
+		{"1000.5", "VND", Money{Amount: 1001, Currency: "VND"}, false},
+		{" 42 ", "JPY", Money{Amount: 42, Currency: "JPY"}, false},
+		{"99999999.99", "USD", Money{Amount: 9999999999, Currency: "USD"}, false},
+		{"99999999.995", "USD", Money{}, true},
+		{"100000000", "VND", Money{}, true},
+		{"-100000000", "USD", Money{}, true},
+		{"1e30", "USD", Money{}, true},
+		{"abc", "USD", Money{}, true},
+		{"12", "XYZ", Money{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseMoney(tt.amount, tt.currency)
+		if tt.wantErr {
+			if !errors.Is(err, errInvalidMoney) {
+				t.Errorf("parseMoney(%q, %q) error = %v; want errInvalidMoney", tt.amount, tt.currency, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseMoney(%q, %q) = %+v, %v; want %+v", tt.amount, tt.currency, got, err, tt.want)
+		}
+	}
+}
+
+func TestRoundToMinor(t *testing.T) {
+	tests := []struct {
+		value    *big.Rat
+		currency string
+		want     int64
+	}{
+		{big.NewRat(1, 200), "USD", 1},
+		{big.NewRat(-1, 200), "USD", -1},
+		{big.NewRat(1, 300), "USD", 0},
+		{big.NewRat(5, 2), "VND", 3},
+		{new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 80)), "USD", math.MaxInt64},
+		{new(big.Rat).SetInt(new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 80))), "USD", math.MinInt64},
+	}
+
+	for _, tt := range tests {
+		if got := roundToMinor(tt.value, tt.currency); got != tt.want {
+			t.Errorf("roundToMinor(%s, %s) = %d; want %d", tt.value.RatString(), tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := Money{Amount: 1999, Currency: "USD"}
+
+	if got := price.String(); got != "19.99" {
+		t.Errorf("String() = %q; want 19.99", got)
+	}
+	if got := (Money{Amount: -5, Currency: "USD"}).String(); got != "-0.05" {
+		t.Errorf("String() = %q; want -0.05", got)
+	}
+	if got := price.Mul(3); got.Amount != 5997 {
+		t.Errorf("Mul(3) = %d; want 5997", got.Amount)
+	}
+	if got := price.Scale(big.NewRat(1, 10)); got.Amount != 200 {
+		t.Errorf("Scale(1/10) = %d; want 200", got.Amount)
+	}
+	if _, err := price.Add(Money{Amount: 1, Currency: "EUR"}); !errors.Is(err, errInvalidMoney) {
+		t.Errorf("Add across currencies error = %v; want errInvalidMoney", err)
+	}
+	if got, err := price.Sub(Money{Amount: 999, Currency: "USD"}); err != nil || got.Amount != 1000 {
+		t.Errorf("Sub = %+v, %v; want 1000", got, err)
+	}
+}
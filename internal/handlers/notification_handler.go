@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Notification types
+const (
+	notificationCartItemRemoved = "cart_item_removed"
+	notificationOrderCancelled  = "order_cancelled"
+)
+
+// maxNotifications caps how many notifications one listing returns, newest first
+const maxNotifications = 100
+
+type Notification struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type"`
+	Message   string     `json:"message"`
+	ProductID *int       `json:"product_id,omitempty"`
+	OrderID   *int       `json:"order_id,omitempty"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// notifyUsers sends the same notification to each of the users
+func notifyUsers(ctx context.Context, q querier, userIDs []int, notificationType, message string, productID, orderID *int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := q.Exec(ctx, `
+		INSERT INTO notifications (user_id, type, message, product_id, order_id)
+		SELECT unnest($1::int[]), $2, $3, $4, $5
+	`, userIDs, notificationType, message, productID, orderID)
+	return err
+}
+
+// ListNotifications returns the user's latest notifications with the number still unread; ?unread=true leaves out
+// those already read
+func ListNotifications(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+		unreadOnly := c.Query("unread") == "true"
+
+		rows, err := db.Query(c, `
+			SELECT id, type, message, product_id, order_id, read_at, created_at
+			FROM notifications
+			WHERE user_id = $1 AND (read_at IS NULL OR NOT $2)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $3
+		`, userID, unreadOnly, maxNotifications)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+		defer rows.Close()
+
+		notifications := []Notification{}
+		for rows.Next() {
+			var notification Notification
+			if err := rows.Scan(&notification.ID, &notification.Type, &notification.Message, &notification.ProductID,
+				&notification.OrderID, &notification.ReadAt, &notification.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan notification"})
+				return
+			}
+			notifications = append(notifications, notification)
+		}
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+
+		var unread int
+		if err := db.QueryRow(c, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&unread); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread_count": unread})
+	}
+}
+
+func MarkNotificationRead(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		notificationID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+			return
+		}
+
+		tag, err := db.Exec(c, `UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = $1 AND user_id = $2`,
+			notificationID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+	}
+}
+
+func MarkAllNotificationsRead(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		tag, err := db.Exec(c, `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "updated": tag.RowsAffected()})
+	}
+}
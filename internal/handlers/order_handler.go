@@ -0,0 +1,689 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	orderStatusPending   = "pending"
+	orderStatusPlaced    = "placed"
+	orderStatusCancelled = "cancelled"
+	orderStatusExpired   = "expired"
+
+	// defaultReservationTTL is how long a checkout holds stock when CHECKOUT_RESERVATION_TTL is not set
+	defaultReservationTTL = 15 * time.Minute
+
+	// maxOrderMajorDigits is how many digits the major part of an order total can have, as totals are stored as DECIMAL(14, 2)
+	maxOrderMajorDigits = 12
+)
+
+type OrderItem struct {
+	ProductID       int    `json:"product_id"`
+	VariantID       *int   `json:"variant_id,omitempty"`
+	SellerID        int    `json:"seller_id"`
+	Title           string `json:"title"`
+	Quantity        int    `json:"quantity"`
+	UnitPrice       Money  `json:"unit_price"`
+	LineTotal       Money  `json:"line_total"`
+	SalePromotionID *int   `json:"sale_promotion_id,omitempty"`
+}
+
+type Order struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	Status      string `json:"status"`
+	Subtotal    Money  `json:"subtotal"`
+	Discount    Money  `json:"discount"`
+	Total       Money  `json:"total"`
+	PromotionID *int   `json:"promotion_id,omitempty"`
+	// ExpiresAt is when a pending order releases its stock reservations
+	ExpiresAt time.Time   `json:"expires_at"`
+	PlacedAt  *time.Time  `json:"placed_at,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Items     []OrderItem `json:"items"`
+}
+
+type StockShortage struct {
+	ProductID int    `json:"product_id"`
+	VariantID *int   `json:"variant_id,omitempty"`
+	Title     string `json:"title"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+// reservationTTL reads CHECKOUT_RESERVATION_TTL as a Go duration such as "10m"
+func reservationTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("CHECKOUT_RESERVATION_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultReservationTTL
+	}
+	return ttl
+}
+
+// reservedStock is an SQL expression summing the unexpired reservations of the products row named table,
+// not counting reservations of its variants
+func reservedStock(table string) string {
+	return `(SELECT COALESCE(SUM(sr.quantity), 0) FROM stock_reservations sr
+		WHERE sr.product_id = ` + table + `.id AND sr.variant_id IS NULL AND sr.expires_at > CURRENT_TIMESTAMP)`
+}
+
+// reservedVariantStock is an SQL expression summing the unexpired reservations of the product_variants row named table
+func reservedVariantStock(table string) string {
+	return `(SELECT COALESCE(SUM(sr.quantity), 0) FROM stock_reservations sr
+		WHERE sr.variant_id = ` + table + `.id AND sr.expires_at > CURRENT_TIMESTAMP)`
+}
+
+// availableStock is an SQL expression for what the products row named table can still sell: its stock less
+// reservations, or the same summed over its active variants when it has variants
+func availableStock(table string) string {
+	return `(CASE WHEN EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = ` + table + `.id)
+		THEN (SELECT COALESCE(SUM(pv.stock - ` + reservedVariantStock("pv") + `), 0) FROM product_variants pv
+			WHERE pv.product_id = ` + table + `.id AND pv.is_active)
+		ELSE ` + table + `.stock - ` + reservedStock(table) + ` END)`
+}
+
+// orderColumns lists the orders columns in the order scanOrder expects them
+const orderColumns = `id, user_id, status, currency, subtotal, discount, total, promotion_id, expires_at, placed_at, created_at`
+
+func scanOrder(row pgx.Row) (Order, error) {
+	var order Order
+	var currency string
+	var subtotal, discount, total pgtype.Numeric
+	err := row.Scan(&order.ID, &order.UserID, &order.Status, &currency, &subtotal, &discount, &total,
+		&order.PromotionID, &order.ExpiresAt, &order.PlacedAt, &order.CreatedAt)
+	if err != nil {
+		return Order{}, err
+	}
+	if order.Subtotal, err = moneyFromNumeric(subtotal, currency); err != nil {
+		return Order{}, err
+	}
+	if order.Discount, err = moneyFromNumeric(discount, currency); err != nil {
+		return Order{}, err
+	}
+	if order.Total, err = moneyFromNumeric(total, currency); err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+func loadOrderItems(ctx context.Context, q querier, order *Order) error {
+	rows, err := q.Query(ctx, `
+		SELECT product_id, variant_id, seller_id, title, quantity, unit_price, line_total, sale_promotion_id
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY id
+	`, order.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	order.Items = []OrderItem{}
+	for rows.Next() {
+		var item OrderItem
+		var unitPrice, lineTotal pgtype.Numeric
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &item.SellerID, &item.Title, &item.Quantity, &unitPrice, &lineTotal, &item.SalePromotionID); err != nil {
+			return err
+		}
+		if item.UnitPrice, err = moneyFromNumeric(unitPrice, order.Total.Currency); err != nil {
+			return err
+		}
+		if item.LineTotal, err = moneyFromNumeric(lineTotal, order.Total.Currency); err != nil {
+			return err
+		}
+		order.Items = append(order.Items, item)
+	}
+	return rows.Err()
+}
+
+// loadOrder returns one of the user's orders with its items; lock takes the order row FOR UPDATE
+func loadOrder(ctx context.Context, q querier, orderID, userID int, lock bool) (Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1 AND user_id = $2`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	order, err := scanOrder(q.QueryRow(ctx, query, orderID, userID))
+	if err != nil {
+		return Order{}, err
+	}
+	if err := loadOrderItems(ctx, q, &order); err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+// closeOrder moves a pending order to status and releases the stock it reserved
+func closeOrder(ctx context.Context, q querier, orderID int, status string) error {
+	if _, err := q.Exec(ctx, `DELETE FROM stock_reservations WHERE order_id = $1`, orderID); err != nil {
+		return err
+	}
+	_, err := q.Exec(ctx, `UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, status, orderID)
+	return err
+}
+
+// closePendingOrders gives the pending orders matched by where the status and then frees their reservations.
+// The orders are locked first, in id order, as confirming or closing a single order does, so they cannot deadlock.
+func closePendingOrders(ctx context.Context, q querier, status, where string, args ...interface{}) (int64, error) {
+	rows, err := q.Query(ctx, `
+		UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT id FROM orders WHERE status = $2 AND `+where+` ORDER BY id FOR UPDATE)
+		RETURNING id
+	`, append([]interface{}{status, orderStatusPending}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	var orderIDs []int
+	for rows.Next() {
+		var orderID int
+		if err := rows.Scan(&orderID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := q.Exec(ctx, `DELETE FROM stock_reservations WHERE order_id = ANY($1)`, orderIDs); err != nil {
+		return 0, err
+	}
+	return int64(len(orderIDs)), nil
+}
+
+// cancelPendingOrders cancels the user's unfinished checkouts so their reservations do not hold back a new one
+func cancelPendingOrders(ctx context.Context, q querier, userID int) error {
+	_, err := closePendingOrders(ctx, q, orderStatusCancelled, `user_id = $3`, userID)
+	return err
+}
+
+// ReleaseExpiredReservations expires pending orders past their deadline and frees the stock they held.
+// It returns how many orders expired.
+func ReleaseExpiredReservations(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	expired, err := closePendingOrders(ctx, tx, orderStatusExpired, `expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return expired, tx.Commit(ctx)
+}
+
+// BeginCheckout turns the user's cart into a pending order and reserves its stock for CHECKOUT_RESERVATION_TTL.
+// The cart is priced again with its promotions, and products are locked while stock is counted, so two buyers
+// can never reserve the same last unit.
+func BeginCheckout(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Products are locked before orders on every path, as withdrawing a product locks the product and then the
+		// pending orders holding it, so the cart's products and variants are locked before the previous checkout is cancelled
+		_, err = tx.Exec(c, `SELECT id FROM products WHERE id IN (SELECT product_id FROM carts WHERE user_id = $1) ORDER BY id FOR UPDATE`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock products"})
+			return
+		}
+		_, err = tx.Exec(c, `SELECT id FROM product_variants WHERE id IN (SELECT variant_id FROM carts WHERE user_id = $1) ORDER BY id FOR UPDATE`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock products"})
+			return
+		}
+
+		if err := cancelPendingOrders(c, tx, userID.(int)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel previous checkout"})
+			return
+		}
+
+		summary, err := priceCart(c, tx, userID.(int))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch carts"})
+			return
+		}
+		if len(summary.Items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Your cart is empty"})
+			return
+		}
+		blocking := []CartWarning{}
+		for _, warning := range summary.Warnings {
+			if warning.Code == "inactive" || warning.Code == "coupon_invalid" {
+				blocking = append(blocking, warning)
+			}
+		}
+		if len(blocking) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Some items in your cart need attention", "warnings": blocking})
+			return
+		}
+		if len(summary.Totals) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Products in different currencies must be checked out separately"})
+			return
+		}
+
+		// Lines of products with variants take their stock from the variant
+		var lockIDs, productIDs, variantIDs []int
+		for _, item := range summary.Items {
+			lockIDs = append(lockIDs, item.ProductID)
+			if item.VariantID != nil {
+				variantIDs = append(variantIDs, *item.VariantID)
+			} else {
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+		slices.Sort(lockIDs)
+		slices.Sort(variantIDs)
+
+		// Lock products, then variants, each in id order so concurrent checkouts cannot deadlock. They are normally held
+		// already; this catches lines added to the cart meanwhile. Every product is locked, so one withdrawn meanwhile
+		// shows up as unavailable. Stock is counted by separate statements so they see the reservations committed by
+		// checkouts this one waited for.
+		if _, err := tx.Exec(c, `SELECT id FROM products WHERE id = ANY($1) ORDER BY id FOR UPDATE`, lockIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock products"})
+			return
+		}
+		if _, err := tx.Exec(c, `SELECT id FROM product_variants WHERE id = ANY($1) ORDER BY id FOR UPDATE`, variantIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock products"})
+			return
+		}
+		available, err := countAvailable(c, tx, `SELECT p.id, p.stock - `+reservedStock("p")+` FROM products p WHERE p.id = ANY($1) AND p.is_active`, productIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
+			return
+		}
+		availableVariants, err := countAvailable(c, tx, `SELECT v.id, v.stock - `+reservedVariantStock("v")+` FROM product_variants v
+			JOIN products p ON p.id = v.product_id
+			WHERE v.id = ANY($1) AND v.is_active AND p.is_active`, variantIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
+			return
+		}
+
+		shortages := []StockShortage{}
+		for _, item := range summary.Items {
+			stock := available[item.ProductID]
+			if item.VariantID != nil {
+				stock = availableVariants[*item.VariantID]
+			}
+			if stock < item.Quantity {
+				shortages = append(shortages, StockShortage{item.ProductID, item.VariantID, item.displayTitle(), item.Quantity, max(stock, 0)})
+			}
+		}
+		if len(shortages) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock for some items", "shortages": shortages})
+			return
+		}
+
+		subtotal, total := summary.Subtotals[0], summary.Totals[0]
+		if subtotal.Amount >= pow10(maxOrderMajorDigits+currencyExponents[subtotal.Currency]).Int64() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Your cart total is too large for one order, split it into several checkouts"})
+			return
+		}
+		discount := Money{Currency: total.Currency}
+		var promotionID *int
+		if summary.Coupon != nil {
+			discount, promotionID = summary.Coupon.Discount, &summary.Coupon.PromotionID
+		}
+		expiresAt := time.Now().Add(reservationTTL())
+
+		var orderID int
+		err = tx.QueryRow(c, `
+			INSERT INTO orders (user_id, status, currency, subtotal, discount, total, promotion_id, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id
+		`, userID, orderStatusPending, total.Currency, subtotal, discount, total, promotionID, expiresAt).Scan(&orderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+			return
+		}
+
+		for _, item := range summary.Items {
+			unitPrice := item.Price
+			if item.SalePrice != nil {
+				unitPrice = *item.SalePrice
+			}
+			_, err := tx.Exec(c, `
+				INSERT INTO order_items (order_id, product_id, variant_id, seller_id, title, quantity, unit_price, line_total, sale_promotion_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			`, orderID, item.ProductID, item.VariantID, item.SellerID, item.displayTitle(), item.Quantity, unitPrice, item.LineTotal, item.SalePromotionID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order items"})
+				return
+			}
+			_, err = tx.Exec(c, `INSERT INTO stock_reservations (order_id, product_id, variant_id, quantity, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+				orderID, item.ProductID, item.VariantID, item.Quantity, expiresAt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve stock"})
+				return
+			}
+		}
+
+		order, err := loadOrder(c, tx, orderID, userID.(int), false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+// countAvailable runs a query returning (id, available stock) rows for the ids in $1
+func countAvailable(ctx context.Context, q querier, query string, ids []int) (map[int]int, error) {
+	available := make(map[int]int, len(ids))
+	if len(ids) == 0 {
+		return available, nil
+	}
+	rows, err := q.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, stock int
+		if err := rows.Scan(&id, &stock); err != nil {
+			return nil, err
+		}
+		available[id] = stock
+	}
+	return available, rows.Err()
+}
+
+// ConfirmOrder places a pending order: the coupon is checked once more under a lock on the promotion, stock is
+// taken with conditional updates that cannot go below zero, and the ordered products leave the cart.
+func ConfirmOrder(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		orderID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Lock the order's products, then its variants, before the order itself, just as withdrawing a product does
+		_, err = tx.Exec(c, `
+			SELECT id FROM products
+			WHERE id IN (SELECT i.product_id FROM order_items i JOIN orders o ON o.id = i.order_id WHERE o.id = $1 AND o.user_id = $2)
+			ORDER BY id FOR UPDATE
+		`, orderID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock products"})
+			return
+		}
+		_, err = tx.Exec(c, `
+			SELECT id FROM product_variants
+			WHERE id IN (SELECT i.variant_id FROM order_items i JOIN orders o ON o.id = i.order_id WHERE o.id = $1 AND o.user_id = $2)
+			ORDER BY id FOR UPDATE
+		`, orderID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock products"})
+			return
+		}
+
+		order, err := loadOrder(c, tx, orderID, userID.(int), true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+		if order.Status != orderStatusPending {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order is already %s", order.Status)})
+			return
+		}
+		if !time.Now().Before(order.ExpiresAt) {
+			if err := closeOrder(c, tx, order.ID, orderStatusExpired); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire order"})
+				return
+			}
+			if err := tx.Commit(c); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": "Checkout expired, please check out again"})
+			return
+		}
+
+		if order.PromotionID != nil {
+			// Lock the promotion before counting its redemptions so concurrent orders cannot exceed its limits
+			if _, err := tx.Exec(c, `SELECT id FROM promotions WHERE id = $1 FOR UPDATE`, *order.PromotionID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock coupon"})
+				return
+			}
+			coupon, err := scanPromotion(tx.QueryRow(c, `SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, *order.PromotionID))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon"})
+				return
+			}
+			if err := couponUsable(c, tx, userID.(int), coupon); err != nil {
+				if errors.Is(err, errCouponNotApplicable) {
+					c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check coupon"})
+				return
+			}
+			_, err = tx.Exec(c, `INSERT INTO promotion_redemptions (promotion_id, user_id, order_id, discount, currency) VALUES ($1, $2, $3, $4, $5)`,
+				coupon.ID, userID, order.ID, order.Discount, order.Discount.Currency)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem coupon"})
+				return
+			}
+		}
+
+		var productIDs, variantIDs []int
+		for _, item := range order.Items {
+			query, id := `UPDATE products SET stock = stock - $1 WHERE id = $2 AND stock >= $1`, item.ProductID
+			if item.VariantID != nil {
+				query, id = `UPDATE product_variants SET stock = stock - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND stock >= $1`, *item.VariantID
+			}
+			tag, err := tx.Exec(c, query, item.Quantity, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+				return
+			}
+			if tag.RowsAffected() == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is out of stock", item.Title)})
+				return
+			}
+			if item.VariantID != nil {
+				variantIDs = append(variantIDs, *item.VariantID)
+			} else {
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+
+		if _, err := tx.Exec(c, `DELETE FROM stock_reservations WHERE order_id = $1`, order.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release reservations"})
+			return
+		}
+		_, err = tx.Exec(c, `UPDATE orders SET status = $1, placed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			orderStatusPlaced, order.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
+			return
+		}
+		_, err = tx.Exec(c, `DELETE FROM carts WHERE user_id = $1 AND (variant_id = ANY($2) OR (variant_id IS NULL AND product_id = ANY($3)))`,
+			userID, variantIDs, productIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+			return
+		}
+		if _, err := tx.Exec(c, `DELETE FROM cart_coupons WHERE user_id = $1`, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart coupon"})
+			return
+		}
+
+		order, err = loadOrder(c, tx, order.ID, userID.(int), false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// CancelOrder abandons a pending checkout and releases its stock
+func CancelOrder(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		orderID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		order, err := scanOrder(tx.QueryRow(c, `SELECT `+orderColumns+` FROM orders WHERE id = $1 AND user_id = $2 FOR UPDATE`, orderID, userID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+		if order.Status != orderStatusPending {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order is already %s", order.Status)})
+			return
+		}
+
+		if err := closeOrder(c, tx, order.ID, orderStatusCancelled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+			return
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
+	}
+}
+
+func ListOrders(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		rows, err := db.Query(c, `SELECT `+orderColumns+` FROM orders WHERE user_id = $1 ORDER BY created_at DESC, id DESC`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+		orders := []Order{}
+		for rows.Next() {
+			order, err := scanOrder(rows)
+			if err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan order"})
+				return
+			}
+			orders = append(orders, order)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+
+		for i := range orders {
+			if err := loadOrderItems(c, db, &orders[i]); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order items"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+func GetOrder(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		orderID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		order, err := loadOrder(c, db, orderID, userID.(int), false)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultPantryExpiringDays = 3
+	maxPantryExpiringDays     = 60
+)
+
+// pantryQuantityEpsilon absorbs rounding left over after unit conversions when consuming stock
+const pantryQuantityEpsilon = 0.0005
+
+type PantryItem struct {
+	ID             int       `json:"id"`
+	IngredientID   int       `json:"ingredient_id" binding:"required"`
+	IngredientName string    `json:"ingredient_name"`
+	Quantity       float64   `json:"quantity" binding:"gt=0"`
+	Unit           string    `json:"unit"`
+	ExpiresOn      *string   `json:"expires_on"`
+	Expired        bool      `json:"expired"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type PantryUsage struct {
+	IngredientID   int     `json:"ingredient_id"`
+	IngredientName string  `json:"ingredient_name"`
+	Quantity       float64 `json:"quantity"`
+	Unit           string  `json:"unit"`
+}
+
+const pantryItemColumns = `
+	SELECT p.id, p.ingredient_id, i.name, p.quantity, p.unit, p.expires_on, p.created_at, p.updated_at
+	FROM pantry_items p
+	JOIN ingredients i ON i.id = p.ingredient_id
+`
+
+func scanPantryItems(rows pgx.Rows) ([]PantryItem, error) {
+	defer rows.Close()
+
+	today := time.Now().Format(mealPlanDateLayout)
+	items := []PantryItem{}
+	for rows.Next() {
+		var item PantryItem
+		var expiresOn *time.Time
+		if err := rows.Scan(&item.ID, &item.IngredientID, &item.IngredientName, &item.Quantity, &item.Unit,
+			&expiresOn, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if expiresOn != nil {
+			date := expiresOn.Format(mealPlanDateLayout)
+			item.ExpiresOn = &date
+			item.Expired = date < today
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// validatePantryItem checks the ingredient exists and normalizes the unit, defaulting it to the ingredient's
+// own unit. Units that cannot be converted to the ingredient's unit are refused, as the pantry could not be
+// matched against recipes.
+func validatePantryItem(c *gin.Context, db *pgxpool.Pool, item *PantryItem) (*time.Time, bool) {
+	var ingredientUnit string
+	err := db.QueryRow(c, `SELECT name, unit FROM ingredients WHERE id = $1`, item.IngredientID).Scan(&item.IngredientName, &ingredientUnit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredient"})
+		return nil, false
+	}
+
+	if item.Unit == "" {
+		item.Unit = ingredientUnit
+	}
+	item.Unit = normalizeUnit(item.Unit)
+	if _, ok := convertQuantity(1, item.Unit, ingredientUnit); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unit %q cannot be converted to %s", item.Unit, ingredientUnit)})
+		return nil, false
+	}
+
+	if item.ExpiresOn == nil || *item.ExpiresOn == "" {
+		item.ExpiresOn = nil
+		return nil, true
+	}
+	date, err := parseMealPlanDate(*item.ExpiresOn)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &date, true
+}
+
+// pantryIngredientIDs returns the ingredients the user has in stock and not expired
+func pantryIngredientIDs(ctx context.Context, q querier, userID int) ([]int, error) {
+	rows, err := q.Query(ctx, `
+		SELECT DISTINCT ingredient_id
+		FROM pantry_items
+		WHERE user_id = $1 AND quantity > 0 AND (expires_on IS NULL OR expires_on >= CURRENT_DATE)
+		ORDER BY ingredient_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func ListPantryItems(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		rows, err := db.Query(c, pantryItemColumns+`
+			WHERE p.user_id = $1
+			ORDER BY i.name, p.expires_on NULLS LAST, p.id
+		`, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+			return
+		}
+		items, err := scanPantryItems(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan pantry data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// ListExpiringPantryItems returns items expiring within ?days (3 by default), including those already expired
+func ListExpiringPantryItems(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		days := defaultPantryExpiringDays
+		if value := c.Query("days"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 || parsed > maxPantryExpiringDays {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between 0 and %d", maxPantryExpiringDays)})
+				return
+			}
+			days = parsed
+		}
+
+		rows, err := db.Query(c, pantryItemColumns+`
+			WHERE p.user_id = $1 AND p.quantity > 0 AND p.expires_on <= CURRENT_DATE + $2::int
+			ORDER BY p.expires_on, i.name, p.id
+		`, userID, days)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+			return
+		}
+		items, err := scanPantryItems(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan pantry data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"days": days, "items": items})
+	}
+}
+
+func CreatePantryItem(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var item PantryItem
+		if err := c.ShouldBindJSON(&item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresOn, ok := validatePantryItem(c, db, &item)
+		if !ok {
+			return
+		}
+
+		err := db.QueryRow(c, `
+			INSERT INTO pantry_items (user_id, ingredient_id, quantity, unit, expires_on)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at, updated_at
+		`, userID, item.IngredientID, item.Quantity, item.Unit, expiresOn).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pantry item"})
+			return
+		}
+		item.Expired = expiresOn != nil && *item.ExpiresOn < time.Now().Format(mealPlanDateLayout)
+
+		c.JSON(http.StatusCreated, item)
+	}
+}
+
+func UpdatePantryItem(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		itemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pantry item ID"})
+			return
+		}
+
+		var item PantryItem
+		if err := c.ShouldBindJSON(&item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresOn, ok := validatePantryItem(c, db, &item)
+		if !ok {
+			return
+		}
+
+		err = db.QueryRow(c, `
+			UPDATE pantry_items
+			SET ingredient_id = $1, quantity = $2, unit = $3, expires_on = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $5 AND user_id = $6
+			RETURNING id, created_at, updated_at
+		`, item.IngredientID, item.Quantity, item.Unit, expiresOn, itemID, userID).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pantry item not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pantry item"})
+			return
+		}
+		item.Expired = expiresOn != nil && *item.ExpiresOn < time.Now().Format(mealPlanDateLayout)
+
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+func DeletePantryItem(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		itemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pantry item ID"})
+			return
+		}
+
+		tag, err := db.Exec(c, `DELETE FROM pantry_items WHERE id = $1 AND user_id = $2`, itemID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pantry item"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pantry item not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Pantry item deleted successfully"})
+	}
+}
+
+// consumePantryIngredient takes quantity (in unit) of an ingredient out of the user's pantry, using up the
+// items closest to expiry first. Expired items are left alone, as they do not count as stock anywhere else.
+// Emptied items are removed. It returns how much could not be covered.
+func consumePantryIngredient(ctx context.Context, tx pgx.Tx, userID, ingredientID int, quantity float64, unit string) (float64, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id, quantity, unit
+		FROM pantry_items
+		WHERE user_id = $1 AND ingredient_id = $2 AND quantity > 0 AND (expires_on IS NULL OR expires_on >= CURRENT_DATE)
+		ORDER BY expires_on NULLS LAST, id
+		FOR UPDATE
+	`, userID, ingredientID)
+	if err != nil {
+		return 0, err
+	}
+
+	type pantryStock struct {
+		id       int
+		quantity float64
+		unit     string
+	}
+	var stock []pantryStock
+	for rows.Next() {
+		var item pantryStock
+		if err := rows.Scan(&item.id, &item.quantity, &item.unit); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stock = append(stock, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	remaining := quantity
+	for _, item := range stock {
+		if remaining <= pantryQuantityEpsilon {
+			break
+		}
+		needed, ok := convertQuantity(remaining, unit, item.unit)
+		if !ok {
+			continue
+		}
+
+		taken := math.Min(needed, item.quantity)
+		left := item.quantity - taken
+		if left <= pantryQuantityEpsilon {
+			_, err = tx.Exec(ctx, `DELETE FROM pantry_items WHERE id = $1`, item.id)
+		} else {
+			_, err = tx.Exec(ctx, `UPDATE pantry_items SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, left, item.id)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		used, _ := convertQuantity(taken, item.unit, unit)
+		remaining -= used
+	}
+	return math.Max(0, remaining), nil
+}
+
+// MarkRecipeCooked deducts a recipe's ingredients, scaled to the optional servings, from the user's pantry.
+// Ingredients the pantry could not fully cover are reported as missing.
+func MarkRecipeCooked(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipeID, ok := authorizeRecipeView(c, db)
+		if !ok {
+			return
+		}
+		userID := c.MustGet("user_id").(int)
+
+		var req struct {
+			Servings int `json:"servings" binding:"min=0"`
+		}
+		if c.Request.Body != http.NoBody {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		recipe, err := fetchRecipe(c, db, recipeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+			return
+		}
+		factor := 1.0
+		if req.Servings > 0 && recipe.RecipeData.Servings > 0 {
+			factor = float64(req.Servings) / float64(recipe.RecipeData.Servings)
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		used := []PantryUsage{}
+		missing := []PantryUsage{}
+		for _, ingredient := range recipe.RecipeIngredientData {
+			quantity := ingredient.Quantity
+			if !ingredient.NonScalable {
+				quantity *= factor
+			}
+
+			short, err := consumePantryIngredient(c, tx, userID, ingredient.IngredientID, quantity, ingredient.Unit)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pantry"})
+				return
+			}
+
+			usage := PantryUsage{IngredientID: ingredient.IngredientID, IngredientName: ingredient.IngredientName, Unit: ingredient.Unit}
+			if taken := quantity - short; taken > pantryQuantityEpsilon {
+				usage.Quantity = math.Round(taken*1000) / 1000
+				used = append(used, usage)
+			}
+			if short > pantryQuantityEpsilon {
+				usage.Quantity = math.Round(short*1000) / 1000
+				missing = append(missing, usage)
+			}
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recipe_id": recipeID, "used": used, "missing": missing})
+	}
+}
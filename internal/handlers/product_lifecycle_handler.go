@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Product statuses; only published products that are not deleted are active and can be bought
+const (
+	productStatusDraft     = "draft"
+	productStatusPublished = "published"
+	productStatusArchived  = "archived"
+)
+
+// validateProductStatus checks the status and publishing schedule of a product. A product without a status is
+// published when is_active is set and a draft otherwise, as clients sent before statuses existed.
+func validateProductStatus(product *Products) error {
+	if product.Status == "" {
+		product.Status = productStatusDraft
+		if product.IsActive {
+			product.Status = productStatusPublished
+		}
+	}
+	switch product.Status {
+	case productStatusDraft, productStatusPublished, productStatusArchived:
+	default:
+		return fmt.Errorf("%w: status must be draft, published or archived", errInvalidProduct)
+	}
+
+	if product.PublishAt != nil && product.Status == productStatusPublished {
+		return fmt.Errorf("%w: publish_at is only for products that are not published yet", errInvalidProduct)
+	}
+	if product.UnpublishAt != nil && product.Status != productStatusPublished && product.PublishAt == nil {
+		return fmt.Errorf("%w: unpublish_at needs a published product or a publish_at", errInvalidProduct)
+	}
+	if product.PublishAt != nil && product.UnpublishAt != nil && !product.PublishAt.Before(*product.UnpublishAt) {
+		return fmt.Errorf("%w: publish_at must be before unpublish_at", errInvalidProduct)
+	}
+	product.IsActive = product.Status == productStatusPublished
+	return nil
+}
+
+// withdrawProduct handles a product, or only one of its variants when variantID is set, that stopped selling: it
+// leaves every cart, pending checkouts holding it are cancelled to release their stock, and the buyers are notified.
+// The caller must hold the product row locked; checkouts lock products before orders too, so the pending orders can
+// be locked here without deadlocking.
+func withdrawProduct(ctx context.Context, q querier, productID int, variantID *int, title string) error {
+	rows, err := q.Query(ctx, `
+		SELECT o.id, o.user_id
+		FROM orders o
+		WHERE o.status = $2 AND EXISTS (
+			SELECT 1 FROM stock_reservations sr
+			WHERE sr.order_id = o.id AND sr.product_id = $1 AND ($3::int IS NULL OR sr.variant_id = $3)
+		)
+		ORDER BY o.id
+		FOR UPDATE
+	`, productID, orderStatusPending, variantID)
+	if err != nil {
+		return err
+	}
+	type pendingOrder struct{ id, userID int }
+	var orders []pendingOrder
+	for rows.Next() {
+		var order pendingOrder
+		if err := rows.Scan(&order.id, &order.userID); err != nil {
+			rows.Close()
+			return err
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := closeOrder(ctx, q, order.id, orderStatusCancelled); err != nil {
+			return err
+		}
+		message := fmt.Sprintf("Your checkout was cancelled because %s is no longer available", title)
+		if err := notifyUsers(ctx, q, []int{order.userID}, notificationOrderCancelled, message, &productID, &order.id); err != nil {
+			return err
+		}
+	}
+
+	rows, err = q.Query(ctx, `DELETE FROM carts WHERE product_id = $1 AND ($2::int IS NULL OR variant_id = $2) RETURNING user_id`,
+		productID, variantID)
+	if err != nil {
+		return err
+	}
+	seen := make(map[int]bool)
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("%s was removed from your cart because it is no longer available", title)
+	return notifyUsers(ctx, q, userIDs, notificationCartItemRemoved, message, &productID, nil)
+}
+
+// SetProductStatus publishes, unpublishes or archives the seller's product, optionally scheduling the next change
+// with publish_at and unpublish_at. A product that stops selling is withdrawn from carts and pending checkouts.
+func SetProductStatus(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		var req struct {
+			Status      string     `json:"status" binding:"required"`
+			PublishAt   *time.Time `json:"publish_at"`
+			UnpublishAt *time.Time `json:"unpublish_at"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		product := Products{Status: req.Status, PublishAt: req.PublishAt, UnpublishAt: req.UnpublishAt}
+		if err := validateProductStatus(&product); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		var wasActive bool
+		var title string
+		err = tx.QueryRow(c, `SELECT is_active, title FROM products WHERE id = $1 AND seller_id = $2 AND deleted_at IS NULL FOR UPDATE`,
+			productID, userID).Scan(&wasActive, &title)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+			return
+		}
+
+		_, err = tx.Exec(c, `UPDATE products SET status = $1, publish_at = $2, unpublish_at = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4`,
+			product.Status, product.PublishAt, product.UnpublishAt, productID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product status"})
+			return
+		}
+		if wasActive && !product.IsActive {
+			if err := withdrawProduct(c, tx, productID, nil, title); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw product"})
+				return
+			}
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product status updated successfully", "status": product.Status})
+	}
+}
+
+// ApplyProductSchedules publishes products whose publish_at has passed and archives published products whose
+// unpublish_at has passed, withdrawing them from carts and pending checkouts. Each archived product is withdrawn in
+// its own transaction, so one failure does not hold back the rest. It returns how many changed each way.
+func ApplyProductSchedules(ctx context.Context, db *pgxpool.Pool) (int64, int64, error) {
+	tag, err := db.Exec(ctx, `
+		UPDATE products SET status = $1, publish_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE publish_at <= CURRENT_TIMESTAMP AND deleted_at IS NULL
+	`, productStatusPublished)
+	if err != nil {
+		return 0, 0, err
+	}
+	published := tag.RowsAffected()
+
+	rows, err := db.Query(ctx, `
+		SELECT id FROM products
+		WHERE unpublish_at <= CURRENT_TIMESTAMP AND status = $1 AND deleted_at IS NULL
+		ORDER BY id
+	`, productStatusPublished)
+	if err != nil {
+		return published, 0, err
+	}
+	var productIDs []int
+	for rows.Next() {
+		var productID int
+		if err := rows.Scan(&productID); err != nil {
+			rows.Close()
+			return published, 0, err
+		}
+		productIDs = append(productIDs, productID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return published, 0, err
+	}
+
+	var archived int64
+	var errs []error
+	for _, productID := range productIDs {
+		ok, err := archiveScheduledProduct(ctx, db, productID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("product %d: %w", productID, err))
+			continue
+		}
+		if ok {
+			archived++
+		}
+	}
+	return published, archived, errors.Join(errs...)
+}
+
+// archiveScheduledProduct archives a product whose unpublish_at has passed and withdraws it. It reports false when
+// the product changed meanwhile and is no longer due.
+func archiveScheduledProduct(ctx context.Context, db *pgxpool.Pool, productID int) (bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var title string
+	err = tx.QueryRow(ctx, `
+		UPDATE products SET status = $1, unpublish_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND unpublish_at <= CURRENT_TIMESTAMP AND status = $3 AND deleted_at IS NULL
+		RETURNING title
+	`, productStatusArchived, productID, productStatusPublished).Scan(&title)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := withdrawProduct(ctx, tx, productID, nil, title); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
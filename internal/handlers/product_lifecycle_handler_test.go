@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateProductStatus(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		product    Products
+		wantStatus string
+		wantErr    bool
+	}{
+		{"empty status of an inactive product is draft", Products{}, productStatusDraft, false},
+		{"empty status of an active product is published", Products{IsActive: true}, productStatusPublished, false},
+		{"archived", Products{Status: productStatusArchived, IsActive: true}, productStatusArchived, false},
+		{"draft scheduled to publish", Products{Status: productStatusDraft, PublishAt: &now, UnpublishAt: &later}, productStatusDraft, false},
+		{"published scheduled to unpublish", Products{Status: productStatusPublished, UnpublishAt: &later}, productStatusPublished, false},
+		{"unknown status", Products{Status: "hidden"}, "", true},
+		{"publish_at on a published product", Products{Status: productStatusPublished, PublishAt: &later}, "", true},
+		{"unpublish_at without a publication", Products{Status: productStatusDraft, UnpublishAt: &later}, "", true},
+		{"publish_at after unpublish_at", Products{Status: productStatusDraft, PublishAt: &now, UnpublishAt: &earlier}, "", true},
+	}
+
+	for _, tt := range tests {
+		product := tt.product
+		err := validateProductStatus(&product)
+		if tt.wantErr {
+			if !errors.Is(err, errInvalidProduct) {
+				t.Errorf("%s: validateProductStatus error = %v; want errInvalidProduct", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || product.Status != tt.wantStatus {
+			t.Errorf("%s: validateProductStatus = %q, %v; want %q", tt.name, product.Status, err, tt.wantStatus)
+		}
+		if product.IsActive != (tt.wantStatus == productStatusPublished) {
+			t.Errorf("%s: is_active = %v; want it to follow the status %q", tt.name, product.IsActive, tt.wantStatus)
+		}
+	}
+}
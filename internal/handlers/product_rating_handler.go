@@ -1,58 +1,259 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// maxProductRatings caps how many ratings one listing returns, newest first
+const maxProductRatings = 100
+
+// ProductRatingData is a buyer's rating of a product, or the seller's reply to one when ReplyID is set.
+// Replies carry no rating and do not count towards averages.
 type ProductRatingData struct {
-	ID        int     `json:"id"`
-	UserID    int     `json:"user_id"`
-	ProductID int     `json:"product_id"`
-	Rating    float64 `json:"rating"`
-	Comment   string  `json:"comment"`
-	ReplyID   int     `json:"reply_id"`
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ProductID int       `json:"product_id"`
+	Rating    *float64  `json:"rating,omitempty"`
+	Comment   string    `json:"comment"`
+	ReplyID   *int      `json:"reply_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type productRatingRequest struct {
+	ProductID int      `json:"product_id"`
+	Rating    *float64 `json:"rating" binding:"omitempty,min=0,max=5"`
+	Comment   string   `json:"comment"`
 }
 
+// CreateProductRating rates a product on behalf of the authenticated user, once per product. Only buyers with a
+// placed order for the product can rate it, and sellers cannot rate their own products.
 func CreateProductRating(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var ratingData ProductRatingData
-		if err := c.ShouldBindJSON(&ratingData); err != nil {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var req productRatingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// Logic to save ratingData to the database
-		c.JSON(http.StatusCreated, ratingData)
+		if req.ProductID == 0 || req.Rating == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product_id and rating are required"})
+			return
+		}
+
+		var sellerID int
+		var bought bool
+		err := db.QueryRow(c, `
+			SELECT p.seller_id, EXISTS (
+				SELECT 1 FROM orders o
+				JOIN order_items oi ON oi.order_id = o.id
+				WHERE o.user_id = $2 AND o.status = $3 AND oi.product_id = p.id
+			)
+			FROM products p
+			WHERE p.id = $1 AND p.deleted_at IS NULL
+		`, req.ProductID, userID, orderStatusPlaced).Scan(&sellerID, &bought)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+			return
+		}
+		if sellerID == userID.(int) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot rate your own product"})
+			return
+		}
+		if !bought {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only buyers of this product can rate it"})
+			return
+		}
+
+		var id int
+		err = db.QueryRow(c, `INSERT INTO product_rating (user_id, product_id, rating, comment) VALUES ($1, $2, $3, $4) RETURNING id`,
+			userID, req.ProductID, *req.Rating, req.Comment).Scan(&id)
+		if pgErrorCode(err) == pgUniqueViolation {
+			c.JSON(http.StatusConflict, gin.H{"error": "You have already rated this product"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product rating"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Product rating created successfully"})
 	}
 }
 
+// ReplyRating lets the seller of the rated product answer a rating
 func ReplyRating(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"message": "Reply added"})
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		ratingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rating ID"})
+			return
+		}
+
+		var req struct {
+			Comment string `json:"comment" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var id int
+		err = db.QueryRow(c, `
+			INSERT INTO product_rating (user_id, product_id, comment, reply_id)
+			SELECT $1, r.product_id, $2, r.id
+			FROM product_rating r
+			JOIN products p ON p.id = r.product_id
+			WHERE r.id = $3 AND r.reply_id IS NULL AND p.seller_id = $1
+			RETURNING id
+		`, userID, req.Comment, ratingID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rating not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reply to rating"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Reply added"})
 	}
 }
 
+// DeleteProductRating removes the user's own rating or reply; replies to a deleted rating go with it
 func DeleteProductRating(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNoContent, nil)
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		ratingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rating ID"})
+			return
+		}
+
+		tag, err := db.Exec(c, `DELETE FROM product_rating WHERE id = $1 AND user_id = $2`, ratingID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product rating"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rating not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product rating deleted successfully"})
 	}
 }
 
+// UpdateProductRating changes the user's own rating and comment, or the comment of their reply
 func UpdateProductRating(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var ratingData ProductRatingData
-		if err := c.ShouldBindJSON(&ratingData); err != nil {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		ratingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rating ID"})
+			return
+		}
+
+		var req productRatingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, ratingData)
+
+		// A rating keeps a rating and a reply never gets one, so averages only ever count ratings
+		tag, err := db.Exec(c, `
+			UPDATE product_rating SET rating = $1, comment = $2
+			WHERE id = $3 AND user_id = $4 AND (reply_id IS NULL) = ($1::numeric IS NOT NULL)
+		`, req.Rating, req.Comment, ratingID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product rating"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rating not found, or rating given for a reply or missing for a rating"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product rating updated successfully"})
 	}
 }
 
+// GetProductRatingByProductID lists a product's latest ratings and replies with the average of its ratings
 func GetProductRatingByProductID(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"ratings": []ProductRatingData{}})
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		rows, err := db.Query(c, `
+			SELECT id, user_id, product_id, rating::float8, COALESCE(comment, ''), reply_id, created_at
+			FROM product_rating
+			WHERE product_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		`, productID, maxProductRatings)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product ratings"})
+			return
+		}
+		defer rows.Close()
+
+		ratings := []ProductRatingData{}
+		for rows.Next() {
+			var rating ProductRatingData
+			if err := rows.Scan(&rating.ID, &rating.UserID, &rating.ProductID, &rating.Rating, &rating.Comment, &rating.ReplyID,
+				&rating.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan rating data"})
+				return
+			}
+			ratings = append(ratings, rating)
+		}
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product ratings"})
+			return
+		}
+
+		var summary SellerRating
+		err = db.QueryRow(c, `SELECT ROUND(AVG(rating), 2)::float8, COUNT(*) FROM product_rating WHERE product_id = $1 AND reply_id IS NULL`,
+			productID).Scan(&summary.Average, &summary.Count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product ratings"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"ratings": ratings, "average": summary.Average, "count": summary.Count})
 	}
 }
@@ -0,0 +1,630 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	maxProductOptions      = 3
+	maxProductOptionValues = 50
+)
+
+// ProductOption is a dimension a product's variants differ in, such as size or flavor, with its allowed values
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// ProductVariant is one purchasable SKU of a product, with one value for each of the product's options.
+// Its price is in the product's currency.
+type ProductVariant struct {
+	ID        int               `json:"id"`
+	ProductID int               `json:"product_id"`
+	SKU       string            `json:"sku"`
+	Options   map[string]string `json:"options"`
+	Price     Money             `json:"price"`
+	Stock     int               `json:"stock"`
+	// AvailableStock is the stock not held by pending checkouts
+	AvailableStock int      `json:"available_stock"`
+	ImageURLs      []string `json:"image_urls"`
+	// IsActive defaults to true when a variant is created
+	IsActive      *bool    `json:"is_active"`
+	PackQuantity  *float64 `json:"pack_quantity"`
+	PackUnit      string   `json:"pack_unit"`
+	UnitPrice     *Money   `json:"unit_price,omitempty"`
+	UnitPriceUnit string   `json:"unit_price_unit,omitempty"`
+	// SalePrice is the price under the best running automatic promotion, absent when none applies
+	SalePrice       *Money `json:"sale_price,omitempty"`
+	SalePromotionID *int   `json:"sale_promotion_id,omitempty"`
+}
+
+// PriceRange spans the list prices of a product's active variants
+type PriceRange struct {
+	Min Money `json:"min"`
+	Max Money `json:"max"`
+}
+
+var errInvalidVariant = errors.New("invalid variant")
+
+// variantColumns lists the product_variants columns, joined with products as p, in the order scanVariant expects them
+var variantColumns = `v.id, v.product_id, COALESCE(v.sku, ''), v.options, v.price, p.currency, v.stock,
+	v.stock - ` + reservedVariantStock("v") + `, v.image_urls, v.is_active, v.pack_quantity, COALESCE(v.pack_unit, '')`
+
+func scanVariant(row pgx.Row) (ProductVariant, error) {
+	var variant ProductVariant
+	var price pgtype.Numeric
+	var currency string
+	err := row.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &variant.Options, &price, &currency, &variant.Stock,
+		&variant.AvailableStock, &variant.ImageURLs, &variant.IsActive, &variant.PackQuantity, &variant.PackUnit)
+	if err != nil {
+		return ProductVariant{}, err
+	}
+	if variant.Price, err = moneyFromNumeric(price, currency); err != nil {
+		return ProductVariant{}, err
+	}
+	variant.UnitPrice, variant.UnitPriceUnit = productUnitPrice(variant.Price, variant.PackQuantity, variant.PackUnit)
+	return variant, nil
+}
+
+// loadProductOptions returns a product's options in the order they were defined
+func loadProductOptions(ctx context.Context, q querier, productID int) ([]ProductOption, error) {
+	rows, err := q.Query(ctx, `SELECT name, option_values FROM product_options WHERE product_id = $1 ORDER BY position`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []ProductOption{}
+	for rows.Next() {
+		var option ProductOption
+		if err := rows.Scan(&option.Name, &option.Values); err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	return options, rows.Err()
+}
+
+// loadProductVariants returns a product's variants, only the active ones when activeOnly is set
+func loadProductVariants(ctx context.Context, q querier, productID int, activeOnly bool) ([]ProductVariant, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+variantColumns+`
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.product_id = $1 AND (v.is_active OR NOT $2)
+		ORDER BY v.id
+	`, productID, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []ProductVariant{}
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+// applyVariantSales sets the sale price of each variant from the running automatic promotions of its product
+func applyVariantSales(ctx context.Context, q querier, product Products, variants []ProductVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	sales, err := loadActiveSales(ctx, q)
+	if err != nil || len(sales) == 0 {
+		return err
+	}
+	categories, err := loadProductCategories(ctx, q, []int{product.ID})
+	if err != nil {
+		return err
+	}
+	for i := range variants {
+		variant := &variants[i]
+		variant.SalePrice, variant.SalePromotionID = bestSalePrice(sales, promotionTarget{
+			ProductID: product.ID,
+			SellerID:  product.SellerID,
+			Category:  categories[product.ID],
+			Price:     variant.Price,
+		})
+	}
+	return nil
+}
+
+// applyVariantPriceRanges sets the price range of the products that have active variants.
+// It runs after applyProductSales.
+func applyVariantPriceRanges(ctx context.Context, q querier, products []Products) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT v.product_id, MIN(v.price), MAX(v.price)
+		FROM product_variants v
+		WHERE v.product_id = ANY($1) AND v.is_active
+		GROUP BY v.product_id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type bounds struct{ min, max pgtype.Numeric }
+	ranges := make(map[int]bounds)
+	for rows.Next() {
+		var productID int
+		var b bounds
+		if err := rows.Scan(&productID, &b.min, &b.max); err != nil {
+			return err
+		}
+		ranges[productID] = b
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range products {
+		product := &products[i]
+		b, ok := ranges[product.ID]
+		if !ok {
+			continue
+		}
+		var priceRange PriceRange
+		if priceRange.Min, err = moneyFromNumeric(b.min, product.Price.Currency); err != nil {
+			return err
+		}
+		if priceRange.Max, err = moneyFromNumeric(b.max, product.Price.Currency); err != nil {
+			return err
+		}
+		product.PriceRange = &priceRange
+		// Sales apply to the variant prices, so a sale price computed from the product's own price means nothing
+		product.SalePrice, product.SalePromotionID = nil, nil
+	}
+	return nil
+}
+
+// variantLabel describes a variant by its option values, e.g. "flavor: dark, size: 500 g"
+func variantLabel(options map[string]string) string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + options[name]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validateProductOptions trims option names and values and requires them to be present and unique
+func validateProductOptions(options []ProductOption) error {
+	if len(options) > maxProductOptions {
+		return fmt.Errorf("%w: a product can have at most %d options", errInvalidVariant, maxProductOptions)
+	}
+	names := make(map[string]bool, len(options))
+	for i := range options {
+		option := &options[i]
+		option.Name = strings.TrimSpace(option.Name)
+		if option.Name == "" {
+			return fmt.Errorf("%w: option name is required", errInvalidVariant)
+		}
+		if names[strings.ToLower(option.Name)] {
+			return fmt.Errorf("%w: option %q is listed twice", errInvalidVariant, option.Name)
+		}
+		names[strings.ToLower(option.Name)] = true
+
+		if len(option.Values) == 0 || len(option.Values) > maxProductOptionValues {
+			return fmt.Errorf("%w: option %q needs between 1 and %d values", errInvalidVariant, option.Name, maxProductOptionValues)
+		}
+		values := make(map[string]bool, len(option.Values))
+		for j, value := range option.Values {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return fmt.Errorf("%w: option %q has an empty value", errInvalidVariant, option.Name)
+			}
+			if values[value] {
+				return fmt.Errorf("%w: option %q lists %q twice", errInvalidVariant, option.Name, value)
+			}
+			values[value] = true
+			option.Values[j] = value
+		}
+	}
+	return nil
+}
+
+// variantFitsOptions requires exactly one allowed value for each of the product's options
+func variantFitsOptions(values map[string]string, options []ProductOption) error {
+	if len(values) != len(options) {
+		return fmt.Errorf("%w: a value is required for each option and nothing else", errInvalidVariant)
+	}
+	for _, option := range options {
+		value, ok := values[option.Name]
+		if !ok {
+			return fmt.Errorf("%w: a value for %q is required", errInvalidVariant, option.Name)
+		}
+		found := false
+		for _, allowed := range option.Values {
+			if value == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %q is not a value of %q", errInvalidVariant, value, option.Name)
+		}
+	}
+	return nil
+}
+
+// validateVariant checks a variant against its product: its options, price currency, stock and pack.
+// An invalid pack returns errInvalidProduct like the product's own.
+func validateVariant(ctx context.Context, q querier, product Products, options []ProductOption, variant *ProductVariant) error {
+	if len(options) == 0 {
+		return fmt.Errorf("%w: define the product options before adding variants", errInvalidVariant)
+	}
+	for name, value := range variant.Options {
+		variant.Options[name] = strings.TrimSpace(value)
+	}
+	if err := variantFitsOptions(variant.Options, options); err != nil {
+		return err
+	}
+	if variant.Price.Currency == "" {
+		return fmt.Errorf("%w: price is required", errInvalidVariant)
+	}
+	if variant.Price.Currency != product.Price.Currency {
+		return fmt.Errorf("%w: price must be in the product currency %s", errInvalidVariant, product.Price.Currency)
+	}
+	if variant.Price.Amount < 0 {
+		return fmt.Errorf("%w: price must not be negative", errInvalidVariant)
+	}
+	if variant.Stock < 0 {
+		return fmt.Errorf("%w: stock must not be negative", errInvalidVariant)
+	}
+	variant.SKU = strings.TrimSpace(variant.SKU)
+	if variant.IsActive == nil {
+		active := true
+		variant.IsActive = &active
+	}
+
+	// The pack is validated like the product's, against the ingredient it is linked to
+	pack := Products{IngredientID: product.IngredientID, PackQuantity: variant.PackQuantity, PackUnit: variant.PackUnit}
+	if err := validateProductPack(ctx, q, &pack); err != nil {
+		return err
+	}
+	variant.PackUnit = pack.PackUnit
+	return nil
+}
+
+// authorizeVariantProduct resolves the :id product, which must belong to the authenticated seller, writing the error
+// response when it cannot
+func authorizeVariantProduct(c *gin.Context, db *pgxpool.Pool) (Products, bool) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return Products{}, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return Products{}, false
+	}
+
+	product, err := scanProduct(db.QueryRow(c, `SELECT `+productColumns+` FROM products WHERE id = $1 AND seller_id = $2 AND deleted_at IS NULL`, productID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return Products{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return Products{}, false
+	}
+	return product, true
+}
+
+// GetProductVariants returns a product's options and variants with their sale prices.
+// The seller of the product also sees inactive variants.
+func GetProductVariants(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, err := scanProduct(db.QueryRow(c, `SELECT `+productColumns+` FROM products WHERE id = $1 AND deleted_at IS NULL`, c.Param("id")))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+		owner := userID == product.SellerID
+		if !product.IsActive && !owner {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		options, err := loadProductOptions(c, db, product.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product options"})
+			return
+		}
+		variants, err := loadProductVariants(c, db, product.ID, !owner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product variants"})
+			return
+		}
+		if err := applyVariantSales(c, db, product, variants); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply promotions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"options": options, "variants": variants})
+	}
+}
+
+// SetProductOptions replaces the option set of the seller's product. Existing variants must still fit the new options.
+func SetProductOptions(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, ok := authorizeVariantProduct(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Options []ProductOption `json:"options"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateProductOptions(req.Options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Lock the product so variants cannot be added while the options change
+		if _, err := tx.Exec(c, `SELECT id FROM products WHERE id = $1 FOR UPDATE`, product.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock product"})
+			return
+		}
+		variants, err := loadProductVariants(c, tx, product.ID, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product variants"})
+			return
+		}
+		for _, variant := range variants {
+			if err := variantFitsOptions(variant.Options, req.Options); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Variant %d (%s) does not fit the new options: %s",
+					variant.ID, variantLabel(variant.Options), err)})
+				return
+			}
+		}
+
+		if _, err := tx.Exec(c, `DELETE FROM product_options WHERE product_id = $1`, product.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product options"})
+			return
+		}
+		for i, option := range req.Options {
+			_, err := tx.Exec(c, `INSERT INTO product_options (product_id, name, option_values, position) VALUES ($1, $2, $3, $4)`,
+				product.ID, option.Name, option.Values, i)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product options"})
+				return
+			}
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		if req.Options == nil {
+			req.Options = []ProductOption{}
+		}
+		c.JSON(http.StatusOK, gin.H{"options": req.Options})
+	}
+}
+
+// bindVariant reads and validates a variant of the seller's product, writing the error response when it is invalid
+func bindVariant(c *gin.Context, tx pgx.Tx, product Products) (ProductVariant, bool) {
+	var variant ProductVariant
+	if err := c.ShouldBindJSON(&variant); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return ProductVariant{}, false
+	}
+
+	// Lock the product so its options cannot change between validating the variant and saving it
+	if _, err := tx.Exec(c, `SELECT id FROM products WHERE id = $1 FOR UPDATE`, product.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock product"})
+		return ProductVariant{}, false
+	}
+	options, err := loadProductOptions(c, tx, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product options"})
+		return ProductVariant{}, false
+	}
+	if err := validateVariant(c, tx, product, options, &variant); err != nil {
+		if errors.Is(err, errInvalidVariant) || errors.Is(err, errInvalidProduct) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return ProductVariant{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate variant"})
+		return ProductVariant{}, false
+	}
+	return variant, true
+}
+
+func CreateProductVariant(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, ok := authorizeVariantProduct(c, db)
+		if !ok {
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		variant, ok := bindVariant(c, tx, product)
+		if !ok {
+			return
+		}
+
+		var id int
+		err = tx.QueryRow(c, `
+			INSERT INTO product_variants (product_id, sku, options, price, stock, image_urls, is_active, pack_quantity, pack_unit)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+			ON CONFLICT (product_id, options) DO NOTHING
+			RETURNING id
+		`, product.ID, variant.SKU, variant.Options, variant.Price, variant.Stock, variant.ImageURLs, *variant.IsActive,
+			variant.PackQuantity, variant.PackUnit).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A variant with these options already exists"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+			return
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Variant created successfully"})
+	}
+}
+
+func UpdateProductVariant(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, ok := authorizeVariantProduct(c, db)
+		if !ok {
+			return
+		}
+		variantID, err := strconv.Atoi(c.Param("variant_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		variant, ok := bindVariant(c, tx, product)
+		if !ok {
+			return
+		}
+
+		tag, err := tx.Exec(c, `
+			UPDATE product_variants
+			SET sku = NULLIF($1, ''), options = $2, price = $3, stock = $4, image_urls = $5, is_active = $6,
+			    pack_quantity = $7, pack_unit = NULLIF($8, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = $9 AND product_id = $10
+		`, variant.SKU, variant.Options, variant.Price, variant.Stock, variant.ImageURLs, *variant.IsActive,
+			variant.PackQuantity, variant.PackUnit, variantID, product.ID)
+		if pgErrorCode(err) == pgUniqueViolation {
+			c.JSON(http.StatusConflict, gin.H{"error": "A variant with these options already exists"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Variant updated successfully"})
+	}
+}
+
+// DeleteProductVariant deletes a variant once the pending checkouts holding it are cancelled and it has left every
+// cart, notifying the buyers as for a withdrawn product
+func DeleteProductVariant(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, ok := authorizeVariantProduct(c, db)
+		if !ok {
+			return
+		}
+		variantID, err := strconv.Atoi(c.Param("variant_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Lock the product, then the variant, as checkouts do, so no checkout can reserve the variant meanwhile
+		if _, err := tx.Exec(c, `SELECT id FROM products WHERE id = $1 FOR UPDATE`, product.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock product"})
+			return
+		}
+		var options map[string]string
+		err = tx.QueryRow(c, `SELECT options FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE`,
+			variantID, product.ID).Scan(&options)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch variant"})
+			return
+		}
+
+		// Cancel the pending checkouts holding the variant and take it out of carts before the delete cascades
+		if err := withdrawProduct(c, tx, product.ID, &variantID, product.Title+" ("+variantLabel(options)+")"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw variant"})
+			return
+		}
+		if _, err := tx.Exec(c, `DELETE FROM product_variants WHERE id = $1`, variantID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete variant"})
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+	}
+}
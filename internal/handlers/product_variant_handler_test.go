@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVariantFitsOptions(t *testing.T) {
+	options := []ProductOption{
+		{Name: "size", Values: []string{"S", "M", "L"}},
+		{Name: "color", Values: []string{"red", "blue"}},
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr bool
+	}{
+		{"one allowed value per option", map[string]string{"size": "M", "color": "red"}, false},
+		{"missing option", map[string]string{"size": "M"}, true},
+		{"unknown option", map[string]string{"size": "M", "flavor": "red"}, true},
+		{"extra option", map[string]string{"size": "M", "color": "red", "flavor": "mint"}, true},
+		{"value not allowed", map[string]string{"size": "XL", "color": "red"}, true},
+		{"values are case-sensitive", map[string]string{"size": "m", "color": "red"}, true},
+	}
+
+	for _, tt := range tests {
+		err := variantFitsOptions(tt.values, options)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: variantFitsOptions error = %v; want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, errInvalidVariant) {
+			t.Errorf("%s: variantFitsOptions error = %v; want errInvalidVariant", tt.name, err)
+		}
+	}
+
+	if err := variantFitsOptions(map[string]string{}, nil); err != nil {
+		t.Errorf("variantFitsOptions without options = %v; want nil", err)
+	}
+}
@@ -4,26 +4,220 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"foocipe-recipe-service/internal/config"
+	"math/big"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const (
+	defaultNewestProducts = 20
+	maxNewestProducts     = 100
+)
+
 type Products struct {
-	ID           int      `json:"id"`
-	SellerID     int      `json:"seller_id"`
-	RecipeID     int      `json:"recipe_id"`
-	ToolID       int      `json:"tool_id"`
-	IngredientID int      `json:"ingredient_id"`
-	Title        string   `json:"title"`
-	Description  string   `json:"description"`
-	Price        int      `json:"price"`
-	Stock        int      `json:"stock"`
-	ImageURLs    []string `json:"image_urls"`
-	IsActive     bool     `json:"is_active"`
+	ID           int    `json:"id"`
+	SellerID     int    `json:"seller_id"`
+	RecipeID     *int   `json:"recipe_id"`
+	ToolID       *int   `json:"tool_id"`
+	IngredientID *int   `json:"ingredient_id"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Price        Money  `json:"price"`
+	Stock        int    `json:"stock"`
+	// AvailableStock is the stock not held by pending checkouts, summed over the active variants of a product with variants
+	AvailableStock int      `json:"available_stock"`
+	ImageURLs      []string `json:"image_urls"`
+	// IsActive is set for published products that can be bought; Status replaces it when creating or updating
+	IsActive bool   `json:"is_active"`
+	Status   string `json:"status"`
+	// PublishAt and UnpublishAt schedule the next status change, applied by a background job
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	// PackQuantity and PackUnit describe what one product contains, e.g. 500 g of rice
+	PackQuantity *float64 `json:"pack_quantity"`
+	PackUnit     string   `json:"pack_unit"`
+	// UnitPrice is the price per kg, per l or per item of the pack, so products of different sizes compare
+	UnitPrice     *Money `json:"unit_price,omitempty"`
+	UnitPriceUnit string `json:"unit_price_unit,omitempty"`
+	// SalePrice is the price under the best running automatic promotion, absent when none applies
+	SalePrice       *Money `json:"sale_price,omitempty"`
+	SalePromotionID *int   `json:"sale_promotion_id,omitempty"`
+	// PriceRange is set for products sold through variants, whose prices replace the product's own
+	PriceRange *PriceRange      `json:"price_range,omitempty"`
+	Options    []ProductOption  `json:"options,omitempty"`
+	Variants   []ProductVariant `json:"variants,omitempty"`
+}
+
+// effectivePrice is what the product sells for right now: its sale price when it has one, or the lowest
+// variant price for a product with variants
+func (p Products) effectivePrice() Money {
+	if p.PriceRange != nil {
+		return p.PriceRange.Min
+	}
+	if p.SalePrice != nil {
+		return *p.SalePrice
+	}
+	return p.Price
+}
+
+// productColumns lists the products columns in the order scanProduct expects them
+var productColumns = `id, seller_id, ingredient_id, tool_id, recipe_id, title, COALESCE(description, ''), price, currency, stock,
+	` + availableStock("products") + `, image_urls, is_active, pack_quantity, COALESCE(pack_unit, ''),
+	status, publish_at, unpublish_at`
+
+func scanProduct(row pgx.Row) (Products, error) {
+	var product Products
+	var price pgtype.Numeric
+	var currency string
+	err := row.Scan(&product.ID, &product.SellerID, &product.IngredientID, &product.ToolID, &product.RecipeID,
+		&product.Title, &product.Description, &price, &currency, &product.Stock, &product.AvailableStock, &product.ImageURLs, &product.IsActive,
+		&product.PackQuantity, &product.PackUnit, &product.Status, &product.PublishAt, &product.UnpublishAt)
+	if err != nil {
+		return Products{}, err
+	}
+	if product.Price, err = moneyFromNumeric(price, currency); err != nil {
+		return Products{}, err
+	}
+	product.UnitPrice, product.UnitPriceUnit = productUnitPrice(product.Price, product.PackQuantity, product.PackUnit)
+	return product, nil
+}
+
+func scanProducts(rows pgx.Rows) ([]Products, error) {
+	defer rows.Close()
+
+	products := []Products{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// productUnitPrice returns the price per kg (mass), per l (volume) or per pack unit (counted items)
+func productUnitPrice(price Money, packQuantity *float64, packUnit string) (*Money, string) {
+	if packQuantity == nil || *packQuantity <= 0 || packUnit == "" {
+		return nil, ""
+	}
+
+	unit := packUnit
+	switch unitDimension(packUnit) {
+	case unitDimensionMass:
+		unit = "kg"
+	case unitDimensionVolume:
+		unit = "l"
+	}
+	quantity, ok := convertQuantity(*packQuantity, packUnit, unit)
+	if !ok || quantity <= 0 {
+		return nil, ""
+	}
+	unitPrice := price.Scale(new(big.Rat).Inv(new(big.Rat).SetFloat64(quantity)))
+	return &unitPrice, unit
+}
+
+var errInvalidProduct = errors.New("invalid product")
+
+// validateProductPrice requires a price that is not negative; its currency was checked when the JSON was read
+func validateProductPrice(product *Products) error {
+	if product.Price.Currency == "" {
+		return fmt.Errorf("%w: price is required", errInvalidProduct)
+	}
+	if product.Price.Amount < 0 {
+		return fmt.Errorf("%w: price must not be negative", errInvalidProduct)
+	}
+	return nil
+}
+
+// validateProductPack normalizes the pack unit and, for ingredient products, requires it to convert to
+// the ingredient's unit so recipe quantities can be translated into a number of packs
+func validateProductPack(ctx context.Context, q querier, product *Products) error {
+	if product.PackQuantity == nil {
+		product.PackUnit = ""
+		return nil
+	}
+	if *product.PackQuantity <= 0 {
+		return fmt.Errorf("%w: pack_quantity must be positive", errInvalidProduct)
+	}
+	if product.IngredientID == nil {
+		if product.PackUnit == "" {
+			return fmt.Errorf("%w: pack_unit is required with pack_quantity", errInvalidProduct)
+		}
+		product.PackUnit = normalizeUnit(product.PackUnit)
+		return nil
+	}
+
+	var ingredientUnit string
+	if err := q.QueryRow(ctx, `SELECT unit FROM ingredients WHERE id = $1`, *product.IngredientID).Scan(&ingredientUnit); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: ingredient not found", errInvalidProduct)
+		}
+		return err
+	}
+	if product.PackUnit == "" {
+		product.PackUnit = ingredientUnit
+	}
+	product.PackUnit = normalizeUnit(product.PackUnit)
+	if _, ok := convertQuantity(1, product.PackUnit, ingredientUnit); !ok {
+		return fmt.Errorf("%w: pack_unit %q cannot be converted to the ingredient unit %s", errInvalidProduct, product.PackUnit, ingredientUnit)
+	}
+	return nil
+}
+
+// checkProduct validates the price, status and pack of a product, writing the error response when they are invalid
+func checkProduct(c *gin.Context, q querier, product *Products) bool {
+	err := validateProductPrice(product)
+	if err == nil {
+		err = validateProductStatus(product)
+	}
+	if err == nil {
+		err = validateProductPack(c, q, product)
+	}
+	if errors.Is(err, errInvalidProduct) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate product"})
+		return false
+	}
+	return true
+}
+
+// sortProducts applies the ?sort query of product listings: price (after sales) or unit_price, both ascending.
+// Products without a pack size sort after the others by unit price.
+func sortProducts(c *gin.Context, products []Products) bool {
+	switch c.Query("sort") {
+	case "":
+	case "price":
+		sort.SliceStable(products, func(i, j int) bool { return products[i].effectivePrice().Less(products[j].effectivePrice()) })
+	case "unit_price":
+		sort.SliceStable(products, func(i, j int) bool {
+			a, b := products[i], products[j]
+			if a.UnitPrice == nil || b.UnitPrice == nil {
+				return a.UnitPrice != nil
+			}
+			if a.UnitPriceUnit != b.UnitPriceUnit {
+				return a.UnitPriceUnit < b.UnitPriceUnit
+			}
+			return a.UnitPrice.Less(*b.UnitPrice)
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be price or unit_price"})
+		return false
+	}
+	return true
 }
 
 func CreateProductAsRecipe(db *pgxpool.Pool) gin.HandlerFunc {
@@ -48,26 +242,32 @@ func CreateProductAsRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 
 		// Ensure RecipeID is provided
-		if product.RecipeID == 0 {
+		if product.RecipeID == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "RecipeID is required"})
 			return
 		}
 
+		if !checkProduct(c, db, &product) {
+			return
+		}
+
 		// Insert the product into the database
-		query := `INSERT INTO products (seller_id, recipe_id, title, description, price, stock, image_urls, is_active)
-                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		query := `INSERT INTO products (seller_id, recipe_id, title, description, price, currency, stock, image_urls, status, publish_at, unpublish_at,
+                  pack_quantity, pack_unit)
+                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, '')) RETURNING id`
 
 		var id int
 		err := db.QueryRow(c, query, sellerID, product.RecipeID, product.Title, product.Description,
-			product.Price, product.Stock, product.ImageURLs, product.IsActive).Scan(&id)
+			product.Price, product.Price.Currency, product.Stock, product.ImageURLs, product.Status, product.PublishAt, product.UnpublishAt,
+			product.PackQuantity, product.PackUnit).Scan(&id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 			return
 		}
 
 		// Index the product in Elasticsearch
 		if err := indexProductInElasticsearch(c, id, product); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index product in Elasticsearch: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index product in Elasticsearch"})
 			return
 		}
 
@@ -92,18 +292,24 @@ func CreateProductAsTool(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 
 		// Ensure ToolID is provided
-		if product.ToolID == 0 {
+		if product.ToolID == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "ToolID is required"})
 			return
 		}
 
+		if !checkProduct(c, db, &product) {
+			return
+		}
+
 		// Insert the product into the database
-		query := `INSERT INTO products (seller_id, tool_id, title, description, price, stock, image_urls, is_active)
-                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		query := `INSERT INTO products (seller_id, tool_id, title, description, price, currency, stock, image_urls, status, publish_at, unpublish_at,
+                  pack_quantity, pack_unit)
+                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, '')) RETURNING id`
 
 		var id int
 		err := db.QueryRow(c, query, sellerID, product.ToolID, product.Title, product.Description,
-			product.Price, product.Stock, product.ImageURLs, product.IsActive).Scan(&id)
+			product.Price, product.Price.Currency, product.Stock, product.ImageURLs, product.Status, product.PublishAt, product.UnpublishAt,
+			product.PackQuantity, product.PackUnit).Scan(&id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 			return
@@ -136,18 +342,24 @@ func CreateProductAsIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 
 		// Ensure IngredientID is provided
-		if product.IngredientID == 0 {
+		if product.IngredientID == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "IngredientID is required"})
 			return
 		}
 
+		if !checkProduct(c, db, &product) {
+			return
+		}
+
 		// Insert the product into the database
-		query := `INSERT INTO products (seller_id, ingredient_id, title, description, price, stock, image_urls, is_active)
-                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		query := `INSERT INTO products (seller_id, ingredient_id, title, description, price, currency, stock, image_urls, status, publish_at, unpublish_at,
+                  pack_quantity, pack_unit)
+                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, '')) RETURNING id`
 
 		var id int
 		err := db.QueryRow(c, query, sellerID, product.IngredientID, product.Title, product.Description,
-			product.Price, product.Stock, product.ImageURLs, product.IsActive).Scan(&id)
+			product.Price, product.Price.Currency, product.Stock, product.ImageURLs, product.Status, product.PublishAt, product.UnpublishAt,
+			product.PackQuantity, product.PackUnit).Scan(&id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 			return
@@ -181,33 +393,127 @@ func indexProductInElasticsearch(c *gin.Context, id int, product Products) error
 
 func UpdateProduct(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
 		var product Products
 		if err := c.ShouldBindJSON(&product); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		id := c.Param("id")
-		query := `UPDATE products SET seller_id = $1, title = $2, description = $3, price = $4, stock = $5, image_urls = $6, is_active = $7 WHERE id = $8`
-		_, err := db.Exec(c, query, product.SellerID, product.Title, product.Description, product.Price, product.Stock, product.ImageURLs, product.IsActive, id)
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// The pack is validated against the ingredient the product is already linked to
+		product.IngredientID = nil
+		var wasActive, hasVariants bool
+		var currency string
+		err = tx.QueryRow(c, `
+			SELECT ingredient_id, is_active, currency, EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = products.id)
+			FROM products
+			WHERE id = $1 AND seller_id = $2 AND deleted_at IS NULL
+			FOR UPDATE
+		`, id, userID).Scan(&product.IngredientID, &wasActive, &currency, &hasVariants)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+			return
+		}
+		if !checkProduct(c, tx, &product) {
+			return
+		}
+		// Variant prices are in the product's currency, so changing it would silently reprice every variant
+		if hasVariants && product.Price.Currency != currency {
+			c.JSON(http.StatusConflict, gin.H{"error": "The currency of a product with variants cannot be changed"})
+			return
+		}
+
+		query := `UPDATE products SET title = $1, description = $2, price = $3, currency = $4, stock = $5, image_urls = $6,
+			status = $7, publish_at = $8, unpublish_at = $9, pack_quantity = $10, pack_unit = NULLIF($11, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = $12`
+		_, err = tx.Exec(c, query, product.Title, product.Description, product.Price, product.Price.Currency, product.Stock, product.ImageURLs,
+			product.Status, product.PublishAt, product.UnpublishAt, product.PackQuantity, product.PackUnit, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 			return
 		}
+		if wasActive && !product.IsActive {
+			if err := withdrawProduct(c, tx, id, nil, product.Title); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw product"})
+				return
+			}
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully"})
 	}
 }
 
+// DeleteProduct soft-deletes the seller's product, so carts and orders that reference it keep working,
+// and withdraws it from carts and pending checkouts
 func DeleteProduct(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		query := `DELETE FROM products WHERE id = $1`
-		_, err := db.Exec(c, query, id)
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		var title string
+		err = tx.QueryRow(c, `
+			UPDATE products SET deleted_at = CURRENT_TIMESTAMP, publish_at = NULL, unpublish_at = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND seller_id = $2 AND deleted_at IS NULL
+			RETURNING title
+		`, id, userID).Scan(&title)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 			return
 		}
+		if err := withdrawProduct(c, tx, id, nil, title); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw product"})
+			return
+		}
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 	}
@@ -217,142 +523,99 @@ func GetProductByID(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		var product struct {
-			ID           int64    `json:"id"`
-			SellerID     int64    `json:"seller_id"`
-			IngredientID *int64   `json:"ingredient_id"`
-			ToolID       *int64   `json:"tool_id"`
-			RecipeID     *int64   `json:"recipe_id"`
-			Title        string   `json:"title"`
-			Description  string   `json:"description"`
-			Price        float64  `json:"price"`
-			Stock        int      `json:"stock"`
-			ImageURLs    []string `json:"image_urls"`
-			IsActive     bool     `json:"is_active"`
-		}
-
-		err := db.QueryRow(context.Background(), "SELECT id, seller_id, ingredient_id, tool_id, recipe_id, title, description, price, stock, image_urls, is_active FROM products WHERE id = $1", id).Scan(
-			&product.ID,
-			&product.SellerID,
-			&product.IngredientID,
-			&product.ToolID,
-			&product.RecipeID,
-			&product.Title,
-			&product.Description,
-			&product.Price,
-			&product.Stock,
-			&product.ImageURLs,
-			&product.IsActive,
-		)
-
+		product, err := scanProduct(db.QueryRow(c, `SELECT `+productColumns+` FROM products WHERE id = $1 AND deleted_at IS NULL`, id))
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
-
-		c.JSON(http.StatusOK, product)
-	}
-}
-
-func GetListProduct(db *pgxpool.Pool) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var products []Products
-		query := `SELECT * FROM products`
-		rows, err := db.Query(c, query)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+		// Products that are not published are only shown to their seller
+		if userID, _ := c.Get("user_id"); !product.IsActive && userID != product.SellerID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
-		defer rows.Close()
+		products := []Products{product}
+		if err := decorateProducts(c, db, products); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price products"})
+			return
+		}
+		product = products[0]
 
-		for rows.Next() {
-			var product Products
-			if err := rows.Scan(&product.ID, &product.SellerID, &product.RecipeID, &product.ToolID, &product.IngredientID, &product.Title, &product.Description, &product.Price, &product.Stock, &product.ImageURLs, &product.IsActive); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
+		if product.PriceRange != nil {
+			if product.Options, err = loadProductOptions(c, db, product.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product options"})
+				return
+			}
+			if product.Variants, err = loadProductVariants(c, db, product.ID, true); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product variants"})
+				return
+			}
+			if err := applyVariantSales(c, db, product, product.Variants); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply promotions"})
 				return
 			}
-			products = append(products, product)
 		}
 
-		c.JSON(http.StatusOK, products)
+		c.JSON(http.StatusOK, product)
 	}
 }
 
-func GetProductByRecipeID(db *pgxpool.Pool) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		recipeID := c.Param("id")
-		var products []Products
-		query := `SELECT * FROM products WHERE recipe_id = $1`
-		rows, err := db.Query(c, query, recipeID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
-			return
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var product Products
-			if err := rows.Scan(&product.ID, &product.SellerID, &product.RecipeID, &product.ToolID, &product.IngredientID, &product.Title, &product.Description, &product.Price, &product.Stock, &product.ImageURLs, &product.IsActive); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
-				return
-			}
-			products = append(products, product)
-		}
+// decorateProducts sets the sale prices and variant price ranges of listed products
+func decorateProducts(ctx context.Context, q querier, products []Products) error {
+	if err := applyProductSales(ctx, q, products); err != nil {
+		return err
+	}
+	return applyVariantPriceRanges(ctx, q, products)
+}
 
-		c.JSON(http.StatusOK, products)
+// listProducts writes the products matched by query with their sale prices and variant price ranges,
+// sorted according to ?sort
+func listProducts(c *gin.Context, db *pgxpool.Pool, query string, args ...interface{}) {
+	rows, err := db.Query(c, `SELECT `+productColumns+` FROM products `+query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+		return
 	}
+	products, err := scanProducts(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
+		return
+	}
+	if err := decorateProducts(c, db, products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price products"})
+		return
+	}
+	if !sortProducts(c, products) {
+		return
+	}
+
+	c.JSON(http.StatusOK, products)
 }
 
-func GetProductByToolID(db *pgxpool.Pool) gin.HandlerFunc {
+func GetListProduct(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		toolID := c.Param("id")
-		var products []Products
-		query := `SELECT * FROM products WHERE tool_id = $1`
-		rows, err := db.Query(c, query, toolID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
-			return
-		}
-		defer rows.Close()
+		listProducts(c, db, `WHERE is_active ORDER BY id`)
+	}
+}
 
-		for rows.Next() {
-			var product Products
-			if err := rows.Scan(&product.ID, &product.SellerID, &product.RecipeID, &product.ToolID, &product.IngredientID, &product.Title, &product.Description, &product.Price, &product.Stock, &product.ImageURLs, &product.IsActive); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
-				return
-			}
-			products = append(products, product)
-		}
+func GetProductByRecipeID(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listProducts(c, db, `WHERE recipe_id = $1 AND is_active ORDER BY id`, c.Param("id"))
+	}
+}
 
-		c.JSON(http.StatusOK, products)
+func GetProductByToolID(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listProducts(c, db, `WHERE tool_id = $1 AND is_active ORDER BY id`, c.Param("id"))
 	}
 }
 
 func GetProductByIngredientID(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ingredientID := c.Param("id")
-		var products []Products
-		query := `SELECT * FROM products WHERE ingredient_id = $1`
-		rows, err := db.Query(c, query, ingredientID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
-			return
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var product Products
-			if err := rows.Scan(&product.ID, &product.SellerID, &product.RecipeID, &product.ToolID, &product.IngredientID, &product.Title, &product.Description, &product.Price, &product.Stock, &product.ImageURLs, &product.IsActive); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
-				return
-			}
-			products = append(products, product)
-		}
-
-		c.JSON(http.StatusOK, products)
+		listProducts(c, db, `WHERE ingredient_id = $1 AND is_active ORDER BY id`, c.Param("id"))
 	}
 }
 
+// GetProductBySellerID lists the seller's own products of every status except deleted ones; ?status keeps one status
 func GetProductBySellerID(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("user_id")
@@ -361,60 +624,27 @@ func GetProductBySellerID(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		sellerID := userID.(int)
-
-		// Truy vấn để lấy danh sách sản phẩm theo seller_id
-		var products []Products
-		query := `SELECT id, seller_id, title, description, price, stock, image_urls, is_active FROM products WHERE seller_id = $1`
-		rows, err := db.Query(c, query, sellerID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+		status := c.Query("status")
+		switch status {
+		case "", productStatusDraft, productStatusPublished, productStatusArchived:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be draft, published or archived"})
 			return
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var product Products
-			if err := rows.Scan(&product.ID, &product.SellerID, &product.Title, &product.Description, &product.Price, &product.Stock, &product.ImageURLs, &product.IsActive); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
-				return
-			}
-			products = append(products, product)
-		}
 
-		c.JSON(http.StatusOK, products)
+		listProducts(c, db, `WHERE seller_id = $1 AND deleted_at IS NULL AND ($2 = '' OR status = $2) ORDER BY id`, userID.(int), status)
 	}
 }
 
+// GetNewestProduct returns the most recently listed active products of all sellers, ?limit of them (20 by default)
 func GetNewestProduct(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-			return
-		}
-
-		sellerID := userID.(int)
-
-		// Truy vấn để lấy danh sách sản phẩm theo seller_id
-		var products []Products
-		query := `SELECT id, seller_id, title, description, price, stock, image_urls, is_active FROM products WHERE seller_id = $1`
-		rows, err := db.Query(c, query, sellerID)
+		limit, err := queryIntInRange(c, "limit", defaultNewestProducts, 1, maxNewestProducts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var product Products
-			if err := rows.Scan(&product.ID, &product.SellerID, &product.Title, &product.Description, &product.Price, &product.Stock, &product.ImageURLs, &product.IsActive); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
-				return
-			}
-			products = append(products, product)
-		}
 
-		c.JSON(http.StatusOK, products)
+		listProducts(c, db, `WHERE is_active ORDER BY created_at DESC, id DESC LIMIT $1`, limit)
 	}
 }
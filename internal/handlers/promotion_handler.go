@@ -0,0 +1,689 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	promotionTypePercentage = "percentage"
+	promotionTypeFixed      = "fixed"
+	maxPromotionCodeLength  = 50
+)
+
+type Promotion struct {
+	ID int `json:"id"`
+	// SellerID is absent for platform promotions; a seller's promotions only apply to their own products
+	SellerID *int   `json:"seller_id"`
+	Name     string `json:"name" binding:"required"`
+	// Code is what buyers enter to redeem a coupon; promotions without a code are automatic sale prices
+	Code         *string  `json:"code"`
+	DiscountType string   `json:"discount_type" binding:"required,oneof=percentage fixed"`
+	Percentage   *float64 `json:"percentage,omitempty"`
+	Amount       *Money   `json:"amount,omitempty"`
+	// Currency is the currency of Amount and MinCartValue; only products priced in it are discounted
+	Currency     string     `json:"currency"`
+	MinCartValue *Money     `json:"min_cart_value,omitempty"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   *int       `json:"usage_limit" binding:"omitempty,min=1"`
+	PerUserLimit *int       `json:"per_user_limit" binding:"omitempty,min=1"`
+	// SellerIDs, ProductIDs and Categories restrict the products discounted; empty means no restriction
+	SellerIDs  []int     `json:"seller_ids"`
+	ProductIDs []int     `json:"product_ids"`
+	Categories []string  `json:"categories"`
+	IsActive   *bool     `json:"is_active"`
+	UsageCount int       `json:"usage_count"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// percentage is the exact stored percentage, used for the arithmetic instead of Percentage
+	percentage *big.Rat
+}
+
+// promotionTarget is a product as promotions see it
+type promotionTarget struct {
+	ProductID int
+	SellerID  int
+	Category  string
+	Price     Money
+}
+
+var (
+	errInvalidPromotion    = errors.New("invalid promotion")
+	errCouponNotApplicable = errors.New("coupon cannot be applied")
+)
+
+// promotionColumns lists the promotions columns in the order scanPromotion expects them
+const promotionColumns = `id, seller_id, name, code, discount_type, percentage, amount, currency, min_cart_value,
+	starts_at, ends_at, usage_limit, per_user_limit, seller_ids, product_ids, categories, is_active, created_at,
+	(SELECT COUNT(*) FROM promotion_redemptions r WHERE r.promotion_id = promotions.id)`
+
+func scanPromotion(row pgx.Row) (Promotion, error) {
+	var promotion Promotion
+	var percentage, amount, minCartValue pgtype.Numeric
+	var isActive bool
+	err := row.Scan(&promotion.ID, &promotion.SellerID, &promotion.Name, &promotion.Code, &promotion.DiscountType,
+		&percentage, &amount, &promotion.Currency, &minCartValue, &promotion.StartsAt, &promotion.EndsAt,
+		&promotion.UsageLimit, &promotion.PerUserLimit, &promotion.SellerIDs, &promotion.ProductIDs, &promotion.Categories,
+		&isActive, &promotion.CreatedAt, &promotion.UsageCount)
+	if err != nil {
+		return Promotion{}, err
+	}
+	promotion.IsActive = &isActive
+
+	if value, ok := ratFromNumeric(percentage); ok {
+		promotion.percentage = value
+		float, _ := value.Float64()
+		promotion.Percentage = &float
+	}
+	for _, field := range []struct {
+		value pgtype.Numeric
+		dest  **Money
+	}{{amount, &promotion.Amount}, {minCartValue, &promotion.MinCartValue}} {
+		if !field.value.Valid {
+			continue
+		}
+		money, err := moneyFromNumeric(field.value, promotion.Currency)
+		if err != nil {
+			return Promotion{}, err
+		}
+		*field.dest = &money
+	}
+	return promotion, nil
+}
+
+func scanPromotions(rows pgx.Rows) ([]Promotion, error) {
+	defer rows.Close()
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+// validatePromotion normalizes a promotion from a request and checks that its discount, limits and window make sense.
+// sellerID is the owner of a seller promotion, nil for platform promotions.
+func validatePromotion(promotion *Promotion, sellerID *int) error {
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	if promotion.Name == "" {
+		return fmt.Errorf("%w: name is required", errInvalidPromotion)
+	}
+	if promotion.Code != nil {
+		code := strings.ToUpper(strings.TrimSpace(*promotion.Code))
+		if len(code) > maxPromotionCodeLength || strings.ContainsAny(code, " \t\n") {
+			return fmt.Errorf("%w: code must be at most %d characters without spaces", errInvalidPromotion, maxPromotionCodeLength)
+		}
+		promotion.Code = &code
+		if code == "" {
+			promotion.Code = nil
+		}
+	}
+
+	currency := promotion.Currency
+	if currency == "" && promotion.Amount != nil {
+		currency = promotion.Amount.Currency
+	}
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidPromotion, err)
+	}
+	promotion.Currency = currency
+	for _, money := range []*Money{promotion.Amount, promotion.MinCartValue} {
+		if money != nil && money.Currency != currency {
+			return fmt.Errorf("%w: amounts must be in %s", errInvalidPromotion, currency)
+		}
+	}
+
+	switch promotion.DiscountType {
+	case promotionTypePercentage:
+		if promotion.Percentage == nil || *promotion.Percentage <= 0 || *promotion.Percentage > 100 {
+			return fmt.Errorf("%w: percentage must be above 0 and at most 100", errInvalidPromotion)
+		}
+		if promotion.Amount != nil {
+			return fmt.Errorf("%w: a percentage discount has no amount", errInvalidPromotion)
+		}
+	case promotionTypeFixed:
+		if promotion.Amount == nil || promotion.Amount.Amount <= 0 {
+			return fmt.Errorf("%w: amount must be positive", errInvalidPromotion)
+		}
+		if promotion.Percentage != nil {
+			return fmt.Errorf("%w: a fixed discount has no percentage", errInvalidPromotion)
+		}
+	}
+
+	if promotion.MinCartValue != nil && promotion.MinCartValue.Amount <= 0 {
+		return fmt.Errorf("%w: min_cart_value must be positive", errInvalidPromotion)
+	}
+	if promotion.Code == nil && (promotion.UsageLimit != nil || promotion.PerUserLimit != nil || promotion.MinCartValue != nil) {
+		return fmt.Errorf("%w: usage limits and min_cart_value only apply to coupons with a code", errInvalidPromotion)
+	}
+
+	if promotion.StartsAt == nil {
+		now := time.Now()
+		promotion.StartsAt = &now
+	}
+	if promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", errInvalidPromotion)
+	}
+	if promotion.IsActive == nil {
+		active := true
+		promotion.IsActive = &active
+	}
+
+	promotion.SellerID = sellerID
+	if sellerID != nil {
+		if len(promotion.SellerIDs) > 1 || (len(promotion.SellerIDs) == 1 && promotion.SellerIDs[0] != *sellerID) {
+			return fmt.Errorf("%w: seller promotions only apply to your own products", errInvalidPromotion)
+		}
+		promotion.SellerIDs = nil
+	}
+
+	// Arrays are stored NOT NULL, so absent restrictions become empty arrays rather than NULL
+	if promotion.SellerIDs == nil {
+		promotion.SellerIDs = []int{}
+	}
+	if promotion.ProductIDs == nil {
+		promotion.ProductIDs = []int{}
+	}
+	categories := []string{}
+	for _, category := range promotion.Categories {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	promotion.Categories = categories
+	return nil
+}
+
+// appliesTo reports whether a product falls within the promotion's currency and restrictions
+func (p Promotion) appliesTo(target promotionTarget) bool {
+	if target.Price.Currency != p.Currency {
+		return false
+	}
+	if p.SellerID != nil && target.SellerID != *p.SellerID {
+		return false
+	}
+	if len(p.SellerIDs) > 0 && !slices.Contains(p.SellerIDs, target.SellerID) {
+		return false
+	}
+	if len(p.ProductIDs) > 0 && !slices.Contains(p.ProductIDs, target.ProductID) {
+		return false
+	}
+	if len(p.Categories) > 0 && !slices.ContainsFunc(p.Categories, func(category string) bool {
+		return strings.EqualFold(category, target.Category)
+	}) {
+		return false
+	}
+	return true
+}
+
+// discountOn returns what the promotion takes off an amount, never more than the amount itself
+func (p Promotion) discountOn(amount Money) Money {
+	if p.DiscountType == promotionTypePercentage && p.percentage != nil {
+		return amount.Scale(new(big.Rat).Quo(p.percentage, big.NewRat(100, 1)))
+	}
+	if p.Amount == nil {
+		return Money{Currency: amount.Currency}
+	}
+	return Money{Amount: min(p.Amount.Amount, amount.Amount), Currency: amount.Currency}
+}
+
+// loadActiveSales returns the automatic promotions currently running
+func loadActiveSales(ctx context.Context, q querier) ([]Promotion, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE code IS NULL AND is_active AND starts_at <= CURRENT_TIMESTAMP AND (ends_at IS NULL OR ends_at > CURRENT_TIMESTAMP)
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanPromotions(rows)
+}
+
+// bestSalePrice applies the running sale that takes the most off a product's price, if any applies
+func bestSalePrice(sales []Promotion, target promotionTarget) (*Money, *int) {
+	var best Money
+	var promotionID *int
+	for _, sale := range sales {
+		if !sale.appliesTo(target) {
+			continue
+		}
+		if discount := sale.discountOn(target.Price); discount.Amount > best.Amount {
+			best = discount
+			id := sale.ID
+			promotionID = &id
+		}
+	}
+	if promotionID == nil {
+		return nil, nil
+	}
+	price := Money{Amount: target.Price.Amount - best.Amount, Currency: target.Price.Currency}
+	return &price, promotionID
+}
+
+// loadProductCategories returns the category of each product, taken from the ingredient, tool or recipe it sells
+func loadProductCategories(ctx context.Context, q querier, productIDs []int) (map[int]string, error) {
+	rows, err := q.Query(ctx, `
+		SELECT p.id, COALESCE(i.category, t.category, r.category, '')
+		FROM products p
+		LEFT JOIN ingredients i ON i.id = p.ingredient_id
+		LEFT JOIN tools t ON t.id = p.tool_id
+		LEFT JOIN recipes r ON r.id = p.recipe_id
+		WHERE p.id = ANY($1)
+	`, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[int]string, len(productIDs))
+	for rows.Next() {
+		var id int
+		var category string
+		if err := rows.Scan(&id, &category); err != nil {
+			return nil, err
+		}
+		categories[id] = category
+	}
+	return categories, rows.Err()
+}
+
+// applyProductSales fills in the sale price of products covered by a running automatic promotion
+func applyProductSales(ctx context.Context, q querier, products []Products) error {
+	if len(products) == 0 {
+		return nil
+	}
+	sales, err := loadActiveSales(ctx, q)
+	if err != nil || len(sales) == 0 {
+		return err
+	}
+
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	categories, err := loadProductCategories(ctx, q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		product := &products[i]
+		product.SalePrice, product.SalePromotionID = bestSalePrice(sales, promotionTarget{
+			ProductID: product.ID,
+			SellerID:  product.SellerID,
+			Category:  categories[product.ID],
+			Price:     product.Price,
+		})
+	}
+	return nil
+}
+
+// couponUsable checks a coupon's window and its global and per-user usage limits.
+// A coupon that cannot be used returns errCouponNotApplicable wrapped with the reason.
+func couponUsable(ctx context.Context, q querier, userID int, coupon Promotion) error {
+	now := time.Now()
+	switch {
+	case coupon.IsActive == nil || !*coupon.IsActive:
+		return fmt.Errorf("%w: %s is not active", errCouponNotApplicable, *coupon.Code)
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt):
+		return fmt.Errorf("%w: %s is not valid yet", errCouponNotApplicable, *coupon.Code)
+	case coupon.EndsAt != nil && !now.Before(*coupon.EndsAt):
+		return fmt.Errorf("%w: %s has expired", errCouponNotApplicable, *coupon.Code)
+	case coupon.UsageLimit != nil && coupon.UsageCount >= *coupon.UsageLimit:
+		return fmt.Errorf("%w: %s has been used the maximum number of times", errCouponNotApplicable, *coupon.Code)
+	}
+
+	if coupon.PerUserLimit != nil {
+		var used int
+		if err := q.QueryRow(ctx, `SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = $1 AND user_id = $2`,
+			coupon.ID, userID).Scan(&used); err != nil {
+			return err
+		}
+		if used >= *coupon.PerUserLimit {
+			return fmt.Errorf("%w: you have already used %s", errCouponNotApplicable, *coupon.Code)
+		}
+	}
+	return nil
+}
+
+// couponDiscount checks a coupon against the active lines of a priced cart and returns its discount
+func couponDiscount(ctx context.Context, q querier, userID int, coupon Promotion, items []CartResponse) (Money, error) {
+	if err := couponUsable(ctx, q, userID, coupon); err != nil {
+		return Money{}, err
+	}
+
+	eligible := Money{Currency: coupon.Currency}
+	for _, item := range items {
+		if item.IsActive && coupon.appliesTo(item.promotionTarget()) {
+			eligible.Amount += item.LineTotal.Amount
+		}
+	}
+	if eligible.Amount == 0 {
+		return Money{}, fmt.Errorf("%w: %s does not apply to any product in your cart", errCouponNotApplicable, *coupon.Code)
+	}
+	if coupon.MinCartValue != nil && eligible.Amount < coupon.MinCartValue.Amount {
+		return Money{}, fmt.Errorf("%w: %s needs at least %s %s of eligible products", errCouponNotApplicable, *coupon.Code,
+			coupon.MinCartValue, coupon.Currency)
+	}
+	return coupon.discountOn(eligible), nil
+}
+
+// authorizePromotion loads the promotion in the :id path parameter, checking that the caller manages it:
+// sellers their own promotions, admins the platform ones
+func authorizePromotion(c *gin.Context, db *pgxpool.Pool, platform bool) (Promotion, bool) {
+	promotionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return Promotion{}, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return Promotion{}, false
+	}
+
+	query, args := `SELECT `+promotionColumns+` FROM promotions WHERE id = $1 AND seller_id = $2`, []interface{}{promotionID, userID}
+	if platform {
+		query, args = `SELECT `+promotionColumns+` FROM promotions WHERE id = $1 AND seller_id IS NULL`, []interface{}{promotionID}
+	}
+	promotion, err := scanPromotion(db.QueryRow(c, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return Promotion{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promotion"})
+		return Promotion{}, false
+	}
+	return promotion, true
+}
+
+// CreatePromotion creates a coupon or sale on the seller's own products
+func CreatePromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return createPromotion(db, false)
+}
+
+// CreatePlatformPromotion creates a coupon or sale run by the platform, optionally limited to some sellers
+func CreatePlatformPromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return createPromotion(db, true)
+}
+
+func createPromotion(db *pgxpool.Pool, platform bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var promotion Promotion
+		if err := c.ShouldBindJSON(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var sellerID *int
+		if !platform {
+			id := userID.(int)
+			sellerID = &id
+		}
+		if err := validatePromotion(&promotion, sellerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var id int
+		err := db.QueryRow(c, `
+			INSERT INTO promotions (seller_id, name, code, discount_type, percentage, amount, currency, min_cart_value,
+				starts_at, ends_at, usage_limit, per_user_limit, seller_ids, product_ids, categories, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING id
+		`, promotion.SellerID, promotion.Name, promotion.Code, promotion.DiscountType, promotion.Percentage, promotion.Amount,
+			promotion.Currency, promotion.MinCartValue, promotion.StartsAt, promotion.EndsAt, promotion.UsageLimit,
+			promotion.PerUserLimit, promotion.SellerIDs, promotion.ProductIDs, promotion.Categories, promotion.IsActive).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A promotion with this code already exists"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promotion"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Promotion created successfully"})
+	}
+}
+
+// ListPromotions returns the seller's promotions, newest first
+func ListPromotions(db *pgxpool.Pool) gin.HandlerFunc {
+	return listPromotions(db, false)
+}
+
+// ListPlatformPromotions returns the platform promotions, newest first
+func ListPlatformPromotions(db *pgxpool.Pool) gin.HandlerFunc {
+	return listPromotions(db, true)
+}
+
+func listPromotions(db *pgxpool.Pool, platform bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		query, args := `SELECT `+promotionColumns+` FROM promotions WHERE seller_id = $1 ORDER BY created_at DESC, id DESC`, []interface{}{userID}
+		if platform {
+			query, args = `SELECT `+promotionColumns+` FROM promotions WHERE seller_id IS NULL ORDER BY created_at DESC, id DESC`, nil
+		}
+		rows, err := db.Query(c, query, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promotions"})
+			return
+		}
+		promotions, err := scanPromotions(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan promotion"})
+			return
+		}
+
+		c.JSON(http.StatusOK, promotions)
+	}
+}
+
+func GetPromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return getPromotion(db, false)
+}
+
+func GetPlatformPromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return getPromotion(db, true)
+}
+
+func getPromotion(db *pgxpool.Pool, platform bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		promotion, ok := authorizePromotion(c, db, platform)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, promotion)
+	}
+}
+
+func UpdatePromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return updatePromotion(db, false)
+}
+
+func UpdatePlatformPromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return updatePromotion(db, true)
+}
+
+func updatePromotion(db *pgxpool.Pool, platform bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		existing, ok := authorizePromotion(c, db, platform)
+		if !ok {
+			return
+		}
+
+		var promotion Promotion
+		if err := c.ShouldBindJSON(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validatePromotion(&promotion, existing.SellerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if promotion.Code != nil {
+			var taken bool
+			err := db.QueryRow(c, `SELECT EXISTS (SELECT 1 FROM promotions WHERE code = $1 AND id <> $2)`, promotion.Code, existing.ID).Scan(&taken)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check promotion code"})
+				return
+			}
+			if taken {
+				c.JSON(http.StatusConflict, gin.H{"error": "A promotion with this code already exists"})
+				return
+			}
+		}
+
+		_, err := db.Exec(c, `
+			UPDATE promotions
+			SET name = $1, code = $2, discount_type = $3, percentage = $4, amount = $5, currency = $6, min_cart_value = $7,
+				starts_at = $8, ends_at = $9, usage_limit = $10, per_user_limit = $11, seller_ids = $12, product_ids = $13,
+				categories = $14, is_active = $15, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $16
+		`, promotion.Name, promotion.Code, promotion.DiscountType, promotion.Percentage, promotion.Amount, promotion.Currency,
+			promotion.MinCartValue, promotion.StartsAt, promotion.EndsAt, promotion.UsageLimit, promotion.PerUserLimit,
+			promotion.SellerIDs, promotion.ProductIDs, promotion.Categories, promotion.IsActive, existing.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update promotion"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Promotion updated successfully"})
+	}
+}
+
+func DeletePromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return deletePromotion(db, false)
+}
+
+func DeletePlatformPromotion(db *pgxpool.Pool) gin.HandlerFunc {
+	return deletePromotion(db, true)
+}
+
+func deletePromotion(db *pgxpool.Pool, platform bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		promotion, ok := authorizePromotion(c, db, platform)
+		if !ok {
+			return
+		}
+
+		if _, err := db.Exec(c, `DELETE FROM promotions WHERE id = $1`, promotion.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete promotion"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted successfully"})
+	}
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ApplyCartCoupon checks a coupon code against the user's cart and keeps it on the cart when it applies.
+// The cart summary re-checks it every time, so a coupon that later stops applying is reported as a warning.
+func ApplyCartCoupon(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var req ApplyCouponRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		coupon, err := scanPromotion(db.QueryRow(c, `SELECT `+promotionColumns+` FROM promotions WHERE code = $1`,
+			strings.ToUpper(strings.TrimSpace(req.Code))))
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon"})
+			return
+		}
+
+		summary, err := priceCart(c, db, userID.(int))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch carts"})
+			return
+		}
+		if _, err := couponDiscount(c, db, userID.(int), coupon, summary.Items); err != nil {
+			if errors.Is(err, errCouponNotApplicable) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check coupon"})
+			return
+		}
+
+		_, err = db.Exec(c, `
+			INSERT INTO cart_coupons (user_id, promotion_id) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET promotion_id = EXCLUDED.promotion_id, created_at = CURRENT_TIMESTAMP
+		`, userID, coupon.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+			return
+		}
+
+		summary, err = priceCart(c, db, userID.(int))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch carts"})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+func RemoveCartCoupon(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		if _, err := db.Exec(c, `DELETE FROM cart_coupons WHERE user_id = $1`, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove coupon"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon removed successfully"})
+	}
+}
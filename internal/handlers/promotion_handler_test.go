@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func percentagePromotion(id int, percent int64) Promotion {
+	return Promotion{ID: id, DiscountType: promotionTypePercentage, Currency: "USD", percentage: big.NewRat(percent, 1)}
+}
+
+func fixedPromotion(id int, amount int64) Promotion {
+	return Promotion{ID: id, DiscountType: promotionTypeFixed, Currency: "USD", Amount: &Money{Amount: amount, Currency: "USD"}}
+}
+
+func TestBestSalePrice(t *testing.T) {
+	target := promotionTarget{ProductID: 7, SellerID: 3, Category: "Dairy", Price: Money{Amount: 1000, Currency: "USD"}}
+
+	otherSeller := fixedPromotion(4, 900)
+	otherSeller.SellerID = &[]int{9}[0]
+	otherCategory := percentagePromotion(5, 90)
+	otherCategory.Categories = []string{"Bakery"}
+	sameCategory := percentagePromotion(6, 50)
+	sameCategory.Categories = []string{"dairy"}
+	otherCurrency := fixedPromotion(8, 900)
+	otherCurrency.Currency = "EUR"
+
+	tests := []struct {
+		name   string
+		sales  []Promotion
+		price  int64
+		saleID int
+	}{
+		{"no sales", nil, 0, 0},
+		{"largest discount wins", []Promotion{percentagePromotion(1, 10), fixedPromotion(2, 250), percentagePromotion(3, 20)}, 750, 2},
+		{"fixed discount never exceeds the price", []Promotion{fixedPromotion(1, 5000)}, 0, 1},
+		{"restrictions exclude sales", []Promotion{otherSeller, otherCategory, otherCurrency}, 0, 0},
+		{"categories match case-insensitively", []Promotion{otherCategory, sameCategory}, 500, 6},
+	}
+
+	for _, tt := range tests {
+		price, saleID := bestSalePrice(tt.sales, target)
+		if tt.saleID == 0 {
+			if price != nil || saleID != nil {
+				t.Errorf("%s: bestSalePrice = %v, %v; want no sale", tt.name, price, saleID)
+			}
+			continue
+		}
+		if price == nil || saleID == nil || price.Amount != tt.price || *saleID != tt.saleID {
+			t.Errorf("%s: bestSalePrice = %v, %v; want %d from promotion %d", tt.name, price, saleID, tt.price, tt.saleID)
+		}
+	}
+}
+
+func TestCouponDiscount(t *testing.T) {
+	code := "SAVE"
+	active := true
+	inactive := false
+	past := time.Now().Add(-time.Hour)
+	items := []CartResponse{
+		{ProductID: 1, SellerID: 3, IsActive: true, Price: Money{Amount: 1000, Currency: "USD"},
+			LineTotal: Money{Amount: 2000, Currency: "USD"}},
+		{ProductID: 2, SellerID: 4, IsActive: true, Price: Money{Amount: 1500, Currency: "USD"},
+			LineTotal: Money{Amount: 3000, Currency: "USD"}},
+		{ProductID: 3, SellerID: 3, IsActive: false, Price: Money{Amount: 9000, Currency: "USD"},
+			LineTotal: Money{Amount: 9000, Currency: "USD"}},
+	}
+
+	coupon := func(base Promotion) Promotion {
+		base.Code = &code
+		base.IsActive = &active
+		return base
+	}
+	sellerOnly := coupon(percentagePromotion(1, 10))
+	sellerOnly.SellerIDs = []int{3}
+	minimum := coupon(fixedPromotion(2, 500))
+	minimum.MinCartValue = &Money{Amount: 6000, Currency: "USD"}
+	disabled := coupon(fixedPromotion(3, 500))
+	disabled.IsActive = &inactive
+	expired := coupon(fixedPromotion(4, 500))
+	expired.EndsAt = &past
+	usedUp := coupon(fixedPromotion(5, 500))
+	usedUp.UsageLimit = &[]int{2}[0]
+	usedUp.UsageCount = 2
+	otherProducts := coupon(fixedPromotion(6, 500))
+	otherProducts.ProductIDs = []int{42}
+
+	tests := []struct {
+		name    string
+		coupon  Promotion
+		want    int64
+		wantErr bool
+	}{
+		{"percentage of every active line", coupon(percentagePromotion(7, 10)), 500, false},
+		{"only eligible lines count", sellerOnly, 200, false},
+		{"below the minimum cart value", minimum, 0, true},
+		{"inactive", disabled, 0, true},
+		{"expired", expired, 0, true},
+		{"usage limit reached", usedUp, 0, true},
+		{"no eligible product", otherProducts, 0, true},
+	}
+
+	for _, tt := range tests {
+		// Without a per-user limit the coupon is checked without querying the database
+		got, err := couponDiscount(context.Background(), nil, 1, tt.coupon, items)
+		if tt.wantErr {
+			if !errors.Is(err, errCouponNotApplicable) {
+				t.Errorf("%s: couponDiscount error = %v; want errCouponNotApplicable", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || got.Amount != tt.want {
+			t.Errorf("%s: couponDiscount = %+v, %v; want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
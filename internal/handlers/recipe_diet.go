@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	dietVegetarian = "vegetarian"
+	dietVegan      = "vegan"
+	dietGlutenFree = "gluten-free"
+	dietNutFree    = "nut-free"
+	dietDairyFree  = "dairy-free"
+)
+
+var knownAllergens = map[string]bool{
+	"gluten":    true,
+	"dairy":     true,
+	"egg":       true,
+	"peanut":    true,
+	"tree_nut":  true,
+	"soy":       true,
+	"fish":      true,
+	"shellfish": true,
+	"sesame":    true,
+}
+
+// dietExcludedAllergens lists the allergens that rule an ingredient out of an allergen-based diet
+var dietExcludedAllergens = map[string][]string{
+	dietGlutenFree: {"gluten"},
+	dietNutFree:    {"peanut", "tree_nut"},
+	dietDairyFree:  {"dairy"},
+}
+
+func normalizeAllergens(allergens []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(allergens))
+	for _, allergen := range allergens {
+		allergen = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(allergen)), " ", "_")
+		if allergen == "" || seen[allergen] {
+			continue
+		}
+		if !knownAllergens[allergen] {
+			return nil, fmt.Errorf("unknown allergen %q", allergen)
+		}
+		seen[allergen] = true
+		normalized = append(normalized, allergen)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func isKnownDiet(diet string) bool {
+	if diet == dietVegetarian || diet == dietVegan {
+		return true
+	}
+	_, ok := dietExcludedAllergens[diet]
+	return ok
+}
+
+func normalizeDiets(diets []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(diets))
+	for _, diet := range diets {
+		diet = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(diet)), "_", "-")
+		if diet == "" || seen[diet] {
+			continue
+		}
+		if !isKnownDiet(diet) {
+			return nil, fmt.Errorf("unknown diet %q", diet)
+		}
+		seen[diet] = true
+		normalized = append(normalized, diet)
+	}
+	return normalized, nil
+}
+
+func ingredientFitsDiet(ingredient Ingredients, diet string) bool {
+	switch diet {
+	case dietVegetarian:
+		return ingredient.IsVegetarian || ingredient.IsVegan
+	case dietVegan:
+		return ingredient.IsVegan
+	}
+	for _, excluded := range dietExcludedAllergens[diet] {
+		for _, allergen := range ingredient.Allergens {
+			if allergen == excluded {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// deriveDietLabels computes the diet labels a recipe qualifies for and the union of its allergens.
+// A recipe without ingredients gets no labels since nothing can be claimed about it.
+func deriveDietLabels(ingredients []Ingredients) ([]string, []string) {
+	labels := make([]string, 0)
+	allergenSet := make(map[string]bool)
+	for _, ingredient := range ingredients {
+		for _, allergen := range ingredient.Allergens {
+			allergenSet[allergen] = true
+		}
+	}
+
+	allergens := make([]string, 0, len(allergenSet))
+	for allergen := range allergenSet {
+		allergens = append(allergens, allergen)
+	}
+	sort.Strings(allergens)
+
+	if len(ingredients) == 0 {
+		return labels, allergens
+	}
+
+	for _, diet := range []string{dietVegetarian, dietVegan, dietGlutenFree, dietNutFree, dietDairyFree} {
+		fits := true
+		for _, ingredient := range ingredients {
+			if !ingredientFitsDiet(ingredient, diet) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			labels = append(labels, diet)
+		}
+	}
+
+	return labels, allergens
+}
+
+func loadRecipeIngredientAttributes(ctx context.Context, q querier, recipeID int) ([]Ingredients, error) {
+	rows, err := q.Query(ctx, `
+		SELECT i.id, i.name, i.is_vegetarian, i.is_vegan, i.allergens
+		FROM recipe_ingredient ri
+		JOIN ingredients i ON ri.ingredient_id = i.id
+		WHERE ri.recipe_id = $1
+	`, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ingredients []Ingredients
+	for rows.Next() {
+		var ingredient Ingredients
+		if err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.IsVegetarian, &ingredient.IsVegan, &ingredient.Allergens); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+// updateRecipeDietLabels re-derives and stores a recipe's diet labels and allergens from its ingredients
+func updateRecipeDietLabels(ctx context.Context, q querier, recipeID int) error {
+	ingredients, err := loadRecipeIngredientAttributes(ctx, q, recipeID)
+	if err != nil {
+		return err
+	}
+
+	labels, allergens := deriveDietLabels(ingredients)
+	_, err = q.Exec(ctx, `UPDATE recipes SET diet_labels = $1, allergens = $2 WHERE id = $3`, labels, allergens, recipeID)
+	return err
+}
+
+// parseAllergenList splits a comma separated allergen filter such as "peanut,tree_nut"
+func parseAllergenList(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	return normalizeAllergens(strings.Split(value, ","))
+}
+
+// allergenExclusionClauses builds the Elasticsearch must_not clauses filtering out recipes containing any of the allergens
+func allergenExclusionClauses(allergens []string) []map[string]interface{} {
+	clauses := make([]map[string]interface{}, 0, 1)
+	if len(allergens) > 0 {
+		clauses = append(clauses, map[string]interface{}{
+			"terms": map[string]interface{}{
+				"allergens": allergens,
+			},
+		})
+	}
+	return clauses
+}
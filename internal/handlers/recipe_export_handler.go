@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/text/unicode/norm"
+)
+
+// schemaOrgDiets maps our diet labels to the schema.org RestrictedDiet enumeration
+var schemaOrgDiets = map[string]string{
+	dietVegetarian: "https://schema.org/VegetarianDiet",
+	dietVegan:      "https://schema.org/VeganDiet",
+	dietGlutenFree: "https://schema.org/GlutenFreeDiet",
+}
+
+// ExportRecipe renders the recipe GetRecipeByID would return (honouring ?servings= and ?diet=)
+// as schema.org JSON-LD, Markdown or a printable PDF, selected with ?format=
+func ExportRecipe(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "jsonld")
+		if format != "jsonld" && format != "markdown" && format != "pdf" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of jsonld, markdown or pdf"})
+			return
+		}
+
+		recipe, ok := assembleRecipeView(c, db)
+		if !ok {
+			return
+		}
+
+		filename := recipeFileSlug(recipe)
+		switch format {
+		case "jsonld":
+			c.Header("Content-Type", "application/ld+json; charset=utf-8")
+			c.JSON(http.StatusOK, recipeJSONLD(recipe))
+		case "markdown":
+			c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.md"`, filename))
+			c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(recipeMarkdown(recipe)))
+		case "pdf":
+			c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, filename))
+			c.Data(http.StatusOK, "application/pdf", recipePDF(recipe))
+		}
+	}
+}
+
+func recipeJSONLD(recipe RecipeRequest) map[string]interface{} {
+	data := recipe.RecipeData
+	doc := map[string]interface{}{
+		"@context":           "https://schema.org",
+		"@type":              "Recipe",
+		"identifier":         strconv.Itoa(data.ID),
+		"name":               data.Name,
+		"description":        data.Description,
+		"image":              nonNilStrings(data.ImageURLs),
+		"recipeCategory":     data.Category,
+		"keywords":           strings.Join(data.SubCategories, ", "),
+		"prepTime":           fmt.Sprintf("PT%dM", data.PrepTime),
+		"cookTime":           fmt.Sprintf("PT%dM", data.CookTime),
+		"totalTime":          fmt.Sprintf("PT%dM", data.PrepTime+data.CookTime),
+		"recipeYield":        fmt.Sprintf("%d servings", data.Servings),
+		"recipeIngredient":   recipeIngredientLines(recipe),
+		"recipeInstructions": recipeJSONLDSteps(recipe.StepsData),
+	}
+
+	tools := make([]map[string]interface{}, 0, len(recipe.RecipeToolData))
+	for _, tool := range recipe.RecipeToolData {
+		tools = append(tools, map[string]interface{}{
+			"@type":            "HowToTool",
+			"name":             tool.ToolName,
+			"requiredQuantity": tool.Quantity,
+		})
+	}
+	doc["tool"] = tools
+
+	var diets []string
+	for _, label := range data.DietLabels {
+		if diet, ok := schemaOrgDiets[label]; ok {
+			diets = append(diets, diet)
+		}
+	}
+	if len(diets) > 0 {
+		doc["suitableForDiet"] = diets
+	}
+
+	if recipe.Nutrition != nil && recipe.Nutrition.PerServing != nil && !recipe.Nutrition.Incomplete {
+		facts := recipe.Nutrition.PerServing
+		doc["nutrition"] = map[string]interface{}{
+			"@type":               "NutritionInformation",
+			"servingSize":         "1 serving",
+			"calories":            fmt.Sprintf("%s calories", formatDecimal(facts.Kcal)),
+			"proteinContent":      fmt.Sprintf("%s g", formatDecimal(facts.Protein)),
+			"fatContent":          fmt.Sprintf("%s g", formatDecimal(facts.Fat)),
+			"carbohydrateContent": fmt.Sprintf("%s g", formatDecimal(facts.Carbs)),
+			"fiberContent":        fmt.Sprintf("%s g", formatDecimal(facts.Fiber)),
+			"sugarContent":        fmt.Sprintf("%s g", formatDecimal(facts.Sugar)),
+			"sodiumContent":       fmt.Sprintf("%s mg", formatDecimal(facts.Sodium)),
+		}
+	}
+
+	return doc
+}
+
+func recipeJSONLDSteps(steps []StepData) []map[string]interface{} {
+	instructions := make([]map[string]interface{}, 0, len(steps))
+	for _, step := range steps {
+		instruction := map[string]interface{}{
+			"@type":    "HowToStep",
+			"position": step.StepNumber,
+			"name":     step.Title,
+			"text":     strings.TrimSpace(step.Description + " " + stepDetails(step)),
+		}
+		if len(step.ImageURLs) > 0 {
+			instruction["image"] = step.ImageURLs
+		}
+		if step.VideoURL != "" {
+			instruction["video"] = map[string]interface{}{"@type": "VideoObject", "contentUrl": step.VideoURL}
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions
+}
+
+func recipeMarkdown(recipe RecipeRequest) string {
+	data := recipe.RecipeData
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", data.Name)
+	if data.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", data.Description)
+	}
+	for _, line := range recipeSummaryLines(recipe) {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+
+	b.WriteString("\n## Ingredients\n\n")
+	for _, line := range recipeIngredientLines(recipe) {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+
+	if len(recipe.RecipeToolData) > 0 {
+		b.WriteString("\n## Tools\n\n")
+		for _, line := range recipeToolLines(recipe) {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+
+	b.WriteString("\n## Steps\n\n")
+	for i, step := range recipe.StepsData {
+		fmt.Fprintf(&b, "%d. **%s**", i+1, step.Title)
+		if step.Description != "" {
+			fmt.Fprintf(&b, " %s", step.Description)
+		}
+		if details := stepDetails(step); details != "" {
+			fmt.Fprintf(&b, " _%s_", details)
+		}
+		b.WriteString("\n")
+		for _, url := range step.ImageURLs {
+			fmt.Fprintf(&b, "   ![%s](%s)\n", step.Title, url)
+		}
+	}
+
+	return b.String()
+}
+
+func recipePDF(recipe RecipeRequest) []byte {
+	data := recipe.RecipeData
+	doc := newPDFDocument()
+
+	doc.paragraph(pdfFontBold, 20, 0, data.Name)
+	if data.Description != "" {
+		doc.space(4)
+		doc.paragraph(pdfFontRegular, 11, 0, data.Description)
+	}
+	doc.space(4)
+	doc.paragraph(pdfFontRegular, 10, 0, strings.Join(recipeSummaryLines(recipe), "  |  "))
+	doc.rule()
+
+	doc.space(6)
+	doc.paragraph(pdfFontBold, 14, 0, "Ingredients")
+	for _, line := range recipeIngredientLines(recipe) {
+		doc.paragraph(pdfFontRegular, 11, 12, "• "+line)
+	}
+
+	if len(recipe.RecipeToolData) > 0 {
+		doc.space(6)
+		doc.paragraph(pdfFontBold, 14, 0, "Tools")
+		for _, line := range recipeToolLines(recipe) {
+			doc.paragraph(pdfFontRegular, 11, 12, "• "+line)
+		}
+	}
+
+	doc.space(6)
+	doc.paragraph(pdfFontBold, 14, 0, "Steps")
+	for i, step := range recipe.StepsData {
+		doc.space(4)
+		doc.paragraph(pdfFontBold, 11, 0, fmt.Sprintf("%d. %s", i+1, step.Title))
+		if step.Description != "" {
+			doc.paragraph(pdfFontRegular, 11, 16, step.Description)
+		}
+		if details := stepDetails(step); details != "" {
+			doc.paragraph(pdfFontRegular, 10, 16, details)
+		}
+	}
+
+	return doc.bytes()
+}
+
+// recipeSummaryLines lists the times, servings and diet labels shown at the top of exported recipes
+func recipeSummaryLines(recipe RecipeRequest) []string {
+	data := recipe.RecipeData
+	lines := []string{
+		fmt.Sprintf("Servings: %d", data.Servings),
+		fmt.Sprintf("Prep time: %d min", data.PrepTime),
+		fmt.Sprintf("Cook time: %d min", data.CookTime),
+	}
+	if data.Difficulty != "" {
+		lines = append(lines, "Difficulty: "+data.Difficulty)
+	}
+	if len(data.DietLabels) > 0 {
+		lines = append(lines, "Diet: "+strings.Join(data.DietLabels, ", "))
+	}
+	if len(data.Allergens) > 0 {
+		lines = append(lines, "Allergens: "+strings.Join(data.Allergens, ", "))
+	}
+	return lines
+}
+
+// recipeIngredientLines formats the ingredients as kitchen text such as "1 ½ cup flour",
+// using the diet-adapted list when one was requested
+func recipeIngredientLines(recipe RecipeRequest) []string {
+	ingredients := recipe.RecipeIngredientData
+	if len(recipe.AdaptedIngredients) > 0 {
+		ingredients = make([]RecipeIngredientData, 0, len(recipe.AdaptedIngredients))
+		for _, adapted := range recipe.AdaptedIngredients {
+			ingredients = append(ingredients, adapted.RecipeIngredientData)
+		}
+	}
+
+	lines := make([]string, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		if ingredient.Quantity == 0 {
+			lines = append(lines, ingredient.IngredientName)
+			continue
+		}
+		quantity := ingredient.DisplayQuantity
+		unit := ingredient.Unit
+		if quantity == "" {
+			var value float64
+			value, unit = toKitchenUnit(ingredient.Quantity, ingredient.Unit)
+			_, quantity = roundKitchenQuantity(value, unit)
+		}
+		lines = append(lines, strings.Join(strings.Fields(quantity+" "+unit+" "+ingredient.IngredientName), " "))
+	}
+	return lines
+}
+
+func recipeToolLines(recipe RecipeRequest) []string {
+	lines := make([]string, 0, len(recipe.RecipeToolData))
+	for _, tool := range recipe.RecipeToolData {
+		lines = append(lines, fmt.Sprintf("%d x %s", tool.Quantity, tool.ToolName))
+	}
+	return lines
+}
+
+// stepDetails describes a step's timer and temperature, e.g. "Timer: 10 min (simmer) · 180 °C"
+func stepDetails(step StepData) string {
+	var details []string
+	if step.DurationSeconds != nil {
+		timer := "Timer: " + formatStepDuration(*step.DurationSeconds)
+		if step.TimerLabel != "" {
+			timer += " (" + step.TimerLabel + ")"
+		}
+		details = append(details, timer)
+	}
+	if step.Temperature != nil {
+		details = append(details, fmt.Sprintf("%s °%s", formatDecimal(*step.Temperature), step.TemperatureUnit))
+	}
+	return strings.Join(details, " · ")
+}
+
+func formatStepDuration(seconds int) string {
+	switch {
+	case seconds >= 3600 && seconds%3600 == 0:
+		return fmt.Sprintf("%d h", seconds/3600)
+	case seconds >= 3600:
+		return fmt.Sprintf("%d h %d min", seconds/3600, seconds%3600/60)
+	case seconds >= 60 && seconds%60 == 0:
+		return fmt.Sprintf("%d min", seconds/60)
+	case seconds >= 60:
+		return fmt.Sprintf("%d min %d s", seconds/60, seconds%60)
+	default:
+		return fmt.Sprintf("%d s", seconds)
+	}
+}
+
+// recipeFileSlug builds an ASCII file name from the recipe name, falling back to its ID
+func recipeFileSlug(recipe RecipeRequest) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(norm.NFD.String(strings.NewReplacer("đ", "d", "Đ", "D").Replace(recipe.RecipeData.Name))) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		slug = "recipe-" + strconv.Itoa(recipe.RecipeData.ID)
+	}
+	return slug
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
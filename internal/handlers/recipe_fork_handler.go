@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RecipeLineageEntry struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+type RecipeForkInfo struct {
+	ForkCount int `json:"fork_count"`
+	// Lineage lists the recipes this one was forked from, starting with its direct parent
+	Lineage []RecipeLineageEntry `json:"lineage"`
+}
+
+// loadRecipeForkInfo counts the direct forks of the recipe and walks its forked_from_id chain.
+// Private ancestors of other users are listed without their name.
+func loadRecipeForkInfo(ctx context.Context, q querier, recipe RecipeRequest, userID int) (*RecipeForkInfo, error) {
+	info := &RecipeForkInfo{Lineage: make([]RecipeLineageEntry, 0)}
+
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM recipes WHERE forked_from_id = $1`, recipe.RecipeData.ID).Scan(&info.ForkCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if recipe.RecipeData.ForkedFromID == nil {
+		return info, nil
+	}
+
+	rows, err := q.Query(ctx, `
+		WITH RECURSIVE lineage AS (
+			SELECT id, user_id, name, is_public, forked_from_id, 1 AS depth
+			FROM recipes
+			WHERE id = $1
+			UNION ALL
+			SELECT r.id, r.user_id, r.name, r.is_public, r.forked_from_id, l.depth + 1
+			FROM recipes r
+			JOIN lineage l ON r.id = l.forked_from_id
+			WHERE l.depth < 100
+		)
+		SELECT id, user_id, CASE WHEN is_public OR user_id = $2 THEN name ELSE '' END
+		FROM lineage
+		ORDER BY depth
+	`, *recipe.RecipeData.ForkedFromID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry RecipeLineageEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Name); err != nil {
+			return nil, err
+		}
+		info.Lineage = append(info.Lineage, entry)
+	}
+	return info, rows.Err()
+}
+
+func ForkRecipe(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipeID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			return
+		}
+
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		// The body is optional and only overrides the name and visibility of the fork
+		var req struct {
+			Name     string `json:"name"`
+			IsPublic bool   `json:"is_public"`
+		}
+		if c.Request.Body != http.NoBody {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Private recipes can only be forked by their owner; anyone else gets the same 404 as a missing recipe
+		source, err := fetchRecipe(c, tx, recipeID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !source.RecipeData.IsPublic && source.RecipeData.UserID != userID.(int)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+			return
+		}
+
+		// Forks start private unless asked otherwise so the new owner can edit before sharing
+		fork := source
+		detachRecipeChildren(&fork)
+		fork.RecipeData.IsPublic = req.IsPublic
+		if req.Name != "" {
+			fork.RecipeData.Name = req.Name
+		}
+
+		forkID, err := insertRecipe(c, tx, userID.(int), fork, &recipeID)
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to fork recipe")
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		if err := reindexRecipe(c, db, forkID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index recipe in Elasticsearch"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Recipe forked successfully", "recipe_id": forkID, "forked_from_id": recipeID})
+	}
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"foocipe-recipe-service/internal/config"
 	"net/http"
 	"strconv"
@@ -10,11 +13,14 @@ import (
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type RecipeRequest struct {
 	RecipeData struct {
+		ID            int      `json:"id"`
+		UserID        int      `json:"user_id"`
 		Name          string   `json:"name"`
 		Description   string   `json:"description"`
 		Difficulty    string   `json:"difficulty"`
@@ -25,14 +31,21 @@ type RecipeRequest struct {
 		SubCategories []string `json:"sub_categories"`
 		ImageURLs     []string `json:"image_urls"`
 		IsPublic      bool     `json:"is_public"`
+		DietLabels    []string `json:"diet_labels"`
+		Allergens     []string `json:"allergens"`
+		Version       int      `json:"version"`
+		ForkedFromID  *int     `json:"forked_from_id"`
 	} `json:"recipeData"`
 	RecipeIngredientData []RecipeIngredientData `json:"recipeIngredientData"`
 	RecipeToolData       []RecipeToolData       `json:"recipeToolData"`
 	StepsData            []StepData             `json:"stepsData"`
+	Scaling              *RecipeScaling         `json:"scaling,omitempty"`
+	Nutrition            *RecipeNutrition       `json:"nutrition,omitempty"`
+	AdaptedIngredients   []AdaptedIngredient    `json:"adaptedIngredients,omitempty"`
+	Forks                *RecipeForkInfo        `json:"forks,omitempty"`
 }
 
 func CreateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
-	esClient := config.GetESClientRecipes()
 	return func(c *gin.Context) {
 		var req RecipeRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -53,35 +66,9 @@ func CreateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 		defer tx.Rollback(c)
 
-		var recipeID int
-
-		err = tx.QueryRow(c, `
-			INSERT INTO recipes (user_id, name, description, difficulty, prep_time, cook_time, servings, category, sub_categories, image_urls, is_public)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-			RETURNING id
-		`, userID, req.RecipeData.Name, req.RecipeData.Description, req.RecipeData.Difficulty,
-			req.RecipeData.PrepTime, req.RecipeData.CookTime, req.RecipeData.Servings, req.RecipeData.Category,
-			req.RecipeData.SubCategories, req.RecipeData.ImageURLs, req.RecipeData.IsPublic).Scan(&recipeID)
+		recipeID, err := insertRecipe(c, tx, userID.(int), req, nil)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert recipe"})
-			return
-		}
-
-		// insert data to table recipe_ingredients
-		if err := insertRecipeIngredients(c, tx, recipeID, req.RecipeIngredientData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert recipe ingredients"})
-			return
-		}
-
-		// insert data to table recipe_tools
-		if err := insertRecipeTools(c, tx, recipeID, req.RecipeToolData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert recipe tools"})
-			return
-		}
-
-		// insert data to table steps
-		if err := insertSteps(c, tx, recipeID, req.StepsData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert recipe steps"})
+			respondRecipeWriteError(c, err, "Failed to insert recipe")
 			return
 		}
 
@@ -91,7 +78,7 @@ func CreateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 
 		// Index the recipe in Elasticsearch
-		if err := indexRecipeInElasticsearch(c, db, esClient, recipeID, req); err != nil {
+		if err := reindexRecipe(c, db, recipeID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index recipe in Elasticsearch"})
 			return
 		}
@@ -100,10 +87,53 @@ func CreateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 	}
 }
 
-func indexRecipeInElasticsearch(c *gin.Context, db *pgxpool.Pool, esClient *elasticsearch.Client, recipeID int, req RecipeRequest) error {
+// insertRecipe stores a new recipe with its ingredients, tools and steps owned by userID and records its
+// first revision. forkedFromID links the recipe to the one it was copied from.
+func insertRecipe(ctx context.Context, tx pgx.Tx, userID int, req RecipeRequest, forkedFromID *int) (int, error) {
+	var recipeID int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO recipes (user_id, name, description, difficulty, prep_time, cook_time, servings, category, sub_categories, image_urls, is_public, forked_from_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`, userID, req.RecipeData.Name, req.RecipeData.Description, req.RecipeData.Difficulty,
+		req.RecipeData.PrepTime, req.RecipeData.CookTime, req.RecipeData.Servings, req.RecipeData.Category,
+		req.RecipeData.SubCategories, req.RecipeData.ImageURLs, req.RecipeData.IsPublic, forkedFromID).Scan(&recipeID)
+	if err != nil {
+		return 0, err
+	}
+
+	// insert data to table recipe_ingredients
+	if err := insertRecipeIngredients(ctx, tx, recipeID, req.RecipeIngredientData); err != nil {
+		return 0, err
+	}
+
+	// insert data to table recipe_tools
+	if err := insertRecipeTools(ctx, tx, recipeID, req.RecipeToolData); err != nil {
+		return 0, err
+	}
+
+	// insert data to table steps
+	if err := insertSteps(ctx, tx, recipeID, req.StepsData); err != nil {
+		return 0, err
+	}
+
+	// derive diet labels and allergens from the ingredients
+	if err := updateRecipeDietLabels(ctx, tx, recipeID); err != nil {
+		return 0, err
+	}
+
+	if err := recordRecipeRevision(ctx, tx, recipeID, userID, nil); err != nil {
+		return 0, err
+	}
+
+	return recipeID, nil
+}
+
+func indexRecipeInElasticsearch(ctx context.Context, db *pgxpool.Pool, esClient *elasticsearch.Client, recipeID int, req RecipeRequest) error {
 	// Prepare the recipe data for Elasticsearch
 	esRecipe := map[string]interface{}{
 		"id":             recipeID,
+		"user_id":        req.RecipeData.UserID,
 		"name":           req.RecipeData.Name,
 		"description":    req.RecipeData.Description,
 		"difficulty":     req.RecipeData.Difficulty,
@@ -118,11 +148,13 @@ func indexRecipeInElasticsearch(c *gin.Context, db *pgxpool.Pool, esClient *elas
 
 	// Process recipe ingredients
 	ingredients := make([]map[string]interface{}, 0)
+	ingredientAttributes := make([]Ingredients, 0, len(req.RecipeIngredientData))
 	for _, ing := range req.RecipeIngredientData {
-		ingredient, err := GetIngredientByID(db, ing.IngredientID)(c)
+		ingredient, err := GetIngredientByID(db, ing.IngredientID)(ctx)
 		if err != nil {
 			return err
 		}
+		ingredientAttributes = append(ingredientAttributes, ingredient)
 		ingredients = append(ingredients, map[string]interface{}{
 			"ingredient_id":   ing.IngredientID,
 			"quantity":        ing.Quantity,
@@ -131,10 +163,15 @@ func indexRecipeInElasticsearch(c *gin.Context, db *pgxpool.Pool, esClient *elas
 	}
 	esRecipe["ingredients"] = ingredients
 
+	// Add diet labels and allergens derived from the ingredients
+	dietLabels, allergens := deriveDietLabels(ingredientAttributes)
+	esRecipe["diet_labels"] = dietLabels
+	esRecipe["allergens"] = allergens
+
 	// Process recipe tools
 	tools := make([]map[string]interface{}, 0)
 	for _, tool := range req.RecipeToolData {
-		toolData, err := GetToolByID(db, tool.ToolID)(c)
+		toolData, err := GetToolByID(db, tool.ToolID)(ctx)
 		if err != nil {
 			return err
 		}
@@ -320,6 +357,449 @@ func GetMyRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 }
 
 func GetRecipeByID(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipe, ok := assembleRecipeView(c, db)
+		if !ok {
+			return
+		}
+
+		c.Header("ETag", recipeETag(recipe.RecipeData.Version))
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+// assembleRecipeView loads the recipe from the :id path parameter and applies the ?servings=, ?scale_tools=
+// and ?diet= options along with nutrition and fork details. Error responses are written here.
+func assembleRecipeView(c *gin.Context, db *pgxpool.Pool) (RecipeRequest, bool) {
+	recipeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return RecipeRequest{}, false
+	}
+
+	// Private recipes are only shown and exported for their owner
+	userID, _ := c.Get("user_id")
+	recipe, err := fetchRecipe(c, db, recipeID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !recipe.RecipeData.IsPublic && recipe.RecipeData.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return RecipeRequest{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+		return RecipeRequest{}, false
+	}
+
+	// Scale the recipe when a different number of servings is requested
+	if servingsParam := c.Query("servings"); servingsParam != "" {
+		servings, err := strconv.Atoi(servingsParam)
+		if err != nil || servings <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid servings"})
+			return RecipeRequest{}, false
+		}
+		scaleTools := c.Query("scale_tools") == "true"
+		if err := ScaleRecipe(&recipe, servings, scaleTools); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return RecipeRequest{}, false
+		}
+	}
+
+	// Compute nutrition from the (possibly scaled) quantities
+	recipe.Nutrition, err = computeRecipeNutrition(c, db, recipe.RecipeIngredientData, recipe.RecipeData.Servings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute recipe nutrition"})
+		return RecipeRequest{}, false
+	}
+
+	// Swap in substitutes when a dietary profile is requested
+	diets, err := parseDietList(c.Query("diet"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return RecipeRequest{}, false
+	}
+	if len(diets) > 0 {
+		recipe.AdaptedIngredients, err = adaptIngredientsForDiets(c, db, recipe.RecipeIngredientData, diets)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adapt recipe ingredients"})
+			return RecipeRequest{}, false
+		}
+	}
+
+	recipe.Forks, err = loadRecipeForkInfo(c, db, recipe, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe lineage"})
+		return RecipeRequest{}, false
+	}
+
+	return recipe, true
+}
+
+// fetchRecipe loads a recipe with its ingredients, tools and steps. It returns pgx.ErrNoRows when the recipe does not exist.
+func fetchRecipe(ctx context.Context, q querier, recipeID int) (RecipeRequest, error) {
+	var recipe RecipeRequest
+	err := q.QueryRow(ctx, `
+		SELECT id, user_id, name, description, difficulty, prep_time, cook_time, servings, category, sub_categories, image_urls, is_public,
+		       diet_labels, allergens, version, forked_from_id
+		FROM recipes
+		WHERE id = $1
+	`, recipeID).Scan(
+		&recipe.RecipeData.ID, &recipe.RecipeData.UserID,
+		&recipe.RecipeData.Name, &recipe.RecipeData.Description, &recipe.RecipeData.Difficulty,
+		&recipe.RecipeData.PrepTime, &recipe.RecipeData.CookTime, &recipe.RecipeData.Servings,
+		&recipe.RecipeData.Category, &recipe.RecipeData.SubCategories, &recipe.RecipeData.ImageURLs,
+		&recipe.RecipeData.IsPublic, &recipe.RecipeData.DietLabels, &recipe.RecipeData.Allergens,
+		&recipe.RecipeData.Version, &recipe.RecipeData.ForkedFromID,
+	)
+	if err != nil {
+		return RecipeRequest{}, err
+	}
+
+	// Fetch recipe ingredients
+	rows, err := q.Query(ctx, `
+		SELECT ri.id, ri.ingredient_id, ri.quantity, ri.non_scalable, i.name, i.unit
+		FROM recipe_ingredient ri
+		JOIN ingredients i ON ri.ingredient_id = i.id
+		WHERE ri.recipe_id = $1
+		ORDER BY ri.id
+	`, recipeID)
+	if err != nil {
+		return RecipeRequest{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ingredient RecipeIngredientData
+		if err := rows.Scan(&ingredient.ID, &ingredient.IngredientID, &ingredient.Quantity, &ingredient.NonScalable, &ingredient.IngredientName, &ingredient.Unit); err != nil {
+			return RecipeRequest{}, err
+		}
+		recipe.RecipeIngredientData = append(recipe.RecipeIngredientData, ingredient)
+	}
+	if err := rows.Err(); err != nil {
+		return RecipeRequest{}, err
+	}
+
+	// Fetch recipe tools
+	rows, err = q.Query(ctx, `
+		SELECT rt.id, rt.tool_id, rt.quantity, t.name, t.unit
+		FROM recipe_tool rt
+		JOIN tools t ON rt.tool_id = t.id
+		WHERE rt.recipe_id = $1
+		ORDER BY rt.id
+	`, recipeID)
+	if err != nil {
+		return RecipeRequest{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tool RecipeToolData
+		if err := rows.Scan(&tool.ID, &tool.ToolID, &tool.Quantity, &tool.ToolName, &tool.Unit); err != nil {
+			return RecipeRequest{}, err
+		}
+		recipe.RecipeToolData = append(recipe.RecipeToolData, tool)
+	}
+	if err := rows.Err(); err != nil {
+		return RecipeRequest{}, err
+	}
+
+	// Fetch recipe steps
+	rows, err = q.Query(ctx, `
+		SELECT id, step_number, title, COALESCE(description, ''), duration_seconds, COALESCE(timer_label, ''),
+		       temperature, COALESCE(temperature_unit, ''), COALESCE(image_urls, '{}'), COALESCE(video_url, ''),
+		       ARRAY(SELECT recipe_ingredient_id FROM step_ingredients WHERE step_id = steps.id ORDER BY recipe_ingredient_id),
+		       ARRAY(SELECT recipe_tool_id FROM step_tools WHERE step_id = steps.id ORDER BY recipe_tool_id)
+		FROM steps
+		WHERE recipe_id = $1
+		ORDER BY step_number
+	`, recipeID)
+	if err != nil {
+		return RecipeRequest{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step StepData
+		if err := rows.Scan(&step.ID, &step.StepNumber, &step.Title, &step.Description, &step.DurationSeconds, &step.TimerLabel,
+			&step.Temperature, &step.TemperatureUnit, &step.ImageURLs, &step.VideoURL,
+			&step.RecipeIngredientIDs, &step.RecipeToolIDs); err != nil {
+			return RecipeRequest{}, err
+		}
+		recipe.StepsData = append(recipe.StepsData, step)
+	}
+
+	return recipe, rows.Err()
+}
+
+// reindexRecipe rebuilds the Elasticsearch document of a recipe from what is stored in Postgres
+func reindexRecipe(ctx context.Context, db *pgxpool.Pool, recipeID int) error {
+	recipe, err := fetchRecipe(ctx, db, recipeID)
+	if err != nil {
+		return err
+	}
+	return indexRecipeInElasticsearch(ctx, db, config.GetESClientRecipes(), recipeID, recipe)
+}
+
+var (
+	errRecipeForbidden       = errors.New("recipe belongs to another user")
+	errRecipeVersionConflict = errors.New("recipe was modified by someone else")
+	errRecipeChildNotFound   = errors.New("recipe item not found")
+	errInvalidStepOrder      = errors.New("step_ids must list every step of the recipe exactly once")
+)
+
+type invalidRecipeChildError struct {
+	Kind string
+	ID   int
+}
+
+func (e invalidRecipeChildError) Error() string {
+	return fmt.Sprintf("%s %d does not belong to this recipe", e.Kind, e.ID)
+}
+
+// unknownCatalogItemError reports an ingredient or tool ID that is not in the catalog. Recipes only show
+// children joined to the catalog, so such a row would be stored but never seen.
+type unknownCatalogItemError struct {
+	Kind string
+	ID   int
+}
+
+func (e unknownCatalogItemError) Error() string {
+	return fmt.Sprintf("%s %d does not exist", e.Kind, e.ID)
+}
+
+// checkCatalogItemsExist returns an unknownCatalogItemError for the first of ids missing from the catalog
+// table of kind, which is "ingredient" or "tool"
+func checkCatalogItemsExist(ctx context.Context, q querier, kind string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var missing int
+	err := q.QueryRow(ctx, `
+		SELECT u.id FROM unnest($1::int[]) AS u(id)
+		WHERE NOT EXISTS (SELECT 1 FROM `+kind+`s c WHERE c.id = u.id)
+		ORDER BY u.id
+		LIMIT 1
+	`, ids).Scan(&missing)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return unknownCatalogItemError{Kind: kind, ID: missing}
+}
+
+func recipeETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatchVersion reads the recipe version from an If-Match header such as "3" or W/"3". It returns 0,
+// which skips the version check, when the header is absent or "*", since any current version matches "*".
+func parseIfMatchVersion(c *gin.Context) (int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil {
+		return 0, errRecipeVersionConflict
+	}
+	return version, nil
+}
+
+// lockRecipeForWrite locks the recipe row for the rest of the transaction after checking that the
+// caller owns it and, when expectedVersion is not zero, that nobody has changed it in the meantime
+func lockRecipeForWrite(ctx context.Context, tx pgx.Tx, recipeID, userID, expectedVersion int) error {
+	var ownerID, version int
+	err := tx.QueryRow(ctx, `SELECT user_id, version FROM recipes WHERE id = $1 FOR UPDATE`, recipeID).Scan(&ownerID, &version)
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return errRecipeForbidden
+	}
+	if expectedVersion != 0 && version != expectedVersion {
+		return errRecipeVersionConflict
+	}
+	return nil
+}
+
+// bumpRecipeVersion marks the recipe as modified and returns its new version
+func bumpRecipeVersion(ctx context.Context, tx pgx.Tx, recipeID int) (int, error) {
+	var version int
+	err := tx.QueryRow(ctx, `
+		UPDATE recipes SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING version
+	`, recipeID).Scan(&version)
+	return version, err
+}
+
+func respondRecipeWriteError(c *gin.Context, err error, fallback string) {
+	var childErr invalidRecipeChildError
+	var stepErr invalidStepError
+	var catalogErr unknownCatalogItemError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+	case errors.Is(err, errRecipeForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not own this recipe"})
+	case errors.Is(err, errRecipeVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Recipe has been modified, reload it and try again"})
+	case errors.Is(err, errRecipeChildNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe item not found"})
+	case errors.Is(err, errInvalidStepOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.As(err, &childErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": childErr.Error()})
+	case errors.As(err, &stepErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": stepErr.Error()})
+	case errors.As(err, &catalogErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": catalogErr.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// modifyRecipeChildren runs change in a transaction holding the caller's lock on the recipe from the :id path
+// parameter, then refreshes diet labels, bumps the version and reindexes the recipe. An If-Match header is
+// honoured when present. Error responses are written here; the returned bool reports success.
+func modifyRecipeChildren(c *gin.Context, db *pgxpool.Pool, change func(tx pgx.Tx, recipeID int) error) (int, bool) {
+	recipeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return 0, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return 0, false
+	}
+
+	expectedVersion, err := parseIfMatchVersion(c)
+	if err != nil {
+		respondRecipeWriteError(c, err, "Failed to update recipe")
+		return 0, false
+	}
+
+	tx, err := db.Begin(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return 0, false
+	}
+	defer tx.Rollback(c)
+
+	if err := lockRecipeForWrite(c, tx, recipeID, userID.(int), expectedVersion); err != nil {
+		respondRecipeWriteError(c, err, "Failed to update recipe")
+		return 0, false
+	}
+
+	if err := change(tx, recipeID); err != nil {
+		respondRecipeWriteError(c, err, "Failed to update recipe")
+		return 0, false
+	}
+
+	if err := updateRecipeDietLabels(c, tx, recipeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to derive recipe diet labels"})
+		return 0, false
+	}
+
+	version, err := bumpRecipeVersion(c, tx, recipeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe"})
+		return 0, false
+	}
+
+	if err := recordRecipeRevision(c, tx, recipeID, userID.(int), nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record recipe revision"})
+		return 0, false
+	}
+
+	if err := tx.Commit(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return 0, false
+	}
+
+	if err := reindexRecipe(c, db, recipeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe in Elasticsearch"})
+		return 0, false
+	}
+
+	c.Header("ETag", recipeETag(version))
+	return version, true
+}
+
+// listRecipeChildren loads the recipe from the :id path parameter for the nested list endpoints
+func listRecipeChildren(c *gin.Context, db *pgxpool.Pool) (RecipeRequest, bool) {
+	recipeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return RecipeRequest{}, false
+	}
+
+	// Private recipes are only listed for their owner; anyone else gets the same 404 as a missing recipe
+	userID, _ := c.Get("user_id")
+	recipe, err := fetchRecipe(c, db, recipeID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !recipe.RecipeData.IsPublic && recipe.RecipeData.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return RecipeRequest{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+		return RecipeRequest{}, false
+	}
+
+	c.Header("ETag", recipeETag(recipe.RecipeData.Version))
+	return recipe, true
+}
+
+type recipeChildChanges struct {
+	Ingredients *[]RecipeIngredientData
+	Tools       *[]RecipeToolData
+	Steps       *[]StepData
+}
+
+// saveRecipeUpdate writes the recipe row and diffs the child collections that are present in changes
+// (rows with an ID are updated, rows without one are inserted, missing rows are deleted)
+func saveRecipeUpdate(ctx context.Context, tx pgx.Tx, recipeID int, req RecipeRequest, changes recipeChildChanges) (int, error) {
+	_, err := tx.Exec(ctx, `
+		UPDATE recipes SET
+		name = $1, description = $2, difficulty = $3, prep_time = $4,
+		cook_time = $5, servings = $6, category = $7, sub_categories = $8,
+		image_urls = $9, is_public = $10
+		WHERE id = $11
+	`, req.RecipeData.Name, req.RecipeData.Description, req.RecipeData.Difficulty,
+		req.RecipeData.PrepTime, req.RecipeData.CookTime, req.RecipeData.Servings,
+		req.RecipeData.Category, req.RecipeData.SubCategories, req.RecipeData.ImageURLs,
+		req.RecipeData.IsPublic, recipeID)
+	if err != nil {
+		return 0, err
+	}
+
+	if changes.Ingredients != nil {
+		if err := updateRecipeIngredients(ctx, tx, recipeID, *changes.Ingredients); err != nil {
+			return 0, err
+		}
+	}
+	if changes.Tools != nil {
+		if err := updateRecipeTools(ctx, tx, recipeID, *changes.Tools); err != nil {
+			return 0, err
+		}
+	}
+	if changes.Steps != nil {
+		if err := updateSteps(ctx, tx, recipeID, *changes.Steps); err != nil {
+			return 0, err
+		}
+	}
+
+	// Re-derive diet labels in case the ingredients or their attributes changed
+	if err := updateRecipeDietLabels(ctx, tx, recipeID); err != nil {
+		return 0, err
+	}
+
+	return bumpRecipeVersion(ctx, tx, recipeID)
+}
+
+func UpdateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		recipeID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
@@ -327,95 +807,120 @@ func GetRecipeByID(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		// Fetch Recipe
-		var recipe RecipeRequest
-		err = db.QueryRow(c, `
-			SELECT name, description, difficulty, prep_time, cook_time, servings, category, sub_categories, image_urls, is_public
-			FROM recipes
-			WHERE id = $1
-		`, recipeID).Scan(
-			&recipe.RecipeData.Name, &recipe.RecipeData.Description, &recipe.RecipeData.Difficulty,
-			&recipe.RecipeData.PrepTime, &recipe.RecipeData.CookTime, &recipe.RecipeData.Servings,
-			&recipe.RecipeData.Category, &recipe.RecipeData.SubCategories, &recipe.RecipeData.ImageURLs,
-			&recipe.RecipeData.IsPublic,
-		)
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
 
+		expectedVersion, err := parseIfMatchVersion(c)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			respondRecipeWriteError(c, err, "Failed to update recipe")
 			return
 		}
 
-		// Fetch recipe ingredients
-		rows, err := db.Query(c, `
-			SELECT ri.ingredient_id, ri.quantity, i.name, i.unit
-			FROM recipe_ingredient ri
-			JOIN ingredients i ON ri.ingredient_id = i.id
-			WHERE ri.recipe_id = $1
-		`, recipeID)
+		var req RecipeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe ingredients"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
 			return
 		}
-		defer rows.Close()
+		defer tx.Rollback(c)
 
-		for rows.Next() {
-			var ingredient RecipeIngredientData
-			if err := rows.Scan(&ingredient.IngredientID, &ingredient.Quantity, &ingredient.IngredientName, &ingredient.Unit); err != nil { // Thêm &ingredient.Unit
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan recipe ingredients"})
-				return
-			}
-			recipe.RecipeIngredientData = append(recipe.RecipeIngredientData, ingredient)
+		if err := lockRecipeForWrite(c, tx, recipeID, userID.(int), expectedVersion); err != nil {
+			respondRecipeWriteError(c, err, "Failed to update recipe")
+			return
 		}
 
-		// Fetch recipe tools
-		rows, err = db.Query(c, `
-			SELECT rt.tool_id, rt.quantity, t.name, t.unit
-			FROM recipe_tool rt
-			JOIN tools t ON rt.tool_id = t.id
-			WHERE rt.recipe_id = $1
-		`, recipeID)
+		version, err := saveRecipeUpdate(c, tx, recipeID, req, recipeChildChanges{
+			Ingredients: &req.RecipeIngredientData,
+			Tools:       &req.RecipeToolData,
+			Steps:       &req.StepsData,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe tools"})
+			respondRecipeWriteError(c, err, "Failed to update recipe")
 			return
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var tool RecipeToolData
-			if err := rows.Scan(&tool.ToolID, &tool.Quantity, &tool.ToolName, &tool.Unit); err != nil { // Thêm &tool.Unit
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan recipe tools"})
-				return
-			}
-			recipe.RecipeToolData = append(recipe.RecipeToolData, tool)
+		if err := recordRecipeRevision(c, tx, recipeID, userID.(int), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record recipe revision"})
+			return
 		}
 
-		// Fetch recipe steps
-		rows, err = db.Query(c, `
-			SELECT step_number, title, description
-			FROM steps
-			WHERE recipe_id = $1
-			ORDER BY step_number
-		`, recipeID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe steps"})
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 			return
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var step StepData
-			if err := rows.Scan(&step.StepNumber, &step.Title, &step.Description); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan recipe steps"})
-				return
-			}
-			recipe.StepsData = append(recipe.StepsData, step)
+		// Update Elasticsearch index from the stored recipe
+		if err := reindexRecipe(c, db, recipeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe in Elasticsearch"})
+			return
 		}
 
-		c.JSON(http.StatusOK, recipe)
+		c.Header("ETag", recipeETag(version))
+		c.JSON(http.StatusOK, gin.H{"message": "Recipe updated successfully", "version": version})
 	}
 }
 
-func UpdateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
+type RecipePatchRequest struct {
+	RecipeData struct {
+		Name          *string   `json:"name"`
+		Description   *string   `json:"description"`
+		Difficulty    *string   `json:"difficulty"`
+		PrepTime      *int      `json:"prep_time"`
+		CookTime      *int      `json:"cook_time"`
+		Servings      *int      `json:"servings"`
+		Category      *string   `json:"category"`
+		SubCategories *[]string `json:"sub_categories"`
+		ImageURLs     *[]string `json:"image_urls"`
+		IsPublic      *bool     `json:"is_public"`
+	} `json:"recipeData"`
+	RecipeIngredientData *[]RecipeIngredientData `json:"recipeIngredientData"`
+	RecipeToolData       *[]RecipeToolData       `json:"recipeToolData"`
+	StepsData            *[]StepData             `json:"stepsData"`
+}
+
+// apply overlays the fields present in the patch onto the current recipe
+func (p RecipePatchRequest) apply(recipe *RecipeRequest) {
+	if p.RecipeData.Name != nil {
+		recipe.RecipeData.Name = *p.RecipeData.Name
+	}
+	if p.RecipeData.Description != nil {
+		recipe.RecipeData.Description = *p.RecipeData.Description
+	}
+	if p.RecipeData.Difficulty != nil {
+		recipe.RecipeData.Difficulty = *p.RecipeData.Difficulty
+	}
+	if p.RecipeData.PrepTime != nil {
+		recipe.RecipeData.PrepTime = *p.RecipeData.PrepTime
+	}
+	if p.RecipeData.CookTime != nil {
+		recipe.RecipeData.CookTime = *p.RecipeData.CookTime
+	}
+	if p.RecipeData.Servings != nil {
+		recipe.RecipeData.Servings = *p.RecipeData.Servings
+	}
+	if p.RecipeData.Category != nil {
+		recipe.RecipeData.Category = *p.RecipeData.Category
+	}
+	if p.RecipeData.SubCategories != nil {
+		recipe.RecipeData.SubCategories = *p.RecipeData.SubCategories
+	}
+	if p.RecipeData.ImageURLs != nil {
+		recipe.RecipeData.ImageURLs = *p.RecipeData.ImageURLs
+	}
+	if p.RecipeData.IsPublic != nil {
+		recipe.RecipeData.IsPublic = *p.RecipeData.IsPublic
+	}
+}
+
+func PatchRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		recipeID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
@@ -423,8 +928,20 @@ func UpdateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		var req RecipeRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		expectedVersion, err := parseIfMatchVersion(c)
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to update recipe")
+			return
+		}
+
+		var patch RecipePatchRequest
+		if err := c.ShouldBindJSON(&patch); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -436,19 +953,30 @@ func UpdateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 		defer tx.Rollback(c)
 
-		// Update recipe
-		_, err = tx.Exec(c, `
-            UPDATE recipes SET
-            name = $1, description = $2, difficulty = $3, prep_time = $4,
-            cook_time = $5, servings = $6, category = $7, sub_categories = $8,
-            image_urls = $9, is_public = $10
-            WHERE id = $11
-        `, req.RecipeData.Name, req.RecipeData.Description, req.RecipeData.Difficulty,
-			req.RecipeData.PrepTime, req.RecipeData.CookTime, req.RecipeData.Servings,
-			req.RecipeData.Category, req.RecipeData.SubCategories, req.RecipeData.ImageURLs,
-			req.RecipeData.IsPublic, recipeID)
+		if err := lockRecipeForWrite(c, tx, recipeID, userID.(int), expectedVersion); err != nil {
+			respondRecipeWriteError(c, err, "Failed to update recipe")
+			return
+		}
+
+		recipe, err := fetchRecipe(c, tx, recipeID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe"})
+			respondRecipeWriteError(c, err, "Failed to fetch recipe")
+			return
+		}
+		patch.apply(&recipe)
+
+		version, err := saveRecipeUpdate(c, tx, recipeID, recipe, recipeChildChanges{
+			Ingredients: patch.RecipeIngredientData,
+			Tools:       patch.RecipeToolData,
+			Steps:       patch.StepsData,
+		})
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to update recipe")
+			return
+		}
+
+		if err := recordRecipeRevision(c, tx, recipeID, userID.(int), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record recipe revision"})
 			return
 		}
 
@@ -457,16 +985,18 @@ func UpdateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		// Update Elasticsearch index
-		if err := indexRecipeInElasticsearch(c, db, config.GetESClientRecipes(), recipeID, req); err != nil {
+		if err := reindexRecipe(c, db, recipeID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe in Elasticsearch"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Recipe updated successfully"})
+		c.Header("ETag", recipeETag(version))
+		c.JSON(http.StatusOK, gin.H{"message": "Recipe updated successfully", "version": version})
 	}
 }
 
+// DeleteRecipe deletes the caller's own recipe for good. Its revision history is erased with it and it is
+// removed from every meal plan that includes it, including other users' plans.
 func DeleteRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		recipeID, err := strconv.Atoi(c.Param("id"))
@@ -475,6 +1005,18 @@ func DeleteRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		expectedVersion, err := parseIfMatchVersion(c)
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to delete recipe")
+			return
+		}
+
 		tx, err := db.Begin(c)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
@@ -482,6 +1024,16 @@ func DeleteRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 		}
 		defer tx.Rollback(c)
 
+		// Other users get the same 404 as a missing recipe
+		err = lockRecipeForWrite(c, tx, recipeID, userID.(int), expectedVersion)
+		if errors.Is(err, errRecipeForbidden) {
+			err = pgx.ErrNoRows
+		}
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to delete recipe")
+			return
+		}
+
 		// Delete related data
 		_, err = tx.Exec(c, "DELETE FROM recipe_ingredient WHERE recipe_id = $1", recipeID)
 		if err != nil {
@@ -498,6 +1050,11 @@ func DeleteRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe steps"})
 			return
 		}
+		_, err = tx.Exec(c, "DELETE FROM recipe_revisions WHERE recipe_id = $1", recipeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe revisions"})
+			return
+		}
 
 		// Delete the recipe
 		_, err = tx.Exec(c, "DELETE FROM recipes WHERE id = $1", recipeID)
@@ -532,12 +1089,25 @@ func ESSearchRecipesByName(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		excludeAllergens, err := parseAllergenList(c.Query("exclude_allergens"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Prepare the search request
 		var buf bytes.Buffer
 		searchQuery := map[string]interface{}{
 			"query": map[string]interface{}{
-				"match": map[string]interface{}{
-					"name": query,
+				"bool": map[string]interface{}{
+					"must": []map[string]interface{}{
+						{
+							"match": map[string]interface{}{
+								"name": query,
+							},
+						},
+					},
+					"must_not": allergenExclusionClauses(excludeAllergens),
 				},
 			},
 		}
@@ -594,6 +1164,8 @@ func ESSearchRecipesByName(db *pgxpool.Pool) gin.HandlerFunc {
 				"sub_categories": source["sub_categories"],
 				"image_urls":     source["image_urls"],
 				"is_public":      source["is_public"],
+				"diet_labels":    source["diet_labels"],
+				"allergens":      source["allergens"],
 			}
 		}
 
@@ -615,11 +1187,44 @@ func ChangeOwnerRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		_, err := db.Exec(c, "UPDATE recipes SET user_id = $1 WHERE id = $2", req.NewOwnerID, req.RecipeID)
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Only the owner can change the recipe; other users get the same 404 as a missing recipe
+		tag, err := tx.Exec(c, "UPDATE recipes SET user_id = $1 WHERE id = $2 AND user_id = $3", req.NewOwnerID, req.RecipeID, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change recipe owner"})
 			return
 		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			return
+		}
+
+		if _, err := bumpRecipeVersion(c, tx, req.RecipeID); err != nil {
+			respondRecipeWriteError(c, err, "Failed to change recipe owner")
+			return
+		}
+
+		if err := recordRecipeRevision(c, tx, req.RecipeID, userID.(int), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record recipe revision"})
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
 
 		// Update Elasticsearch
 		esClient := config.GetESClientRecipes()
@@ -645,11 +1250,44 @@ func ChangeStatusRecipe(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		_, err := db.Exec(c, "UPDATE recipes SET is_public = $1 WHERE id = $2", req.IsPublic, req.RecipeID)
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		// Only the owner can change the recipe; other users get the same 404 as a missing recipe
+		tag, err := tx.Exec(c, "UPDATE recipes SET is_public = $1 WHERE id = $2 AND user_id = $3", req.IsPublic, req.RecipeID, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change recipe status"})
 			return
 		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			return
+		}
+
+		if _, err := bumpRecipeVersion(c, tx, req.RecipeID); err != nil {
+			respondRecipeWriteError(c, err, "Failed to change recipe status")
+			return
+		}
+
+		if err := recordRecipeRevision(c, tx, req.RecipeID, userID.(int), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record recipe revision"})
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
 
 		// Update Elasticsearch
 		esClient := config.GetESClientRecipes()
@@ -668,16 +1306,42 @@ func ESSearchRecipesByIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 	esClient := config.GetESClientRecipes()
 	return func(c *gin.Context) {
 		var reqBody struct {
-			Ingredients []int `json:"ingredients" binding:"required"`
+			Ingredients      []int    `json:"ingredients"`
+			ExcludeAllergens []string `json:"exclude_allergens"`
 		}
 
-		if err := c.ShouldBindJSON(&reqBody); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-			return
+		if c.Request.Body != http.NoBody {
+			if err := c.ShouldBindJSON(&reqBody); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+				return
+			}
+		}
+
+		// Without explicit ingredients, search with what the user has in their pantry
+		ingredientsSource := "request"
+		if len(reqBody.Ingredients) == 0 {
+			userID, exists := c.Get("user_id")
+			if !exists {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+				return
+			}
+			pantry, err := pantryIngredientIDs(c, db, userID.(int))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+				return
+			}
+			reqBody.Ingredients = pantry
+			ingredientsSource = "pantry"
 		}
 
 		if len(reqBody.Ingredients) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one ingredient ID is required"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one ingredient ID is required, or add items to your pantry"})
+			return
+		}
+
+		excludeAllergens, err := normalizeAllergens(reqBody.ExcludeAllergens)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -699,6 +1363,7 @@ func ESSearchRecipesByIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 							},
 						},
 					},
+					"must_not": allergenExclusionClauses(excludeAllergens),
 				},
 			},
 		}
@@ -755,195 +1420,17 @@ func ESSearchRecipesByIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 				"sub_categories": source["sub_categories"],
 				"image_urls":     source["image_urls"],
 				"is_public":      source["is_public"],
+				"diet_labels":    source["diet_labels"],
+				"allergens":      source["allergens"],
 				"ingredients":    source["ingredients"],
 			}
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"total":   r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"],
-			"recipes": recipes,
+			"total":              r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"],
+			"recipes":            recipes,
+			"ingredients":        reqBody.Ingredients,
+			"ingredients_source": ingredientsSource,
 		})
 	}
 }
-
-// func UpdateRecipe(db *pgxpool.Pool) gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-// 		recipeID, err := strconv.Atoi(c.Param("id"))
-// 		if err != nil {
-// 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
-// 			return
-// 		}
-
-// 		var req RecipeRequest
-// 		if err := c.ShouldBindJSON(&req); err != nil {
-// 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-// 			return
-// 		}
-
-// 		tx, err := db.Begin(c)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-// 			return
-// 		}
-// 		defer tx.Rollback(c)
-
-// 		// Update recipe
-// 		_, err = tx.Exec(c, `
-//             UPDATE recipes SET
-//             name = $1, description = $2, difficulty = $3, prep_time = $4,
-//             cook_time = $5, servings = $6, category = $7, sub_categories = $8,
-//             image_urls = $9, is_public = $10
-//             WHERE id = $11
-//         `, req.RecipeData.Name, req.RecipeData.Description, req.RecipeData.Difficulty,
-// 			req.RecipeData.PrepTime, req.RecipeData.CookTime, req.RecipeData.Servings,
-// 			req.RecipeData.Category, req.RecipeData.SubCategories, req.RecipeData.ImageURLs,
-// 			req.RecipeData.IsPublic, recipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe"})
-// 			return
-// 		}
-
-// 		// Update ingredients, tools, and steps
-// 		if err := updateRecipeIngredients(c, tx, recipeID, req.RecipeIngredientData); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe ingredients"})
-// 			return
-// 		}
-// 		if err := updateRecipeTools(c, tx, recipeID, req.RecipeToolData); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe tools"})
-// 			return
-// 		}
-// 		if err := updateSteps(c, tx, recipeID, req.StepsData); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe steps"})
-// 			return
-// 		}
-
-// 		if err := tx.Commit(c); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-// 			return
-// 		}
-
-// 		// Update Elasticsearch index
-// 		if err := indexRecipeInElasticsearch(c, db, config.GetESClientRecipes(), recipeID, req); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe in Elasticsearch"})
-// 			return
-// 		}
-
-// 		c.JSON(http.StatusOK, gin.H{"message": "Recipe updated successfully"})
-// 	}
-// }
-
-// func DeleteRecipe(db *pgxpool.Pool) gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-// 		recipeID, err := strconv.Atoi(c.Param("id"))
-// 		if err != nil {
-// 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
-// 			return
-// 		}
-
-// 		tx, err := db.Begin(c)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-// 			return
-// 		}
-// 		defer tx.Rollback(c)
-
-// 		// Delete related data
-// 		_, err = tx.Exec(c, "DELETE FROM recipe_ingredient WHERE recipe_id = $1", recipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe ingredients"})
-// 			return
-// 		}
-// 		_, err = tx.Exec(c, "DELETE FROM recipe_tool WHERE recipe_id = $1", recipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe tools"})
-// 			return
-// 		}
-// 		_, err = tx.Exec(c, "DELETE FROM steps WHERE recipe_id = $1", recipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe steps"})
-// 			return
-// 		}
-
-// 		// Delete the recipe
-// 		_, err = tx.Exec(c, "DELETE FROM recipes WHERE id = $1", recipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe"})
-// 			return
-// 		}
-
-// 		if err := tx.Commit(c); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-// 			return
-// 		}
-
-// 		// Remove from Elasticsearch
-// 		esClient := config.GetESClientRecipes()
-// 		_, err = esClient.Delete("recipes", strconv.Itoa(recipeID))
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipe from Elasticsearch"})
-// 			return
-// 		}
-
-// 		c.JSON(http.StatusOK, gin.H{"message": "Recipe deleted successfully"})
-// 	}
-// }
-
-// func ChangeOwnerRecipe(db *pgxpool.Pool) gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-// 		var req struct {
-// 			RecipeID   int `json:"recipe_id" binding:"required"`
-// 			NewOwnerID int `json:"new_owner_id" binding:"required"`
-// 		}
-// 		if err := c.ShouldBindJSON(&req); err != nil {
-// 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-// 			return
-// 		}
-
-// 		_, err := db.Exec(c, "UPDATE recipes SET user_id = $1 WHERE id = $2", req.NewOwnerID, req.RecipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change recipe owner"})
-// 			return
-// 		}
-
-// 		// Update Elasticsearch
-// 		esClient := config.GetESClientRecipes()
-// 		_, err = esClient.Update("recipes", strconv.Itoa(req.RecipeID),
-// 			strings.NewReader(`{"doc": {"user_id": `+strconv.Itoa(req.NewOwnerID)+`}}`))
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe owner in Elasticsearch"})
-// 			return
-// 		}
-
-// 		c.JSON(http.StatusOK, gin.H{"message": "Recipe owner changed successfully"})
-// 	}
-// }
-
-// func ChangeStatusRecipe(db *pgxpool.Pool) gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-// 		var req struct {
-// 			RecipeID int  `json:"recipe_id" binding:"required"`
-// 			IsPublic bool `json:"is_public" binding:"required"`
-// 		}
-// 		if err := c.ShouldBindJSON(&req); err != nil {
-// 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-// 			return
-// 		}
-
-// 		_, err := db.Exec(c, "UPDATE recipes SET is_public = $1 WHERE id = $2", req.IsPublic, req.RecipeID)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change recipe status"})
-// 			return
-// 		}
-
-// 		// Update Elasticsearch
-// 		esClient := config.GetESClientRecipes()
-// 		_, err = esClient.Update("recipes", strconv.Itoa(req.RecipeID),
-// 			strings.NewReader(`{"doc": {"is_public": `+strconv.FormatBool(req.IsPublic)+`}}`))
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe status in Elasticsearch"})
-// 			return
-// 		}
-
-// 		c.JSON(http.StatusOK, gin.H{"message": "Recipe status changed successfully"})
-// 	}
-// }
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxRecipeImportSize = 5 << 20
+
+type ImportedIngredientLine struct {
+	ParsedIngredientLine
+	Matched        bool    `json:"matched"`
+	IngredientID   int     `json:"ingredient_id,omitempty"`
+	IngredientName string  `json:"ingredient_name,omitempty"`
+	MatchScore     float64 `json:"match_score"`
+}
+
+type RecipeImportResult struct {
+	Recipe      RecipeRequest            `json:"recipe"`
+	Ingredients []ImportedIngredientLine `json:"ingredients"`
+	Warnings    []string                 `json:"warnings"`
+	RecipeID    int                      `json:"recipe_id,omitempty"`
+}
+
+var (
+	ldJSONScriptPattern = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+	htmlTagPattern      = regexp.MustCompile(`(?s)<[^>]*>`)
+	isoDurationPattern  = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+	firstNumberPattern  = regexp.MustCompile(`\d+`)
+
+	errNoRecipeFound = errors.New("no schema.org Recipe found in the document")
+)
+
+// ImportRecipe turns an uploaded schema.org Recipe (JSON-LD, or an HTML page embedding it) into a draft
+// recipe. With ?create=true the draft is stored when every ingredient line matched a known ingredient.
+func ImportRecipe(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		document, err := readImportDocument(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		node, err := findJSONLDRecipe(document)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		catalog, err := loadIngredientCatalog(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+			return
+		}
+
+		result := buildImportedRecipe(node, catalog)
+
+		if c.Query("create") != "true" {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		for _, line := range result.Ingredients {
+			if !line.Matched {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some ingredient lines did not match a known ingredient", "draft": result})
+				return
+			}
+		}
+
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		result.RecipeID, err = insertRecipe(c, tx, userID.(int), result.Recipe, nil)
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to insert recipe")
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		if err := reindexRecipe(c, db, result.RecipeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index recipe in Elasticsearch"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, result)
+	}
+}
+
+// readImportDocument reads the document from a multipart "file" field or, failing that, the raw body
+func readImportDocument(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRecipeImportSize)
+
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			return nil, errors.New("file is required")
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	document, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.New("failed to read document")
+	}
+	if len(bytes.TrimSpace(document)) == 0 {
+		return nil, errors.New("document is empty")
+	}
+	return document, nil
+}
+
+// findJSONLDRecipe locates the Recipe node in a JSON-LD document or in the ld+json scripts of an HTML page
+func findJSONLDRecipe(document []byte) (map[string]interface{}, error) {
+	trimmed := bytes.TrimSpace(document)
+	blocks := [][]byte{trimmed}
+	if trimmed[0] != '{' && trimmed[0] != '[' {
+		blocks = nil
+		for _, match := range ldJSONScriptPattern.FindAllSubmatch(document, -1) {
+			blocks = append(blocks, match[1])
+		}
+	}
+
+	for _, block := range blocks {
+		var data interface{}
+		if err := json.Unmarshal(bytes.TrimSpace(block), &data); err != nil {
+			continue
+		}
+		if node := findRecipeNode(data); node != nil {
+			return node, nil
+		}
+	}
+	return nil, errNoRecipeFound
+}
+
+func findRecipeNode(data interface{}) map[string]interface{} {
+	switch value := data.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if node := findRecipeNode(item); node != nil {
+				return node
+			}
+		}
+	case map[string]interface{}:
+		for _, t := range jsonLDStrings(value["@type"]) {
+			if t == "Recipe" || strings.HasSuffix(t, "/Recipe") {
+				return value
+			}
+		}
+		if graph, ok := value["@graph"]; ok {
+			return findRecipeNode(graph)
+		}
+	}
+	return nil
+}
+
+func buildImportedRecipe(node map[string]interface{}, catalog []Ingredients) RecipeImportResult {
+	result := RecipeImportResult{
+		Ingredients: make([]ImportedIngredientLine, 0),
+		Warnings:    make([]string, 0),
+	}
+	recipe := &result.Recipe
+
+	recipe.RecipeData.Name = cleanImportedText(jsonLDString(node["name"]))
+	recipe.RecipeData.Description = cleanImportedText(jsonLDString(node["description"]))
+	recipe.RecipeData.ImageURLs = jsonLDImageURLs(node["image"])
+
+	categories := jsonLDStrings(node["recipeCategory"])
+	if len(categories) > 0 {
+		recipe.RecipeData.Category = categories[0]
+		recipe.RecipeData.SubCategories = categories[1:]
+	}
+
+	prepTime, prepOK := parseISODurationMinutes(jsonLDString(node["prepTime"]))
+	cookTime, cookOK := parseISODurationMinutes(jsonLDString(node["cookTime"]))
+	if !cookOK {
+		// Fall back to the total time minus the preparation when no cook time is given
+		if totalTime, ok := parseISODurationMinutes(jsonLDString(node["totalTime"])); ok && totalTime >= prepTime {
+			cookTime, cookOK = totalTime-prepTime, true
+		}
+	}
+	recipe.RecipeData.PrepTime, recipe.RecipeData.CookTime = prepTime, cookTime
+	if !prepOK && !cookOK {
+		result.Warnings = append(result.Warnings, "No preparation or cooking time found")
+	}
+
+	for _, yield := range jsonLDStrings(node["recipeYield"]) {
+		if number := firstNumberPattern.FindString(yield); number != "" {
+			recipe.RecipeData.Servings, _ = strconv.Atoi(number)
+			break
+		}
+	}
+	if recipe.RecipeData.Servings == 0 {
+		result.Warnings = append(result.Warnings, "No yield found, servings left empty")
+	}
+
+	lines := jsonLDStrings(node["recipeIngredient"])
+	if len(lines) == 0 {
+		lines = jsonLDStrings(node["ingredients"])
+	}
+	for _, line := range lines {
+		line = cleanImportedText(line)
+		if line == "" {
+			continue
+		}
+		imported, ingredient, warning := importIngredientLine(line, catalog)
+		result.Ingredients = append(result.Ingredients, imported)
+		if warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+		if imported.Matched {
+			recipe.RecipeIngredientData = append(recipe.RecipeIngredientData, ingredient)
+		}
+	}
+
+	recipe.StepsData = jsonLDInstructions(node["recipeInstructions"], "")
+	for i := range recipe.StepsData {
+		recipe.StepsData[i].StepNumber = i + 1
+		if recipe.StepsData[i].Title == "" {
+			recipe.StepsData[i].Title = fmt.Sprintf("Step %d", i+1)
+		}
+	}
+	if len(recipe.StepsData) == 0 {
+		result.Warnings = append(result.Warnings, "No instructions found")
+	}
+
+	return result
+}
+
+// importIngredientLine parses and matches one ingredient line, converting the quantity to the unit of the matched ingredient
+func importIngredientLine(line string, catalog []Ingredients) (ImportedIngredientLine, RecipeIngredientData, string) {
+	imported := ImportedIngredientLine{ParsedIngredientLine: parseIngredientLine(line)}
+
+	ingredient, score, ok := matchIngredientName(imported.Name, catalog)
+	imported.MatchScore = math.Round(score*100) / 100
+	if !ok {
+		return imported, RecipeIngredientData{}, fmt.Sprintf("No matching ingredient for %q", line)
+	}
+	imported.Matched = true
+	imported.IngredientID = ingredient.ID
+	imported.IngredientName = ingredient.Name
+
+	data := RecipeIngredientData{IngredientID: ingredient.ID, IngredientName: ingredient.Name, Unit: ingredient.Unit}
+	if imported.Quantity == nil {
+		// "salt to taste" and the like do not scale with servings
+		data.NonScalable = true
+		return imported, data, ""
+	}
+
+	// Take the upper bound of a range so the recipe never comes up short
+	amount := *imported.Quantity
+	if imported.QuantityMax != nil {
+		amount = *imported.QuantityMax
+	}
+	unit := imported.Unit
+	if unit == "" {
+		unit = ingredient.Unit
+	}
+	quantity, converted := convertQuantity(amount, unit, ingredient.Unit)
+	if !converted {
+		data.Quantity = amount
+		return imported, data, fmt.Sprintf("Could not convert %q to %s, quantity kept as is", line, ingredient.Unit)
+	}
+	data.Quantity = math.Round(quantity*1000) / 1000
+	return imported, data, ""
+}
+
+// jsonLDInstructions flattens recipeInstructions, which may be text, a list of strings, HowToSteps or HowToSections
+func jsonLDInstructions(value interface{}, section string) []StepData {
+	var steps []StepData
+	switch v := value.(type) {
+	case string:
+		for _, line := range strings.Split(html.UnescapeString(htmlTagPattern.ReplaceAllString(v, "\n")), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				steps = append(steps, StepData{Title: section, Description: line})
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			steps = append(steps, jsonLDInstructions(item, section)...)
+		}
+	case map[string]interface{}:
+		types := jsonLDStrings(v["@type"])
+		if len(types) > 0 && types[0] == "HowToSection" {
+			return jsonLDInstructions(v["itemListElement"], cleanImportedText(jsonLDString(v["name"])))
+		}
+
+		text := cleanImportedText(jsonLDString(v["text"]))
+		title := cleanImportedText(jsonLDString(v["name"]))
+		if text == "" {
+			text, title = title, ""
+		}
+		if title == "" || title == text {
+			title = section
+		}
+		if text != "" {
+			steps = append(steps, StepData{Title: title, Description: text, ImageURLs: jsonLDImageURLs(v["image"])})
+		}
+	}
+	return steps
+}
+
+// parseISODurationMinutes converts an ISO 8601 duration such as PT1H30M into whole minutes, rounding up
+func parseISODurationMinutes(value string) (int, bool) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	match := isoDurationPattern.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, false
+	}
+
+	minutes := 0.0
+	for i, factor := range []float64{24 * 60, 60, 1, 1.0 / 60} {
+		if match[i+1] != "" {
+			amount, _ := strconv.ParseFloat(match[i+1], 64)
+			minutes += amount * factor
+		}
+	}
+	return int(math.Ceil(minutes)), true
+}
+
+func jsonLDImageURLs(value interface{}) []string {
+	urls := make([]string, 0)
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			urls = append(urls, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			urls = append(urls, jsonLDImageURLs(item)...)
+		}
+	case map[string]interface{}:
+		if url := jsonLDString(v["url"]); url != "" {
+			urls = append(urls, url)
+		} else if url := jsonLDString(v["contentUrl"]); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// jsonLDString reads a JSON-LD value that may be a string, number, value object or list as a single string
+func jsonLDString(value interface{}) string {
+	values := jsonLDStrings(value)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func jsonLDStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = append(values, v)
+	case float64:
+		values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, jsonLDStrings(item)...)
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"@value", "text", "name", "@id"} {
+			if s, ok := v[key].(string); ok {
+				values = append(values, s)
+				break
+			}
+		}
+	}
+	return values
+}
+
+// cleanImportedText strips markup and entities that blogs leave in JSON-LD text fields
+func cleanImportedText(text string) string {
+	text = html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
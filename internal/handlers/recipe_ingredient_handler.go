@@ -11,30 +11,126 @@ import (
 )
 
 type RecipeIngredientData struct {
-	IngredientID   int    `json:"ingredient_id"`
-	Quantity       int    `json:"quantity"`
-	IngredientName string `json:"ingredient_name"`
-	Unit           string `json:"unit"`
+	ID              int     `json:"id"`
+	IngredientID    int     `json:"ingredient_id"`
+	Quantity        float64 `json:"quantity"`
+	NonScalable     bool    `json:"non_scalable"`
+	IngredientName  string  `json:"ingredient_name"`
+	Unit            string  `json:"unit"`
+	DisplayQuantity string  `json:"display_quantity,omitempty"`
 }
 
 func insertRecipeIngredients(ctx context.Context, tx pgx.Tx, recipeID int, ingredients []RecipeIngredientData) error {
 	for _, ingredient := range ingredients {
-		_, err := tx.Exec(ctx, `
-            INSERT INTO recipe_ingredient (recipe_id, ingredient_id, quantity)
-            VALUES ($1, $2, $3)
-        `, recipeID, ingredient.IngredientID, ingredient.Quantity)
-		if err != nil {
+		if _, err := insertRecipeIngredient(ctx, tx, recipeID, ingredient); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func insertRecipeIngredient(ctx context.Context, tx pgx.Tx, recipeID int, ingredient RecipeIngredientData) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO recipe_ingredient (recipe_id, ingredient_id, quantity, non_scalable)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, recipeID, ingredient.IngredientID, ingredient.Quantity, ingredient.NonScalable).Scan(&id)
+	return id, err
+}
+
+// updateRecipeIngredients makes the recipe's ingredient rows match the given list: rows with an ID are
+// updated, rows without one are inserted and stored rows missing from the list are deleted
+func updateRecipeIngredients(ctx context.Context, tx pgx.Tx, recipeID int, ingredients []RecipeIngredientData) error {
+	keepIDs := make([]int, 0, len(ingredients))
+	catalogIDs := make([]int, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		if ingredient.ID != 0 {
+			keepIDs = append(keepIDs, ingredient.ID)
+		}
+		catalogIDs = append(catalogIDs, ingredient.IngredientID)
+	}
+	if err := checkCatalogItemsExist(ctx, tx, "ingredient", catalogIDs); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `DELETE FROM recipe_ingredient WHERE recipe_id = $1 AND NOT (id = ANY($2))`, recipeID, keepIDs)
+	if err != nil {
+		return err
+	}
+
+	var newIngredients []RecipeIngredientData
+	for _, ingredient := range ingredients {
+		if ingredient.ID == 0 {
+			newIngredients = append(newIngredients, ingredient)
+			continue
+		}
+
+		result, err := tx.Exec(ctx, `
+			UPDATE recipe_ingredient SET ingredient_id = $1, quantity = $2, non_scalable = $3
+			WHERE id = $4 AND recipe_id = $5
+		`, ingredient.IngredientID, ingredient.Quantity, ingredient.NonScalable, ingredient.ID, recipeID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return invalidRecipeChildError{Kind: "recipe ingredient", ID: ingredient.ID}
+		}
+	}
+
+	return insertRecipeIngredients(ctx, tx, recipeID, newIngredients)
+}
+
+func ListRecipeIngredients(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipe, ok := listRecipeChildren(c, db)
+		if !ok {
+			return
+		}
+
+		ingredients := recipe.RecipeIngredientData
+		if ingredients == nil {
+			ingredients = []RecipeIngredientData{}
+		}
+		c.JSON(http.StatusOK, ingredients)
+	}
+}
+
+func AddRecipeIngredient(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RecipeIngredientData
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.IngredientID == 0 || req.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ingredient_id and a positive quantity are required"})
+			return
+		}
+
+		var id int
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			if err := checkCatalogItemsExist(c, tx, "ingredient", []int{req.IngredientID}); err != nil {
+				return err
+			}
+			var err error
+			id, err = insertRecipeIngredient(c, tx, recipeID, req)
+			return err
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "version": version, "message": "Recipe ingredient added successfully"})
+	}
+}
+
 func UpdateRecipeIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		recipeID, err := strconv.Atoi(c.Param("recipe_id"))
+		itemID, err := strconv.Atoi(c.Param("item_id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ingredient ID"})
 			return
 		}
 
@@ -44,12 +140,57 @@ func UpdateRecipeIngredient(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(c, `UPDATE recipe_ingredient SET quantity = $1 WHERE recipe_id = $2 AND ingredient_id = $3`, req.Quantity, recipeID, req.IngredientID)
+		if req.IngredientID == 0 || req.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ingredient_id and a positive quantity are required"})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			if err := checkCatalogItemsExist(c, tx, "ingredient", []int{req.IngredientID}); err != nil {
+				return err
+			}
+			result, err := tx.Exec(c, `
+				UPDATE recipe_ingredient SET ingredient_id = $1, quantity = $2, non_scalable = $3
+				WHERE id = $4 AND recipe_id = $5
+			`, req.IngredientID, req.Quantity, req.NonScalable, itemID, recipeID)
+			if err != nil {
+				return err
+			}
+			if result.RowsAffected() == 0 {
+				return errRecipeChildNotFound
+			}
+			return nil
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe ingredient updated successfully"})
+	}
+}
+
+func RemoveRecipeIngredient(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("item_id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe ingredient"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ingredient ID"})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			result, err := tx.Exec(c, `DELETE FROM recipe_ingredient WHERE id = $1 AND recipe_id = $2`, itemID, recipeID)
+			if err != nil {
+				return err
+			}
+			if result.RowsAffected() == 0 {
+				return errRecipeChildNotFound
+			}
+			return nil
+		})
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Recipe ingredient updated successfully"})
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe ingredient removed successfully"})
 	}
 }
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// pdfDocument is a minimal A4 text-only PDF writer using the standard Helvetica fonts,
+// enough to print a recipe card without pulling in a PDF library
+type pdfDocument struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+	y       float64
+}
+
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 56.0
+)
+
+const (
+	pdfFontRegular = "F1"
+	pdfFontBold    = "F2"
+)
+
+func newPDFDocument() *pdfDocument {
+	doc := &pdfDocument{}
+	doc.addPage()
+	return doc
+}
+
+func (d *pdfDocument) addPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// space moves the cursor down, starting a new page when the next block would not fit
+func (d *pdfDocument) space(height float64) {
+	if d.y-height < pdfMargin {
+		d.addPage()
+		return
+	}
+	d.y -= height
+}
+
+// paragraph writes text wrapped to the page width, indenting continuation lines like the first one
+func (d *pdfDocument) paragraph(font string, size, indent float64, text string) {
+	for _, line := range wrapPDFText(text, font, size, pdfPageWidth-2*pdfMargin-indent) {
+		d.space(size * 1.35)
+		fmt.Fprintf(d.current, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, pdfMargin+indent, d.y, encodePDFText(line))
+	}
+}
+
+// rule draws a thin horizontal line across the text area
+func (d *pdfDocument) rule() {
+	d.space(8)
+	fmt.Fprintf(d.current, "0.6 G 0.5 w %.1f %.1f m %.1f %.1f l S 0 G\n", pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+}
+
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, the page tree and the two fonts; each page then takes two objects
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// wrapPDFText splits text into lines that fit width, estimating glyph widths from the average Helvetica advance
+func wrapPDFText(text, font string, size, width float64) []string {
+	average := 0.5
+	if font == pdfFontBold {
+		average = 0.56
+	}
+	maxChars := int(width / (size * average))
+
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= maxChars:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// winAnsiSpecials maps the characters WinAnsiEncoding places in the 0x80-0x9F range
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '•': 0x95, '–': 0x96, '—': 0x97,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '™': 0x99,
+}
+
+// encodePDFText converts text to an escaped WinAnsi string literal. Characters outside the encoding
+// lose their accents (as with Vietnamese) or are spelled out, so the standard fonts can still render them.
+func encodePDFText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x80:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			b.WriteByte(byte(r))
+		case winAnsiSpecials[r] != 0:
+			b.WriteByte(winAnsiSpecials[r])
+		case unicodeFractions[r] != "":
+			b.WriteString(unicodeFractions[r])
+		case r == 'đ':
+			b.WriteByte('d')
+		case r == 'Đ':
+			b.WriteByte('D')
+		default:
+			replaced := false
+			for _, base := range norm.NFD.String(string(r)) {
+				if unicode.Is(unicode.Mn, base) {
+					continue
+				}
+				if base < 0x80 || (base >= 0xA0 && base <= 0xFF) {
+					b.WriteByte(byte(base))
+					replaced = true
+				}
+			}
+			if !replaced {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
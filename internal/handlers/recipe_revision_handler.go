@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RecipeRevision struct {
+	RevisionNumber int            `json:"revision_number"`
+	UserID         int            `json:"user_id"`
+	RestoredFrom   *int           `json:"restored_from"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Snapshot       *RecipeRequest `json:"snapshot,omitempty"`
+}
+
+type RecipeFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type RecipeItemChange struct {
+	Key  int         `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type RecipeCollectionDiff struct {
+	Added   []interface{}      `json:"added"`
+	Removed []interface{}      `json:"removed"`
+	Changed []RecipeItemChange `json:"changed"`
+}
+
+type RecipeRevisionDiff struct {
+	From        int                  `json:"from"`
+	To          int                  `json:"to"`
+	Fields      []RecipeFieldChange  `json:"fields"`
+	Ingredients RecipeCollectionDiff `json:"ingredients"`
+	Tools       RecipeCollectionDiff `json:"tools"`
+	Steps       RecipeCollectionDiff `json:"steps"`
+}
+
+// recordRecipeRevision stores an immutable snapshot of the recipe as it is inside the transaction.
+// The revision number is the recipe version, so it must be called after the version has been bumped.
+func recordRecipeRevision(ctx context.Context, tx pgx.Tx, recipeID, userID int, restoredFrom *int) error {
+	recipe, err := fetchRecipe(ctx, tx, recipeID)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := json.Marshal(recipe)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO recipe_revisions (recipe_id, revision_number, user_id, snapshot, restored_from)
+		VALUES ($1, $2, $3, $4, $5)
+	`, recipeID, recipe.RecipeData.Version, userID, snapshot, restoredFrom)
+	return err
+}
+
+func loadRecipeRevision(ctx context.Context, q querier, recipeID, revisionNumber int) (RecipeRevision, error) {
+	var revision RecipeRevision
+	var snapshot []byte
+	err := q.QueryRow(ctx, `
+		SELECT revision_number, user_id, restored_from, created_at, snapshot
+		FROM recipe_revisions
+		WHERE recipe_id = $1 AND revision_number = $2
+	`, recipeID, revisionNumber).Scan(&revision.RevisionNumber, &revision.UserID, &revision.RestoredFrom, &revision.CreatedAt, &snapshot)
+	if err != nil {
+		return RecipeRevision{}, err
+	}
+
+	revision.Snapshot = &RecipeRequest{}
+	if err := json.Unmarshal(snapshot, revision.Snapshot); err != nil {
+		return RecipeRevision{}, err
+	}
+	return revision, nil
+}
+
+// authorizeRecipeView checks that the recipe from the :id path parameter is public or owned by the caller
+func authorizeRecipeView(c *gin.Context, db *pgxpool.Pool) (int, bool) {
+	recipeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return 0, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return 0, false
+	}
+
+	var ownerID int
+	var isPublic bool
+	err = db.QueryRow(c, `SELECT user_id, is_public FROM recipes WHERE id = $1`, recipeID).Scan(&ownerID, &isPublic)
+	// Another user's private recipe gets the same 404 as a missing one
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !isPublic && ownerID != userID.(int)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+		return 0, false
+	}
+
+	return recipeID, true
+}
+
+func ListRecipeRevisions(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipeID, ok := authorizeRecipeView(c, db)
+		if !ok {
+			return
+		}
+
+		rows, err := db.Query(c, `
+			SELECT revision_number, user_id, restored_from, created_at
+			FROM recipe_revisions
+			WHERE recipe_id = $1
+			ORDER BY revision_number DESC
+		`, recipeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe revisions"})
+			return
+		}
+		defer rows.Close()
+
+		revisions := make([]RecipeRevision, 0)
+		for rows.Next() {
+			var revision RecipeRevision
+			if err := rows.Scan(&revision.RevisionNumber, &revision.UserID, &revision.RestoredFrom, &revision.CreatedAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan recipe revision"})
+				return
+			}
+			revisions = append(revisions, revision)
+		}
+
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over recipe revisions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, revisions)
+	}
+}
+
+func GetRecipeRevision(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipeID, ok := authorizeRecipeView(c, db)
+		if !ok {
+			return
+		}
+
+		revisionNumber, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision number"})
+			return
+		}
+
+		revision, err := loadRecipeRevision(c, db, recipeID, revisionNumber)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe revision"})
+			return
+		}
+
+		c.JSON(http.StatusOK, revision)
+	}
+}
+
+func DiffRecipeRevisions(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipeID, ok := authorizeRecipeView(c, db)
+		if !ok {
+			return
+		}
+
+		from, errFrom := strconv.Atoi(c.Query("from"))
+		to, errTo := strconv.Atoi(c.Query("to"))
+		if errFrom != nil || errTo != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to revision numbers are required"})
+			return
+		}
+
+		fromRevision, err := loadRecipeRevision(c, db, recipeID, from)
+		if err == nil {
+			var toRevision RecipeRevision
+			toRevision, err = loadRecipeRevision(c, db, recipeID, to)
+			if err == nil {
+				c.JSON(http.StatusOK, diffRecipes(from, to, *fromRevision.Snapshot, *toRevision.Snapshot))
+				return
+			}
+		}
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe revision"})
+	}
+}
+
+func RestoreRecipeRevision(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipeID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			return
+		}
+
+		revisionNumber, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision number"})
+			return
+		}
+
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		expectedVersion, err := parseIfMatchVersion(c)
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to restore recipe revision")
+			return
+		}
+
+		tx, err := db.Begin(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+			return
+		}
+		defer tx.Rollback(c)
+
+		if err := lockRecipeForWrite(c, tx, recipeID, userID.(int), expectedVersion); err != nil {
+			respondRecipeWriteError(c, err, "Failed to restore recipe revision")
+			return
+		}
+
+		revision, err := loadRecipeRevision(c, tx, recipeID, revisionNumber)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe revision"})
+			return
+		}
+
+		// Children are re-created from the snapshot since the rows it references may be gone by now
+		snapshot := *revision.Snapshot
+		detachRecipeChildren(&snapshot)
+
+		version, err := saveRecipeUpdate(c, tx, recipeID, snapshot, recipeChildChanges{
+			Ingredients: &snapshot.RecipeIngredientData,
+			Tools:       &snapshot.RecipeToolData,
+			Steps:       &snapshot.StepsData,
+		})
+		if err != nil {
+			respondRecipeWriteError(c, err, "Failed to restore recipe revision")
+			return
+		}
+
+		if err := recordRecipeRevision(c, tx, recipeID, userID.(int), &revisionNumber); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record recipe revision"})
+			return
+		}
+
+		if err := tx.Commit(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+
+		if err := reindexRecipe(c, db, recipeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe in Elasticsearch"})
+			return
+		}
+
+		c.Header("ETag", recipeETag(version))
+		c.JSON(http.StatusOK, gin.H{"message": "Recipe revision restored successfully", "version": version, "restored_from": revisionNumber})
+	}
+}
+
+func diffRecipes(from, to int, a, b RecipeRequest) RecipeRevisionDiff {
+	diff := RecipeRevisionDiff{From: from, To: to, Fields: make([]RecipeFieldChange, 0)}
+
+	fields := []struct {
+		name string
+		a, b interface{}
+	}{
+		{"name", a.RecipeData.Name, b.RecipeData.Name},
+		{"description", a.RecipeData.Description, b.RecipeData.Description},
+		{"difficulty", a.RecipeData.Difficulty, b.RecipeData.Difficulty},
+		{"prep_time", a.RecipeData.PrepTime, b.RecipeData.PrepTime},
+		{"cook_time", a.RecipeData.CookTime, b.RecipeData.CookTime},
+		{"servings", a.RecipeData.Servings, b.RecipeData.Servings},
+		{"category", a.RecipeData.Category, b.RecipeData.Category},
+		{"sub_categories", a.RecipeData.SubCategories, b.RecipeData.SubCategories},
+		{"image_urls", a.RecipeData.ImageURLs, b.RecipeData.ImageURLs},
+		{"is_public", a.RecipeData.IsPublic, b.RecipeData.IsPublic},
+		{"user_id", a.RecipeData.UserID, b.RecipeData.UserID},
+	}
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.a, field.b) {
+			diff.Fields = append(diff.Fields, RecipeFieldChange{Field: field.name, From: field.a, To: field.b})
+		}
+	}
+
+	diff.Ingredients = diffCollection(a.RecipeIngredientData, b.RecipeIngredientData,
+		func(i RecipeIngredientData) int { return i.IngredientID },
+		func(x, y RecipeIngredientData) bool {
+			return x.Quantity == y.Quantity && x.NonScalable == y.NonScalable
+		})
+	diff.Tools = diffCollection(a.RecipeToolData, b.RecipeToolData,
+		func(t RecipeToolData) int { return t.ToolID },
+		func(x, y RecipeToolData) bool { return x.Quantity == y.Quantity })
+	diff.Steps = diffCollection(a.StepsData, b.StepsData,
+		func(s StepData) int { return s.StepNumber },
+		func(x, y StepData) bool { return stepContent(a, x).equal(stepContent(b, y)) })
+
+	return diff
+}
+
+// recipeStepContent is what a step says, with its ingredient and tool references as catalog IDs. Row IDs are
+// left out, since restoring a revision stores the steps and the rows they reference under new IDs.
+type recipeStepContent struct {
+	step          StepData
+	ingredientIDs []int
+	toolIDs       []int
+}
+
+func stepContent(recipe RecipeRequest, step StepData) recipeStepContent {
+	ingredients := make(map[int]int, len(recipe.RecipeIngredientData))
+	for _, ingredient := range recipe.RecipeIngredientData {
+		ingredients[ingredient.ID] = ingredient.IngredientID
+	}
+	tools := make(map[int]int, len(recipe.RecipeToolData))
+	for _, tool := range recipe.RecipeToolData {
+		tools[tool.ID] = tool.ToolID
+	}
+
+	content := recipeStepContent{step: step}
+	for _, id := range step.RecipeIngredientIDs {
+		content.ingredientIDs = append(content.ingredientIDs, ingredients[id])
+	}
+	for _, id := range step.RecipeToolIDs {
+		content.toolIDs = append(content.toolIDs, tools[id])
+	}
+	slices.Sort(content.ingredientIDs)
+	slices.Sort(content.toolIDs)
+	return content
+}
+
+func (x recipeStepContent) equal(y recipeStepContent) bool {
+	return x.step.StepNumber == y.step.StepNumber && x.step.Title == y.step.Title && x.step.Description == y.step.Description &&
+		reflect.DeepEqual(x.step.DurationSeconds, y.step.DurationSeconds) && x.step.TimerLabel == y.step.TimerLabel &&
+		reflect.DeepEqual(x.step.Temperature, y.step.Temperature) && x.step.TemperatureUnit == y.step.TemperatureUnit &&
+		slices.Equal(x.step.ImageURLs, y.step.ImageURLs) && x.step.VideoURL == y.step.VideoURL &&
+		slices.Equal(x.ingredientIDs, y.ingredientIDs) && slices.Equal(x.toolIDs, y.toolIDs)
+}
+
+// diffCollection compares two child collections by a natural key (ingredient ID, tool ID or step number)
+func diffCollection[T any](from, to []T, key func(T) int, equal func(T, T) bool) RecipeCollectionDiff {
+	diff := RecipeCollectionDiff{
+		Added:   make([]interface{}, 0),
+		Removed: make([]interface{}, 0),
+		Changed: make([]RecipeItemChange, 0),
+	}
+
+	fromByKey := make(map[int]T, len(from))
+	for _, item := range from {
+		fromByKey[key(item)] = item
+	}
+	toByKey := make(map[int]T, len(to))
+	for _, item := range to {
+		toByKey[key(item)] = item
+	}
+
+	for _, item := range to {
+		previous, existed := fromByKey[key(item)]
+		switch {
+		case !existed:
+			diff.Added = append(diff.Added, item)
+		case !equal(previous, item):
+			diff.Changed = append(diff.Changed, RecipeItemChange{Key: key(item), From: previous, To: item})
+		}
+	}
+	for _, item := range from {
+		if _, kept := toByKey[key(item)]; !kept {
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Key < diff.Changed[j].Key })
+	return diff
+}
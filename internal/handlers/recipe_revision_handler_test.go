@@ -0,0 +1,32 @@
+package handlers
+
+import "testing"
+
+func TestDiffRecipesComparesStepsByContent(t *testing.T) {
+	minutes := 300
+	recipe := func(ingredientRow, toolRow, stepRow int, description string) RecipeRequest {
+		return RecipeRequest{
+			RecipeIngredientData: []RecipeIngredientData{{ID: ingredientRow, IngredientID: 7, Quantity: 2}},
+			RecipeToolData:       []RecipeToolData{{ID: toolRow, ToolID: 3, Quantity: 1}},
+			StepsData: []StepData{{
+				ID: stepRow, StepNumber: 1, Description: description, DurationSeconds: &minutes,
+				RecipeIngredientIDs: []int{ingredientRow}, RecipeToolIDs: []int{toolRow},
+			}},
+		}
+	}
+
+	// Restoring a revision stores the same content under new row IDs
+	if diff := diffRecipes(1, 2, recipe(10, 20, 30, "Mix"), recipe(11, 21, 31, "Mix")); len(diff.Steps.Changed) != 0 {
+		t.Errorf("restored steps reported as changed: %+v", diff.Steps.Changed)
+	}
+	if diff := diffRecipes(1, 2, recipe(10, 20, 30, "Mix"), recipe(11, 21, 31, "Stir")); len(diff.Steps.Changed) != 1 {
+		t.Errorf("changed step description not reported: %+v", diff.Steps)
+	}
+
+	moved := recipe(11, 21, 31, "Mix")
+	moved.RecipeIngredientData = append(moved.RecipeIngredientData, RecipeIngredientData{ID: 12, IngredientID: 8, Quantity: 1})
+	moved.StepsData[0].RecipeIngredientIDs = []int{12}
+	if diff := diffRecipes(1, 2, recipe(10, 20, 30, "Mix"), moved); len(diff.Steps.Changed) != 1 {
+		t.Errorf("step referencing another ingredient not reported: %+v", diff.Steps)
+	}
+}
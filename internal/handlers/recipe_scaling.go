@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+)
+
+type RecipeScaling struct {
+	OriginalServings int     `json:"original_servings"`
+	Servings         int     `json:"servings"`
+	Factor           float64 `json:"factor"`
+	ToolsScaled      bool    `json:"tools_scaled"`
+}
+
+var errInvalidServings = errors.New("servings must be a positive number")
+
+// ScaleRecipe resizes a recipe to the requested number of servings. Ingredient quantities are scaled
+// proportionally and rounded to kitchen units, ingredients flagged as non-scalable keep their quantity,
+// and tool quantities are only scaled (rounded up to whole tools) when scaleTools is set.
+func ScaleRecipe(recipe *RecipeRequest, servings int, scaleTools bool) error {
+	if servings <= 0 {
+		return errInvalidServings
+	}
+	if recipe.RecipeData.Servings <= 0 {
+		return errors.New("recipe has no servings to scale from")
+	}
+
+	factor := float64(servings) / float64(recipe.RecipeData.Servings)
+
+	for i := range recipe.RecipeIngredientData {
+		ingredient := &recipe.RecipeIngredientData[i]
+		if ingredient.NonScalable {
+			_, ingredient.DisplayQuantity = roundKitchenQuantity(ingredient.Quantity, ingredient.Unit)
+			continue
+		}
+
+		quantity, unit := toKitchenUnit(ingredient.Quantity*factor, ingredient.Unit)
+		ingredient.Quantity, ingredient.DisplayQuantity = roundKitchenQuantity(quantity, unit)
+		ingredient.Unit = unit
+	}
+
+	if scaleTools {
+		for i := range recipe.RecipeToolData {
+			tool := &recipe.RecipeToolData[i]
+			tool.Quantity = int(math.Max(1, math.Ceil(float64(tool.Quantity)*factor)))
+		}
+	}
+
+	recipe.Scaling = &RecipeScaling{
+		OriginalServings: recipe.RecipeData.Servings,
+		Servings:         servings,
+		Factor:           math.Round(factor*1000) / 1000,
+		ToolsScaled:      scaleTools,
+	}
+	recipe.RecipeData.Servings = servings
+
+	return nil
+}
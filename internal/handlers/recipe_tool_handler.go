@@ -11,6 +11,7 @@ import (
 )
 
 type RecipeToolData struct {
+	ID       int    `json:"id"`
 	ToolID   int    `json:"tool_id"`
 	Quantity int    `json:"quantity"`
 	ToolName string `json:"tool_name"`
@@ -19,22 +20,115 @@ type RecipeToolData struct {
 
 func insertRecipeTools(ctx context.Context, tx pgx.Tx, recipeID int, tools []RecipeToolData) error {
 	for _, tool := range tools {
-		_, err := tx.Exec(ctx, `
-            INSERT INTO recipe_tool (recipe_id, tool_id, quantity)
-            VALUES ($1, $2, $3)
-        `, recipeID, tool.ToolID, tool.Quantity)
-		if err != nil {
+		if _, err := insertRecipeTool(ctx, tx, recipeID, tool); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func insertRecipeTool(ctx context.Context, tx pgx.Tx, recipeID int, tool RecipeToolData) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO recipe_tool (recipe_id, tool_id, quantity)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, recipeID, tool.ToolID, tool.Quantity).Scan(&id)
+	return id, err
+}
+
+// updateRecipeTools makes the recipe's tool rows match the given list: rows with an ID are
+// updated, rows without one are inserted and stored rows missing from the list are deleted
+func updateRecipeTools(ctx context.Context, tx pgx.Tx, recipeID int, tools []RecipeToolData) error {
+	keepIDs := make([]int, 0, len(tools))
+	catalogIDs := make([]int, 0, len(tools))
+	for _, tool := range tools {
+		if tool.ID != 0 {
+			keepIDs = append(keepIDs, tool.ID)
+		}
+		catalogIDs = append(catalogIDs, tool.ToolID)
+	}
+	if err := checkCatalogItemsExist(ctx, tx, "tool", catalogIDs); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `DELETE FROM recipe_tool WHERE recipe_id = $1 AND NOT (id = ANY($2))`, recipeID, keepIDs)
+	if err != nil {
+		return err
+	}
+
+	var newTools []RecipeToolData
+	for _, tool := range tools {
+		if tool.ID == 0 {
+			newTools = append(newTools, tool)
+			continue
+		}
+
+		result, err := tx.Exec(ctx, `
+			UPDATE recipe_tool SET tool_id = $1, quantity = $2
+			WHERE id = $3 AND recipe_id = $4
+		`, tool.ToolID, tool.Quantity, tool.ID, recipeID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return invalidRecipeChildError{Kind: "recipe tool", ID: tool.ID}
+		}
+	}
+
+	return insertRecipeTools(ctx, tx, recipeID, newTools)
+}
+
+func ListRecipeTools(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipe, ok := listRecipeChildren(c, db)
+		if !ok {
+			return
+		}
+
+		tools := recipe.RecipeToolData
+		if tools == nil {
+			tools = []RecipeToolData{}
+		}
+		c.JSON(http.StatusOK, tools)
+	}
+}
+
+func AddRecipeTool(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RecipeToolData
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.ToolID == 0 || req.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tool_id and a positive quantity are required"})
+			return
+		}
+
+		var id int
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			if err := checkCatalogItemsExist(c, tx, "tool", []int{req.ToolID}); err != nil {
+				return err
+			}
+			var err error
+			id, err = insertRecipeTool(c, tx, recipeID, req)
+			return err
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "version": version, "message": "Recipe tool added successfully"})
+	}
+}
+
 func UpdateRecipeTool(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		recipeID, err := strconv.Atoi(c.Param("recipe_id"))
+		itemID, err := strconv.Atoi(c.Param("item_id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe tool ID"})
 			return
 		}
 
@@ -44,12 +138,57 @@ func UpdateRecipeTool(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(c, `UPDATE recipe_tool SET quantity = $1 WHERE recipe_id = $2 AND tool_id = $3`, req.Quantity, recipeID, req.ToolID)
+		if req.ToolID == 0 || req.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tool_id and a positive quantity are required"})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			if err := checkCatalogItemsExist(c, tx, "tool", []int{req.ToolID}); err != nil {
+				return err
+			}
+			result, err := tx.Exec(c, `
+				UPDATE recipe_tool SET tool_id = $1, quantity = $2
+				WHERE id = $3 AND recipe_id = $4
+			`, req.ToolID, req.Quantity, itemID, recipeID)
+			if err != nil {
+				return err
+			}
+			if result.RowsAffected() == 0 {
+				return errRecipeChildNotFound
+			}
+			return nil
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe tool updated successfully"})
+	}
+}
+
+func RemoveRecipeTool(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("item_id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe tool"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe tool ID"})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			result, err := tx.Exec(c, `DELETE FROM recipe_tool WHERE id = $1 AND recipe_id = $2`, itemID, recipeID)
+			if err != nil {
+				return err
+			}
+			if result.RowsAffected() == 0 {
+				return errRecipeChildNotFound
+			}
+			return nil
+		})
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Recipe tool updated successfully"})
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe tool removed successfully"})
 	}
 }
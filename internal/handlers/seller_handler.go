@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// defaultDashboardDays is the dashboard period when ?from is not given
+	defaultDashboardDays = 30
+	// maxDashboardDays bounds the dashboard period so a single request cannot scan years of orders
+	maxDashboardDays       = 366
+	defaultLowStock        = 5
+	defaultTopProducts     = 5
+	maxTopProducts         = 50
+	dashboardIntervalDay   = "day"
+	dashboardIntervalWeek  = "week"
+	dashboardIntervalMonth = "month"
+)
+
+type SellerProfile struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Fullname string `json:"fullname"`
+}
+
+// SellerRating aggregates the top-level ratings of all of a seller's products
+type SellerRating struct {
+	Average *float64 `json:"average"`
+	Count   int      `json:"count"`
+}
+
+type SellerStorefront struct {
+	Seller   SellerProfile `json:"seller"`
+	Rating   SellerRating  `json:"rating"`
+	Products []Products    `json:"products"`
+}
+
+// SellerSales totals placed orders containing the seller's products.
+// Revenue is the seller's line totals before order-level coupons, one entry per currency.
+type SellerSales struct {
+	Orders  int     `json:"orders"`
+	Units   int     `json:"units"`
+	Revenue []Money `json:"revenue"`
+}
+
+type SellerRevenuePoint struct {
+	Period  time.Time `json:"period"`
+	Orders  int       `json:"orders"`
+	Units   int       `json:"units"`
+	Revenue Money     `json:"revenue"`
+}
+
+type SellerTopProduct struct {
+	ProductID int    `json:"product_id"`
+	Title     string `json:"title"`
+	Units     int    `json:"units"`
+	Revenue   Money  `json:"revenue"`
+}
+
+type SellerRatingPoint struct {
+	Period  time.Time `json:"period"`
+	Average float64   `json:"average"`
+	Count   int       `json:"count"`
+}
+
+type SellerDashboard struct {
+	From              string               `json:"from"`
+	To                string               `json:"to"`
+	Interval          string               `json:"interval"`
+	Sales             SellerSales          `json:"sales"`
+	Revenue           []SellerRevenuePoint `json:"revenue"`
+	TopProducts       []SellerTopProduct   `json:"top_products"`
+	LowStockThreshold int                  `json:"low_stock_threshold"`
+	LowStock          []Products           `json:"low_stock"`
+	Ratings           []SellerRatingPoint  `json:"ratings"`
+}
+
+// sellerRating averages the top-level ratings of the seller's products
+func sellerRating(ctx context.Context, q querier, sellerID int) (SellerRating, error) {
+	var rating SellerRating
+	err := q.QueryRow(ctx, `
+		SELECT ROUND(AVG(r.rating), 2)::float8, COUNT(r.id)
+		FROM product_rating r
+		JOIN products p ON p.id = r.product_id
+		WHERE p.seller_id = $1 AND r.reply_id IS NULL
+	`, sellerID).Scan(&rating.Average, &rating.Count)
+	return rating, err
+}
+
+// GetSellerStorefront returns a seller's profile, the aggregate rating of their products and their active products,
+// with sale prices and variant price ranges, sorted according to ?sort
+func GetSellerStorefront(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sellerID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seller ID"})
+			return
+		}
+
+		storefront := SellerStorefront{Seller: SellerProfile{ID: sellerID}}
+		err = db.QueryRow(c, `SELECT username, fullname FROM users WHERE id = $1`, sellerID).
+			Scan(&storefront.Seller.Username, &storefront.Seller.Fullname)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Seller not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch seller"})
+			return
+		}
+
+		if storefront.Rating, err = sellerRating(c, db, sellerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch seller rating"})
+			return
+		}
+
+		rows, err := db.Query(c, `SELECT `+productColumns+` FROM products WHERE seller_id = $1 AND is_active ORDER BY id`, sellerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+			return
+		}
+		if storefront.Products, err = scanProducts(rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
+			return
+		}
+		if err := decorateProducts(c, db, storefront.Products); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price products"})
+			return
+		}
+		if !sortProducts(c, storefront.Products) {
+			return
+		}
+
+		c.JSON(http.StatusOK, storefront)
+	}
+}
+
+// dashboardPeriod reads ?from and ?to (YYYY-MM-DD, both inclusive) and ?interval, defaulting to the last 30 days by day.
+// The returned end is exclusive.
+func dashboardPeriod(c *gin.Context) (from, to time.Time, interval string, err error) {
+	to = time.Now().UTC().Truncate(24 * time.Hour)
+	if value := c.Query("to"); value != "" {
+		if to, err = parseMealPlanDate(value); err != nil {
+			return
+		}
+	}
+	from = to.AddDate(0, 0, -(defaultDashboardDays - 1))
+	if value := c.Query("from"); value != "" {
+		if from, err = parseMealPlanDate(value); err != nil {
+			return
+		}
+	}
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) {
+		err = errors.New("from must not be after to")
+		return
+	}
+	if to.Sub(from) > maxDashboardDays*24*time.Hour {
+		err = fmt.Errorf("the period cannot be longer than %d days", maxDashboardDays)
+		return
+	}
+
+	interval = c.DefaultQuery("interval", dashboardIntervalDay)
+	switch interval {
+	case dashboardIntervalDay, dashboardIntervalWeek, dashboardIntervalMonth:
+	default:
+		err = fmt.Errorf("unknown interval %q, expected day, week or month", interval)
+	}
+	return
+}
+
+// queryIntInRange reads an optional integer query parameter between minimum and maximum, returning fallback when it is absent
+func queryIntInRange(c *gin.Context, name string, fallback, minimum, maximum int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minimum || n > maximum {
+		return 0, fmt.Errorf("%s must be a number between %d and %d", name, minimum, maximum)
+	}
+	return n, nil
+}
+
+// sellerRevenue returns the seller's placed sales per period and currency, along with the totals over the whole period.
+// Every order is placed in exactly one period and currency, so order counts add up across periods.
+func sellerRevenue(ctx context.Context, q querier, sellerID int, from, to time.Time, interval string) ([]SellerRevenuePoint, SellerSales, error) {
+	sales := SellerSales{Revenue: []Money{}}
+	rows, err := q.Query(ctx, `
+		SELECT date_trunc($4, o.placed_at), o.currency, COUNT(DISTINCT o.id), SUM(oi.quantity), SUM(oi.line_total)
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		WHERE oi.seller_id = $1 AND o.status = $5 AND o.placed_at >= $2 AND o.placed_at < $3
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, sellerID, from, to, interval, orderStatusPlaced)
+	if err != nil {
+		return nil, sales, err
+	}
+	defer rows.Close()
+
+	points := []SellerRevenuePoint{}
+	totals := make(map[string]int)
+	for rows.Next() {
+		var point SellerRevenuePoint
+		var currency string
+		var revenue pgtype.Numeric
+		if err := rows.Scan(&point.Period, &currency, &point.Orders, &point.Units, &revenue); err != nil {
+			return nil, sales, err
+		}
+		if point.Revenue, err = moneyFromNumeric(revenue, currency); err != nil {
+			return nil, sales, err
+		}
+		points = append(points, point)
+
+		sales.Orders += point.Orders
+		sales.Units += point.Units
+		i, ok := totals[point.Revenue.Currency]
+		if !ok {
+			i = len(sales.Revenue)
+			totals[point.Revenue.Currency] = i
+			sales.Revenue = append(sales.Revenue, Money{Currency: point.Revenue.Currency})
+		}
+		sales.Revenue[i].Amount += point.Revenue.Amount
+	}
+	return points, sales, rows.Err()
+}
+
+// sellerTopProducts returns the seller's best selling products of the period by units, under their latest ordered title
+func sellerTopProducts(ctx context.Context, q querier, sellerID int, from, to time.Time, limit int) ([]SellerTopProduct, error) {
+	rows, err := q.Query(ctx, `
+		SELECT oi.product_id, (array_agg(oi.title ORDER BY o.placed_at DESC))[1], o.currency, SUM(oi.quantity), SUM(oi.line_total)
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		WHERE oi.seller_id = $1 AND o.status = $4 AND o.placed_at >= $2 AND o.placed_at < $3
+		GROUP BY oi.product_id, o.currency
+		ORDER BY SUM(oi.quantity) DESC, SUM(oi.line_total) DESC, oi.product_id
+		LIMIT $5
+	`, sellerID, from, to, orderStatusPlaced, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []SellerTopProduct{}
+	for rows.Next() {
+		var product SellerTopProduct
+		var currency string
+		var revenue pgtype.Numeric
+		if err := rows.Scan(&product.ProductID, &product.Title, &currency, &product.Units, &revenue); err != nil {
+			return nil, err
+		}
+		if product.Revenue, err = moneyFromNumeric(revenue, currency); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// sellerRatingTrend averages the top-level ratings of the seller's products per period
+func sellerRatingTrend(ctx context.Context, q querier, sellerID int, from, to time.Time, interval string) ([]SellerRatingPoint, error) {
+	rows, err := q.Query(ctx, `
+		SELECT date_trunc($4, r.created_at), ROUND(AVG(r.rating), 2)::float8, COUNT(*)
+		FROM product_rating r
+		JOIN products p ON p.id = r.product_id
+		WHERE p.seller_id = $1 AND r.reply_id IS NULL AND r.created_at >= $2 AND r.created_at < $3
+		GROUP BY 1
+		ORDER BY 1
+	`, sellerID, from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []SellerRatingPoint{}
+	for rows.Next() {
+		var point SellerRatingPoint
+		if err := rows.Scan(&point.Period, &point.Average, &point.Count); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// GetSellerDashboard returns the authenticated seller's sales, revenue over time, top products, low-stock products
+// and rating trend. ?from and ?to (YYYY-MM-DD) bound the period, ?interval groups it by day, week or month,
+// ?low_stock sets the available stock at or below which active products are flagged and ?top the number of top products.
+func GetSellerDashboard(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+		sellerID := userID.(int)
+
+		from, to, interval, err := dashboardPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		threshold, err := queryIntInRange(c, "low_stock", defaultLowStock, 0, maxCartItemQuantity)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		top, err := queryIntInRange(c, "top", defaultTopProducts, 1, maxTopProducts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		dashboard := SellerDashboard{
+			From:              from.Format(mealPlanDateLayout),
+			To:                to.AddDate(0, 0, -1).Format(mealPlanDateLayout),
+			Interval:          interval,
+			LowStockThreshold: threshold,
+		}
+
+		if dashboard.Revenue, dashboard.Sales, err = sellerRevenue(c, db, sellerID, from, to, interval); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute sales"})
+			return
+		}
+		if dashboard.TopProducts, err = sellerTopProducts(c, db, sellerID, from, to, top); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute top products"})
+			return
+		}
+
+		rows, err := db.Query(c, `SELECT `+productColumns+` FROM products
+			WHERE seller_id = $1 AND is_active AND `+availableStock("products")+` <= $2
+			ORDER BY `+availableStock("products")+`, id`, sellerID, threshold)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve low-stock products"})
+			return
+		}
+		if dashboard.LowStock, err = scanProducts(rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
+			return
+		}
+
+		if dashboard.Ratings, err = sellerRatingTrend(c, db, sellerID, from, to, interval); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute rating trend"})
+			return
+		}
+
+		c.JSON(http.StatusOK, dashboard)
+	}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxShoppingListProducts is how many product suggestions are returned per shopping list line
+const maxShoppingListProducts = 3
+
+type ShoppingListRecipe struct {
+	RecipeID int `json:"recipe_id" binding:"required"`
+	// Servings defaults to the recipe's own servings
+	Servings int `json:"servings" binding:"min=0"`
+}
+
+type ShoppingListRequest struct {
+	Recipes    []ShoppingListRecipe `json:"recipes" binding:"dive"`
+	MealPlanID int                  `json:"meal_plan_id"`
+	// UsePantry defaults to true; set it to false to list everything the recipes need
+	UsePantry *bool `json:"use_pantry"`
+	AddToCart bool  `json:"add_to_cart"`
+}
+
+type ShoppingListProduct struct {
+	ID       int    `json:"id"`
+	SellerID int    `json:"seller_id"`
+	Title    string `json:"title"`
+	Price    Money  `json:"price"`
+	Stock    int    `json:"stock"`
+	// Rating is the product's average rating, absent when it has not been rated
+	Rating        *float64 `json:"rating,omitempty"`
+	PackQuantity  *float64 `json:"pack_quantity,omitempty"`
+	PackUnit      string   `json:"pack_unit,omitempty"`
+	UnitPrice     *Money   `json:"unit_price,omitempty"`
+	UnitPriceUnit string   `json:"unit_price_unit,omitempty"`
+	// CartQuantity is how many of the product cover the line
+	CartQuantity int `json:"cart_quantity"`
+}
+
+type ShoppingListItem struct {
+	IngredientID     int     `json:"ingredient_id"`
+	IngredientName   string  `json:"ingredient_name"`
+	Unit             string  `json:"unit"`
+	RequiredQuantity float64 `json:"required_quantity"`
+	PantryQuantity   float64 `json:"pantry_quantity"`
+	Quantity         float64 `json:"quantity"`
+	// DisplayQuantity and DisplayUnit express Quantity the way it would be bought, e.g. 1.5 kg rather than 1500 g
+	DisplayQuantity string                `json:"display_quantity"`
+	DisplayUnit     string                `json:"display_unit"`
+	RecipeIDs       []int                 `json:"recipe_ids"`
+	Products        []ShoppingListProduct `json:"products"`
+}
+
+type ShoppingListCartItem struct {
+	IngredientID int `json:"ingredient_id"`
+	ProductID    int `json:"product_id"`
+	Quantity     int `json:"quantity"`
+}
+
+type ShoppingList struct {
+	Items           []ShoppingListItem `json:"items"`
+	CoveredByPantry []ShoppingListItem `json:"covered_by_pantry"`
+	// AddedToCart lists the products put in the cart when add_to_cart was requested
+	AddedToCart []ShoppingListCartItem `json:"added_to_cart,omitempty"`
+	// Unavailable lists ingredients that had to be bought but no product is on sale for, or could not be added to the cart
+	Unavailable []int `json:"unavailable,omitempty"`
+}
+
+var errShoppingListRecipeNotFound = errors.New("recipe not found")
+
+// mealPlanShoppingRecipes returns the recipes and servings planned in one of the user's meal plans
+func mealPlanShoppingRecipes(ctx context.Context, q querier, userID, mealPlanID int) ([]ShoppingListRecipe, error) {
+	var exists bool
+	if err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM meal_plans WHERE id = $1 AND user_id = $2)`, mealPlanID, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, pgx.ErrNoRows
+	}
+
+	rows, err := q.Query(ctx, `SELECT recipe_id, servings FROM meal_plan_entries WHERE meal_plan_id = $1 ORDER BY date, id`, mealPlanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipes []ShoppingListRecipe
+	for rows.Next() {
+		var recipe ShoppingListRecipe
+		if err := rows.Scan(&recipe.RecipeID, &recipe.Servings); err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	return recipes, rows.Err()
+}
+
+// aggregateShoppingList scales each recipe to the requested servings and merges the ingredients they share.
+// Recipe quantities are stored in the ingredient's own unit, so merging is a plain sum per ingredient.
+func aggregateShoppingList(ctx context.Context, q querier, userID int, recipes []ShoppingListRecipe) ([]ShoppingListItem, error) {
+	byIngredient := make(map[int]*ShoppingListItem)
+	var order []int
+	for _, selected := range recipes {
+		recipe, err := fetchRecipe(ctx, q, selected.RecipeID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !recipe.RecipeData.IsPublic && recipe.RecipeData.UserID != userID) {
+			return nil, fmt.Errorf("%w: %d", errShoppingListRecipeNotFound, selected.RecipeID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		factor := 1.0
+		if selected.Servings > 0 && recipe.RecipeData.Servings > 0 {
+			factor = float64(selected.Servings) / float64(recipe.RecipeData.Servings)
+		}
+
+		for _, ingredient := range recipe.RecipeIngredientData {
+			item, ok := byIngredient[ingredient.IngredientID]
+			if !ok {
+				item = &ShoppingListItem{
+					IngredientID:   ingredient.IngredientID,
+					IngredientName: ingredient.IngredientName,
+					Unit:           ingredient.Unit,
+					RecipeIDs:      []int{},
+					Products:       []ShoppingListProduct{},
+				}
+				byIngredient[ingredient.IngredientID] = item
+				order = append(order, ingredient.IngredientID)
+			}
+
+			quantity := ingredient.Quantity
+			if !ingredient.NonScalable {
+				quantity *= factor
+			}
+			item.RequiredQuantity += quantity
+			if !slices.Contains(item.RecipeIDs, selected.RecipeID) {
+				item.RecipeIDs = append(item.RecipeIDs, selected.RecipeID)
+			}
+		}
+	}
+
+	items := make([]ShoppingListItem, 0, len(order))
+	for _, id := range order {
+		items = append(items, *byIngredient[id])
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].IngredientName < items[j].IngredientName })
+	return items, nil
+}
+
+// loadPantryQuantities totals the user's unexpired pantry stock of each ingredient, converted to the given units.
+// Pantry rows whose unit cannot be converted are ignored rather than guessed at.
+func loadPantryQuantities(ctx context.Context, q querier, userID int, units map[int]string) (map[int]float64, error) {
+	ids := make([]int, 0, len(units))
+	for id := range units {
+		ids = append(ids, id)
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT ingredient_id, quantity, unit
+		FROM pantry_items
+		WHERE user_id = $1 AND ingredient_id = ANY($2) AND (expires_on IS NULL OR expires_on >= CURRENT_DATE)
+	`, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]float64)
+	for rows.Next() {
+		var ingredientID int
+		var quantity float64
+		var unit string
+		if err := rows.Scan(&ingredientID, &quantity, &unit); err != nil {
+			return nil, err
+		}
+		if converted, ok := convertQuantity(quantity, unit, units[ingredientID]); ok {
+			quantities[ingredientID] += converted
+		}
+	}
+	return quantities, rows.Err()
+}
+
+// CreateShoppingListFromRecipes builds a shopping list for the selected recipes and/or a meal plan,
+// subtracting what is already in the user's pantry and suggesting products for each remaining line.
+// With add_to_cart the cheapest product of every line is put in the cart, as many packs as the line needs.
+func CreateShoppingListFromRecipes(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var req ShoppingListRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Recipes) == 0 && req.MealPlanID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Select at least one recipe or a meal plan"})
+			return
+		}
+
+		recipes := req.Recipes
+		if req.MealPlanID != 0 {
+			planned, err := mealPlanShoppingRecipes(c, db, userID.(int), req.MealPlanID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+				return
+			}
+			recipes = append(recipes, planned...)
+		}
+
+		items, err := aggregateShoppingList(c, db, userID.(int), recipes)
+		if errors.Is(err, errShoppingListRecipeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipes"})
+			return
+		}
+
+		units := make(map[int]string, len(items))
+		for _, item := range items {
+			units[item.IngredientID] = item.Unit
+		}
+		pantry := map[int]float64{}
+		if req.UsePantry == nil || *req.UsePantry {
+			pantry, err = loadPantryQuantities(c, db, userID.(int), units)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+				return
+			}
+		}
+
+		list := ShoppingList{Items: []ShoppingListItem{}, CoveredByPantry: []ShoppingListItem{}}
+		var needed []int
+		for _, item := range items {
+			item.RequiredQuantity = math.Round(item.RequiredQuantity*1000) / 1000
+			item.PantryQuantity = math.Round(math.Min(pantry[item.IngredientID], item.RequiredQuantity)*1000) / 1000
+			item.Quantity = math.Round((item.RequiredQuantity-item.PantryQuantity)*1000) / 1000
+			if item.Quantity <= 0 {
+				item.Quantity = 0
+				list.CoveredByPantry = append(list.CoveredByPantry, item)
+				continue
+			}
+
+			quantity, unit := toKitchenUnit(item.Quantity, item.Unit)
+			_, item.DisplayQuantity = roundKitchenQuantity(quantity, unit)
+			item.DisplayUnit = unit
+			list.Items = append(list.Items, item)
+			needed = append(needed, item.IngredientID)
+		}
+
+		products, err := loadIngredientProducts(c, db, needed, productStrategyCheapest, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+			return
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			suggestions := products[item.IngredientID]
+			if len(suggestions) == 0 {
+				list.Unavailable = append(list.Unavailable, item.IngredientID)
+				continue
+			}
+			suggestions = productsForQuantity(suggestions, item.Quantity, item.Unit, true)
+			item.Products = suggestions[:min(len(suggestions), maxShoppingListProducts)]
+		}
+
+		if req.AddToCart {
+			tx, err := db.Begin(c)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+				return
+			}
+			defer tx.Rollback(c)
+
+			list.AddedToCart = []ShoppingListCartItem{}
+			for _, item := range list.Items {
+				if len(item.Products) == 0 {
+					continue
+				}
+				cartItem := ShoppingListCartItem{IngredientID: item.IngredientID, ProductID: item.Products[0].ID, Quantity: item.Products[0].CartQuantity}
+				if err := addCartItem(c, tx, userID.(int), cartItem.ProductID, nil, cartItem.Quantity); err != nil {
+					if _, ok := cartErrorStatus(err); ok {
+						list.Unavailable = append(list.Unavailable, item.IngredientID)
+						continue
+					}
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add products to cart"})
+					return
+				}
+				list.AddedToCart = append(list.AddedToCart, cartItem)
+			}
+
+			if err := tx.Commit(c); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
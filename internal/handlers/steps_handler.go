@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
@@ -11,17 +14,142 @@ import (
 )
 
 type StepData struct {
-	StepNumber  int    `json:"step_number"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	ID              int      `json:"id"`
+	StepNumber      int      `json:"step_number"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	TimerLabel      string   `json:"timer_label"`
+	Temperature     *float64 `json:"temperature"`
+	TemperatureUnit string   `json:"temperature_unit"`
+	ImageURLs       []string `json:"image_urls"`
+	VideoURL        string   `json:"video_url"`
+	// Ingredients and tools used in the step, as recipe_ingredient / recipe_tool row IDs.
+	// IngredientIDs and ToolIDs are accepted on input to reference rows by their ingredient or tool.
+	RecipeIngredientIDs []int `json:"recipe_ingredient_ids"`
+	RecipeToolIDs       []int `json:"recipe_tool_ids"`
+	IngredientIDs       []int `json:"ingredient_ids,omitempty"`
+	ToolIDs             []int `json:"tool_ids,omitempty"`
+}
+
+type invalidStepError struct {
+	Reason string
+}
+
+func (e invalidStepError) Error() string {
+	return e.Reason
+}
+
+func validateStep(step *StepData) error {
+	if step.DurationSeconds != nil && *step.DurationSeconds < 0 {
+		return invalidStepError{Reason: "duration_seconds must not be negative"}
+	}
+	if step.TimerLabel != "" && step.DurationSeconds == nil {
+		return invalidStepError{Reason: "timer_label requires duration_seconds"}
+	}
+
+	step.TemperatureUnit = strings.ToUpper(strings.TrimSpace(step.TemperatureUnit))
+	if step.Temperature == nil {
+		step.TemperatureUnit = ""
+	} else if step.TemperatureUnit != "C" && step.TemperatureUnit != "F" {
+		return invalidStepError{Reason: "temperature_unit must be C or F"}
+	}
+
+	for _, url := range append(append([]string{}, step.ImageURLs...), step.VideoURL) {
+		if url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return invalidStepError{Reason: fmt.Sprintf("invalid media URL %q", url)}
+		}
+	}
+	if step.ImageURLs == nil {
+		step.ImageURLs = []string{}
+	}
+	return nil
 }
 
 func insertSteps(ctx context.Context, tx pgx.Tx, recipeID int, steps []StepData) error {
 	for _, step := range steps {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO steps (recipe_id, step_number, title, description)
-			VALUES ($1, $2, $3, $4)
-		`, recipeID, step.StepNumber, step.Title, step.Description)
+		if _, err := insertStep(ctx, tx, recipeID, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertStep(ctx context.Context, tx pgx.Tx, recipeID int, step StepData) (int, error) {
+	if err := validateStep(&step); err != nil {
+		return 0, err
+	}
+
+	var id int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO steps (recipe_id, step_number, title, description, duration_seconds, timer_label,
+		                   temperature, temperature_unit, image_urls, video_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, recipeID, step.StepNumber, step.Title, step.Description, step.DurationSeconds, step.TimerLabel,
+		step.Temperature, step.TemperatureUnit, step.ImageURLs, step.VideoURL).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, saveStepReferences(ctx, tx, recipeID, id, step)
+}
+
+// updateStepContent overwrites everything but the step number, which is managed by the ordering helpers
+func updateStepContent(ctx context.Context, tx pgx.Tx, recipeID, stepID int, step StepData) error {
+	if err := validateStep(&step); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE steps SET title = $1, description = $2, duration_seconds = $3, timer_label = $4,
+		temperature = $5, temperature_unit = $6, image_urls = $7, video_url = $8
+		WHERE id = $9 AND recipe_id = $10
+	`, step.Title, step.Description, step.DurationSeconds, step.TimerLabel,
+		step.Temperature, step.TemperatureUnit, step.ImageURLs, step.VideoURL, stepID, recipeID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return errRecipeChildNotFound
+	}
+
+	return saveStepReferences(ctx, tx, recipeID, stepID, step)
+}
+
+// saveStepReferences replaces the ingredient and tool links of a step after checking that every
+// referenced row belongs to the same recipe
+func saveStepReferences(ctx context.Context, tx pgx.Tx, recipeID, stepID int, step StepData) error {
+	ingredientRows, err := resolveStepReferences(ctx, tx, "recipe_ingredient", "ingredient_id", recipeID, step.RecipeIngredientIDs, step.IngredientIDs)
+	if err != nil {
+		return err
+	}
+	toolRows, err := resolveStepReferences(ctx, tx, "recipe_tool", "tool_id", recipeID, step.RecipeToolIDs, step.ToolIDs)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM step_ingredients WHERE step_id = $1`, stepID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM step_tools WHERE step_id = $1`, stepID); err != nil {
+		return err
+	}
+
+	if len(ingredientRows) > 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO step_ingredients (step_id, recipe_ingredient_id)
+			SELECT $1, unnest($2::int[])
+		`, stepID, ingredientRows)
+		if err != nil {
+			return err
+		}
+	}
+	if len(toolRows) > 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO step_tools (step_id, recipe_tool_id)
+			SELECT $1, unnest($2::int[])
+		`, stepID, toolRows)
 		if err != nil {
 			return err
 		}
@@ -29,11 +157,185 @@ func insertSteps(ctx context.Context, tx pgx.Tx, recipeID int, steps []StepData)
 	return nil
 }
 
+// resolveStepReferences turns row IDs and catalog IDs (ingredient or tool IDs) into a deduplicated list of
+// row IDs of the given child table, failing on the first reference that is not part of the recipe
+func resolveStepReferences(ctx context.Context, tx pgx.Tx, table, catalogColumn string, recipeID int, rowIDs, catalogIDs []int) ([]int, error) {
+	if len(rowIDs) == 0 && len(catalogIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id, `+catalogColumn+` FROM `+table+` WHERE recipe_id = $1`, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rowByID := make(map[int]bool)
+	rowByCatalogID := make(map[int]int)
+	for rows.Next() {
+		var id, catalogID int
+		if err := rows.Scan(&id, &catalogID); err != nil {
+			return nil, err
+		}
+		rowByID[id] = true
+		if _, seen := rowByCatalogID[catalogID]; !seen {
+			rowByCatalogID[catalogID] = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	resolved := make([]int, 0, len(rowIDs)+len(catalogIDs))
+	for _, id := range rowIDs {
+		if !rowByID[id] {
+			return nil, invalidRecipeChildError{Kind: strings.ReplaceAll(table, "_", " "), ID: id}
+		}
+		if !seen[id] {
+			seen[id] = true
+			resolved = append(resolved, id)
+		}
+	}
+	for _, catalogID := range catalogIDs {
+		id, ok := rowByCatalogID[catalogID]
+		if !ok {
+			return nil, invalidRecipeChildError{Kind: strings.TrimSuffix(catalogColumn, "_id"), ID: catalogID}
+		}
+		if !seen[id] {
+			seen[id] = true
+			resolved = append(resolved, id)
+		}
+	}
+	return resolved, nil
+}
+
+// detachRecipeChildren prepares a loaded recipe to be written again as new rows: child IDs are cleared and
+// step references are rewritten from row IDs to ingredient and tool IDs, which survive the copy
+func detachRecipeChildren(recipe *RecipeRequest) {
+	ingredientByRow := make(map[int]int, len(recipe.RecipeIngredientData))
+	for i := range recipe.RecipeIngredientData {
+		ingredientByRow[recipe.RecipeIngredientData[i].ID] = recipe.RecipeIngredientData[i].IngredientID
+		recipe.RecipeIngredientData[i].ID = 0
+	}
+	toolByRow := make(map[int]int, len(recipe.RecipeToolData))
+	for i := range recipe.RecipeToolData {
+		toolByRow[recipe.RecipeToolData[i].ID] = recipe.RecipeToolData[i].ToolID
+		recipe.RecipeToolData[i].ID = 0
+	}
+
+	for i := range recipe.StepsData {
+		step := &recipe.StepsData[i]
+		step.ID = 0
+		for _, rowID := range step.RecipeIngredientIDs {
+			if ingredientID, ok := ingredientByRow[rowID]; ok {
+				step.IngredientIDs = append(step.IngredientIDs, ingredientID)
+			}
+		}
+		for _, rowID := range step.RecipeToolIDs {
+			if toolID, ok := toolByRow[rowID]; ok {
+				step.ToolIDs = append(step.ToolIDs, toolID)
+			}
+		}
+		step.RecipeIngredientIDs, step.RecipeToolIDs = nil, nil
+	}
+}
+
+// updateSteps makes the recipe's steps match the given list: steps with an ID are
+// updated, steps without one are inserted and stored steps missing from the list are deleted
+func updateSteps(ctx context.Context, tx pgx.Tx, recipeID int, steps []StepData) error {
+	keepIDs := make([]int, 0, len(steps))
+	for _, step := range steps {
+		if step.ID != 0 {
+			keepIDs = append(keepIDs, step.ID)
+		}
+	}
+
+	_, err := tx.Exec(ctx, `DELETE FROM steps WHERE recipe_id = $1 AND NOT (id = ANY($2))`, recipeID, keepIDs)
+	if err != nil {
+		return err
+	}
+
+	var newSteps []StepData
+	for _, step := range steps {
+		if step.ID == 0 {
+			newSteps = append(newSteps, step)
+			continue
+		}
+
+		err := updateStepContent(ctx, tx, recipeID, step.ID, step)
+		if errors.Is(err, errRecipeChildNotFound) {
+			return invalidRecipeChildError{Kind: "step", ID: step.ID}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE steps SET step_number = $1 WHERE id = $2`, step.StepNumber, step.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return insertSteps(ctx, tx, recipeID, newSteps)
+}
+
+func ListRecipeSteps(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipe, ok := listRecipeChildren(c, db)
+		if !ok {
+			return
+		}
+
+		steps := recipe.StepsData
+		if steps == nil {
+			steps = []StepData{}
+		}
+		c.JSON(http.StatusOK, steps)
+	}
+}
+
+func AddRecipeStep(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req StepData
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+			return
+		}
+
+		var id int
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			order, err := loadStepOrder(c, tx, recipeID)
+			if err != nil {
+				return err
+			}
+
+			id, err = insertStep(c, tx, recipeID, req)
+			if err != nil {
+				return err
+			}
+
+			// Insert at the requested position, or append when none (or one past the end) is given
+			return renumberSteps(c, tx, recipeID, moveStep(order, id, req.StepNumber))
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": id, "version": version, "message": "Recipe step added successfully"})
+	}
+}
+
 func UpdateRecipeStep(db *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		recipeID, err := strconv.Atoi(c.Param("recipe_id"))
+		itemID, err := strconv.Atoi(c.Param("item_id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid step ID"})
 			return
 		}
 
@@ -43,12 +345,146 @@ func UpdateRecipeStep(db *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(c, `UPDATE steps SET title = $1, description = $2 WHERE recipe_id = $3 AND step_number = $4`, req.Title, req.Description, recipeID, req.StepNumber)
+		if req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			if err := updateStepContent(c, tx, recipeID, itemID, req); err != nil {
+				return err
+			}
+
+			if req.StepNumber == 0 {
+				return nil
+			}
+			order, err := loadStepOrder(c, tx, recipeID)
+			if err != nil {
+				return err
+			}
+			return renumberSteps(c, tx, recipeID, moveStep(order, itemID, req.StepNumber))
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe step updated successfully"})
+	}
+}
+
+func RemoveRecipeStep(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("item_id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe step"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid step ID"})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			result, err := tx.Exec(c, `DELETE FROM steps WHERE id = $1 AND recipe_id = $2`, itemID, recipeID)
+			if err != nil {
+				return err
+			}
+			if result.RowsAffected() == 0 {
+				return errRecipeChildNotFound
+			}
+
+			// Close the gap left by the removed step
+			order, err := loadStepOrder(c, tx, recipeID)
+			if err != nil {
+				return err
+			}
+			return renumberSteps(c, tx, recipeID, order)
+		})
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe step removed successfully"})
+	}
+}
+
+func ReorderRecipeSteps(db *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			StepIDs []int `json:"step_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		version, ok := modifyRecipeChildren(c, db, func(tx pgx.Tx, recipeID int) error {
+			order, err := loadStepOrder(c, tx, recipeID)
+			if err != nil {
+				return err
+			}
+
+			if len(order) != len(req.StepIDs) {
+				return errInvalidStepOrder
+			}
+			existing := make(map[int]bool, len(order))
+			for _, id := range order {
+				existing[id] = true
+			}
+			for _, id := range req.StepIDs {
+				if !existing[id] {
+					return errInvalidStepOrder
+				}
+				delete(existing, id)
+			}
+
+			return renumberSteps(c, tx, recipeID, req.StepIDs)
+		})
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Recipe step updated successfully"})
+		c.JSON(http.StatusOK, gin.H{"version": version, "message": "Recipe steps reordered successfully"})
+	}
+}
+
+// loadStepOrder returns the recipe's step IDs in their current order
+func loadStepOrder(ctx context.Context, tx pgx.Tx, recipeID int) ([]int, error) {
+	rows, err := tx.Query(ctx, `SELECT id FROM steps WHERE recipe_id = $1 ORDER BY step_number, id`, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// moveStep places stepID at the 1-based position in order; positions outside the list append it at the end
+func moveStep(order []int, stepID, position int) []int {
+	moved := make([]int, 0, len(order)+1)
+	for _, id := range order {
+		if id != stepID {
+			moved = append(moved, id)
+		}
+	}
+
+	if position < 1 || position > len(moved) {
+		return append(moved, stepID)
 	}
+	moved = append(moved[:position-1], append([]int{stepID}, moved[position-1:]...)...)
+	return moved
+}
+
+// renumberSteps gives the steps gapless step numbers starting at 1 in the given order
+func renumberSteps(ctx context.Context, tx pgx.Tx, recipeID int, orderedIDs []int) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE steps SET step_number = ordered.position
+		FROM unnest($2::int[]) WITH ORDINALITY AS ordered(id, position)
+		WHERE steps.id = ordered.id AND steps.recipe_id = $1
+	`, recipeID, orderedIDs)
+	return err
 }
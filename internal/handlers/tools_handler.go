@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"foocipe-recipe-service/internal/config"
 	"net/http"
@@ -181,8 +182,8 @@ func DeleteTool(db *pgxpool.Pool) gin.HandlerFunc {
 	}
 }
 
-func GetToolByID(db *pgxpool.Pool, toolID int) func(*gin.Context) (Tools, error) {
-	return func(c *gin.Context) (Tools, error) {
+func GetToolByID(db *pgxpool.Pool, toolID int) func(context.Context) (Tools, error) {
+	return func(ctx context.Context) (Tools, error) {
 		var tool Tools
 		query := `
 			SELECT id, name, category, sub_categories, description, image_urls, unit
@@ -190,7 +191,7 @@ func GetToolByID(db *pgxpool.Pool, toolID int) func(*gin.Context) (Tools, error)
 			WHERE id = $1
 		`
 
-		err := db.QueryRow(c, query, toolID).Scan(
+		err := db.QueryRow(ctx, query, toolID).Scan(
 			&tool.ID,
 			&tool.Name,
 			&tool.Category,
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	unitDimensionMass   = "mass"
+	unitDimensionVolume = "volume"
+	unitDimensionCount  = "count"
+)
+
+type unitInfo struct {
+	Name      string
+	Dimension string
+	// ToBase is the factor converting one of this unit into grams (mass) or millilitres (volume)
+	ToBase float64
+}
+
+var knownUnits = map[string]unitInfo{
+	"mg":   {Name: "mg", Dimension: unitDimensionMass, ToBase: 0.001},
+	"g":    {Name: "g", Dimension: unitDimensionMass, ToBase: 1},
+	"kg":   {Name: "kg", Dimension: unitDimensionMass, ToBase: 1000},
+	"oz":   {Name: "oz", Dimension: unitDimensionMass, ToBase: 28.3495},
+	"lb":   {Name: "lb", Dimension: unitDimensionMass, ToBase: 453.592},
+	"ml":   {Name: "ml", Dimension: unitDimensionVolume, ToBase: 1},
+	"l":    {Name: "l", Dimension: unitDimensionVolume, ToBase: 1000},
+	"tsp":  {Name: "tsp", Dimension: unitDimensionVolume, ToBase: 4.92892},
+	"tbsp": {Name: "tbsp", Dimension: unitDimensionVolume, ToBase: 14.7868},
+	"cup":  {Name: "cup", Dimension: unitDimensionVolume, ToBase: 236.588},
+	"floz": {Name: "fl oz", Dimension: unitDimensionVolume, ToBase: 29.5735},
+	// A lạng is the traditional Vietnamese 100 g measure still used at markets
+	"lạng": {Name: "lạng", Dimension: unitDimensionMass, ToBase: 100},
+}
+
+var unitAliases = map[string]string{
+	"milligram":   "mg",
+	"milligrams":  "mg",
+	"gram":        "g",
+	"grams":       "g",
+	"gr":          "g",
+	"kilogram":    "kg",
+	"kilograms":   "kg",
+	"kgs":         "kg",
+	"ounce":       "oz",
+	"ounces":      "oz",
+	"pound":       "lb",
+	"pounds":      "lb",
+	"lbs":         "lb",
+	"millilitre":  "ml",
+	"millilitres": "ml",
+	"milliliter":  "ml",
+	"milliliters": "ml",
+	"litre":       "l",
+	"litres":      "l",
+	"liter":       "l",
+	"liters":      "l",
+	"teaspoon":    "tsp",
+	"teaspoons":   "tsp",
+	"tablespoon":  "tbsp",
+	"tablespoons": "tbsp",
+	"tbs":         "tbsp",
+	"cups":        "cup",
+	"fl oz":       "floz",
+	"fl. oz":      "floz",
+	"fluid ounce": "floz",
+
+	"gam":          "g",
+	"ký":           "kg",
+	"kí":           "kg",
+	"cân":          "kg",
+	"lít":          "l",
+	"muỗng canh":   "tbsp",
+	"thìa canh":    "tbsp",
+	"muong canh":   "tbsp",
+	"muỗng cà phê": "tsp",
+	"thìa cà phê":  "tsp",
+	"muỗng cafe":   "tsp",
+	"thìa cafe":    "tsp",
+	"muong ca phe": "tsp",
+	"lang":         "lạng",
+}
+
+// lookupUnit resolves a free-form unit name to a known unit, if any
+func lookupUnit(unit string) (unitInfo, bool) {
+	key := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(unit), ".")))
+	if alias, ok := unitAliases[key]; ok {
+		key = alias
+	}
+	info, ok := knownUnits[key]
+	return info, ok
+}
+
+// normalizeUnit returns the canonical spelling of a unit, or the trimmed input when it is not known
+func normalizeUnit(unit string) string {
+	if info, ok := lookupUnit(unit); ok {
+		return info.Name
+	}
+	return strings.TrimSpace(unit)
+}
+
+// unitDimension reports whether a unit measures mass, volume or a count of items
+func unitDimension(unit string) string {
+	if info, ok := lookupUnit(unit); ok {
+		return info.Dimension
+	}
+	return unitDimensionCount
+}
+
+// convertQuantity converts a quantity between two units of the same dimension
+func convertQuantity(quantity float64, from, to string) (float64, bool) {
+	fromInfo, fromOK := lookupUnit(from)
+	toInfo, toOK := lookupUnit(to)
+	if !fromOK || !toOK {
+		if strings.EqualFold(strings.TrimSpace(from), strings.TrimSpace(to)) {
+			return quantity, true
+		}
+		return 0, false
+	}
+	if fromInfo.Dimension != toInfo.Dimension {
+		return 0, false
+	}
+	return quantity * fromInfo.ToBase / toInfo.ToBase, true
+}
+
+// toKitchenUnit moves a quantity to the unit a cook would naturally use for it, e.g. 1000 g -> 1 kg
+func toKitchenUnit(quantity float64, unit string) (float64, string) {
+	info, ok := lookupUnit(unit)
+	if !ok {
+		return quantity, unit
+	}
+
+	switch info.Name {
+	case "mg":
+		if quantity >= 1000 {
+			return toKitchenUnit(quantity/1000, "g")
+		}
+	case "g":
+		if quantity >= 1000 {
+			return quantity / 1000, "kg"
+		}
+		if quantity < 1 {
+			return quantity * 1000, "mg"
+		}
+	case "kg":
+		if quantity < 1 {
+			return quantity * 1000, "g"
+		}
+	case "ml":
+		if quantity >= 1000 {
+			return quantity / 1000, "l"
+		}
+	case "l":
+		if quantity < 1 {
+			return quantity * 1000, "ml"
+		}
+	case "tsp":
+		if quantity >= 3 {
+			return toKitchenUnit(quantity/3, "tbsp")
+		}
+	case "tbsp":
+		if quantity >= 4 {
+			return quantity / 16, "cup"
+		}
+		if quantity < 1 {
+			return quantity * 3, "tsp"
+		}
+	case "cup":
+		if quantity < 0.25 {
+			return toKitchenUnit(quantity*16, "tbsp")
+		}
+	}
+	return quantity, info.Name
+}
+
+var kitchenFractions = []struct {
+	value  float64
+	symbol string
+}{
+	{0, ""},
+	{1.0 / 8, "⅛"},
+	{1.0 / 4, "¼"},
+	{1.0 / 3, "⅓"},
+	{1.0 / 2, "½"},
+	{2.0 / 3, "⅔"},
+	{3.0 / 4, "¾"},
+	{1, ""},
+}
+
+// roundKitchenQuantity rounds a quantity the way it would be measured in a kitchen and returns
+// both the rounded value and its display form (e.g. 0.33 tsp -> 0.333, "⅓")
+func roundKitchenQuantity(quantity float64, unit string) (float64, string) {
+	if quantity <= 0 {
+		return 0, "0"
+	}
+
+	switch normalizeUnit(unit) {
+	case "mg", "g", "ml":
+		if quantity < 10 {
+			rounded := math.Round(quantity*10) / 10
+			return rounded, formatDecimal(rounded)
+		}
+		rounded := math.Round(quantity)
+		return rounded, formatDecimal(rounded)
+	case "kg", "l":
+		rounded := math.Round(quantity*100) / 100
+		return rounded, formatDecimal(rounded)
+	}
+
+	whole := math.Floor(quantity)
+	remainder := quantity - whole
+	best := kitchenFractions[0]
+	for _, fraction := range kitchenFractions[1:] {
+		if math.Abs(remainder-fraction.value) < math.Abs(remainder-best.value) {
+			best = fraction
+		}
+	}
+	if best.value == 1 {
+		whole++
+		best = kitchenFractions[0]
+	}
+	// Never round a present ingredient away entirely
+	if whole == 0 && best.value == 0 {
+		best = kitchenFractions[1]
+	}
+
+	rounded := math.Round((whole+best.value)*1000) / 1000
+	switch {
+	case whole == 0:
+		return rounded, best.symbol
+	case best.symbol == "":
+		return rounded, strconv.Itoa(int(whole))
+	default:
+		return rounded, fmt.Sprintf("%d %s", int(whole), best.symbol)
+	}
+}
+
+func formatDecimal(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"foocipe-recipe-service/internal/handlers"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RunProductScheduler applies the scheduled publish and unpublish times of products, once at start and then
+// every interval until ctx is cancelled
+func RunProductScheduler(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, archived, err := handlers.ApplyProductSchedules(ctx, db)
+		if err != nil {
+			log.Printf("Failed to apply product schedules: %v", err)
+		}
+		if published > 0 || archived > 0 {
+			log.Printf("Published %d and archived %d scheduled products", published, archived)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"foocipe-recipe-service/internal/handlers"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RunReservationSweeper expires abandoned checkouts and releases the stock they reserved, once at start and then
+// every interval until ctx is cancelled
+func RunReservationSweeper(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := handlers.ReleaseExpiredReservations(ctx, db)
+		if err != nil {
+			log.Printf("Failed to release expired reservations: %v", err)
+		} else if expired > 0 {
+			log.Printf("Expired %d pending orders and released their reservations", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
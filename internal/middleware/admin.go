@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly restricts a route to the users listed in ADMIN_USER_IDS (comma separated).
+// It must run after AuthToken so the user_id is available in the context.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !isAdmin(userID.(int)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func isAdmin(userID int) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		adminID, err := strconv.Atoi(strings.TrimSpace(id))
+		if err == nil && adminID == userID {
+			return true
+		}
+	}
+	return false
+}
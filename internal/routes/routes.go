@@ -12,21 +12,41 @@ func SetupRoutes(r *gin.Engine, db *pgxpool.Pool) {
 	v1 := r.Group("/v1")
 	v1.Use(middleware.AuthToken())
 
+	setupAdminRoutes(v1, db)
 	setupCartRoutes(v1, db)
 	setupCategoriesRoutes(v1, db)
 	setupFavoriteRecipeRoutes(v1, db)
 	setupIngredientRoutes(v1, db)
+	setupMealPlanRoutes(v1, db)
+	setupNotificationRoutes(v1, db)
+	setupOrderRoutes(v1, db)
+	setupPantryRoutes(v1, db)
 	setupProductRatingRoutes(v1, db)
 	setupProductRoutes(v1, db)
+	setupPromotionRoutes(v1, db)
 	setupRecipeRoutes(v1, db)
-	setupRecipeIngredientRoutes(v1, db)
 	setupRecipeRatingRoutes(v1, db)
-	setupRecipeToolRoutes(v1, db)
-	setupStepsRoutes(v1, db)
+	setupSellerRoutes(v1, db)
+	setupShoppingListRoutes(v1, db)
+	setupSubstitutionRoutes(v1, db)
 	setupToolRoutes(v1, db)
 	setupSearchRoutes(v1, db)
 }
 
+func setupAdminRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	admin := rg.Group("/admin")
+	admin.Use(middleware.AdminOnly())
+	{
+		admin.GET("/catalog/export", handlers.ExportCatalogNDJSON(db))
+		admin.POST("/catalog/import", handlers.ImportCatalogNDJSON(db))
+		admin.POST("/promotions", handlers.CreatePlatformPromotion(db))
+		admin.GET("/promotions", handlers.ListPlatformPromotions(db))
+		admin.GET("/promotions/:id", handlers.GetPlatformPromotion(db))
+		admin.PUT("/promotions/:id", handlers.UpdatePlatformPromotion(db))
+		admin.DELETE("/promotions/:id", handlers.DeletePlatformPromotion(db))
+	}
+}
+
 func setupCartRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 	carts := rg.Group("/carts")
 	{
@@ -35,6 +55,10 @@ func setupCartRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 		carts.PUT("/update/:cart_id/:quantity", handlers.UpdateQuantityCart(db))
 		carts.DELETE("/delete/:cart_id", handlers.DeleteCartItem(db))
 		carts.DELETE("/clear", handlers.DeleteCarts(db))
+		carts.POST("/from-recipe/:recipe_id", handlers.AddRecipeToCart(db))
+		carts.POST("/coupon", handlers.ApplyCartCoupon(db))
+		carts.DELETE("/coupon", handlers.RemoveCartCoupon(db))
+		carts.POST("/checkout", handlers.BeginCheckout(db))
 	}
 }
 
@@ -52,14 +76,41 @@ func setupRecipeRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 	recipes := rg.Group("/recipes")
 	{
 		recipes.POST("", handlers.CreateRecipe(db))
+		recipes.POST("/import", handlers.ImportRecipe(db))
 		recipes.GET("/list", handlers.GetListRecipe(db))
 		recipes.GET("/newest", handlers.GetNewestRecipes(db))
 		recipes.GET("/my", handlers.GetMyRecipe(db))
 		recipes.GET("/:id", handlers.GetRecipeByID(db))
 		recipes.PUT("/:id", handlers.UpdateRecipe(db))
+		recipes.PATCH("/:id", handlers.PatchRecipe(db))
 		recipes.DELETE("/:id", handlers.DeleteRecipe(db))
 		recipes.PUT("/change-owner", handlers.ChangeOwnerRecipe(db))
 		recipes.PUT("/change-status", handlers.ChangeStatusRecipe(db))
+
+		recipes.GET("/:id/ingredients", handlers.ListRecipeIngredients(db))
+		recipes.POST("/:id/ingredients", handlers.AddRecipeIngredient(db))
+		recipes.PUT("/:id/ingredients/:item_id", handlers.UpdateRecipeIngredient(db))
+		recipes.DELETE("/:id/ingredients/:item_id", handlers.RemoveRecipeIngredient(db))
+
+		recipes.GET("/:id/tools", handlers.ListRecipeTools(db))
+		recipes.POST("/:id/tools", handlers.AddRecipeTool(db))
+		recipes.PUT("/:id/tools/:item_id", handlers.UpdateRecipeTool(db))
+		recipes.DELETE("/:id/tools/:item_id", handlers.RemoveRecipeTool(db))
+
+		recipes.GET("/:id/steps", handlers.ListRecipeSteps(db))
+		recipes.POST("/:id/steps", handlers.AddRecipeStep(db))
+		recipes.PUT("/:id/steps/reorder", handlers.ReorderRecipeSteps(db))
+		recipes.PUT("/:id/steps/:item_id", handlers.UpdateRecipeStep(db))
+		recipes.DELETE("/:id/steps/:item_id", handlers.RemoveRecipeStep(db))
+
+		recipes.GET("/:id/export", handlers.ExportRecipe(db))
+		recipes.POST("/:id/fork", handlers.ForkRecipe(db))
+		recipes.POST("/:id/cooked", handlers.MarkRecipeCooked(db))
+
+		recipes.GET("/:id/revisions", handlers.ListRecipeRevisions(db))
+		recipes.GET("/:id/revisions/diff", handlers.DiffRecipeRevisions(db))
+		recipes.GET("/:id/revisions/:revision", handlers.GetRecipeRevision(db))
+		recipes.POST("/:id/revisions/:revision/restore", handlers.RestoreRecipeRevision(db))
 	}
 }
 
@@ -75,9 +126,31 @@ func setupIngredientRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 	{
 		ingredients.POST("", handlers.CreateIngredient(db))
 		ingredients.POST("/list", handlers.CreateListIngredient(db))
+		ingredients.POST("/nutrition/import", handlers.ImportIngredientNutritionCSV(db))
+		ingredients.POST("/parse", handlers.ParseIngredientLines(db))
 		ingredients.PUT("/:id", handlers.UpdateIngredient(db))
 		// ingredients.DELETE("/:id", handlers.DeleteIngredient(db))
 		ingredients.GET("/:id", handlers.GINGetIngredientByID(db))
+		ingredients.GET("/:id/nutrition", handlers.GetIngredientNutrition(db))
+		ingredients.PUT("/:id/nutrition", handlers.UpsertIngredientNutrition(db))
+		ingredients.GET("/:id/substitutes", handlers.GetIngredientSubstitutes(db))
+	}
+}
+
+func setupShoppingListRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	shoppingLists := rg.Group("/shopping-lists")
+	{
+		shoppingLists.POST("/from-recipes", handlers.CreateShoppingListFromRecipes(db))
+	}
+}
+
+func setupSubstitutionRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	substitutions := rg.Group("/substitutions")
+	substitutions.Use(middleware.AdminOnly())
+	{
+		substitutions.POST("", handlers.CreateSubstitution(db))
+		substitutions.PUT("/:id", handlers.UpdateSubstitution(db))
+		substitutions.DELETE("/:id", handlers.DeleteSubstitution(db))
 	}
 }
 
@@ -107,37 +180,70 @@ func setupProductRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 		products.GET("/ingredient/:id", handlers.GetProductByIngredientID(db))
 		products.GET("/seller", handlers.GetProductBySellerID(db))
 		products.GET("/newest", handlers.GetNewestProduct(db))
+		products.PUT("/:id/status", handlers.SetProductStatus(db))
+		products.PUT("/:id/options", handlers.SetProductOptions(db))
+		products.GET("/:id/variants", handlers.GetProductVariants(db))
+		products.POST("/:id/variants", handlers.CreateProductVariant(db))
+		products.PUT("/:id/variants/:variant_id", handlers.UpdateProductVariant(db))
+		products.DELETE("/:id/variants/:variant_id", handlers.DeleteProductVariant(db))
 	}
 }
 
-func setupRecipeIngredientRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
-	recipeIngredients := rg.Group("/recipe-ingredients")
+func setupPromotionRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	promotions := rg.Group("/promotions")
 	{
-		recipeIngredients.PUT("/:id", handlers.UpdateRecipeIngredient(db))
+		promotions.POST("", handlers.CreatePromotion(db))
+		promotions.GET("", handlers.ListPromotions(db))
+		promotions.GET("/:id", handlers.GetPromotion(db))
+		promotions.PUT("/:id", handlers.UpdatePromotion(db))
+		promotions.DELETE("/:id", handlers.DeletePromotion(db))
 	}
 }
 
-func setupRecipeToolRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
-	recipeTools := rg.Group("/recipe-tools")
+func setupRecipeRatingRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	recipeRatings := rg.Group("/recipe-ratings")
 	{
-		recipeTools.PUT("/:id", handlers.UpdateRecipeTool(db))
+		recipeRatings.POST("", handlers.CreateRecipeRating(db))
+		recipeRatings.PUT("/:id", handlers.UpdateRecipeRating(db))
+		recipeRatings.DELETE("/:id", handlers.DeleteRecipeRating(db))
+		recipeRatings.GET("/recipe/:id", handlers.GetRecipeRatingByRecipeID(db))
 	}
 }
 
-func setupStepsRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
-	recipeSteps := rg.Group("/recipe-steps")
+func setupMealPlanRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	mealPlans := rg.Group("/meal-plans")
 	{
-		recipeSteps.PUT("/:id", handlers.UpdateRecipeStep(db))
+		mealPlans.POST("", handlers.CreateMealPlan(db))
+		mealPlans.GET("", handlers.ListMealPlans(db))
+		mealPlans.GET("/:id", handlers.GetMealPlan(db))
+		mealPlans.PUT("/:id", handlers.UpdateMealPlan(db))
+		mealPlans.DELETE("/:id", handlers.DeleteMealPlan(db))
+		mealPlans.GET("/:id/summary", handlers.GetMealPlanSummary(db))
+		mealPlans.POST("/:id/copy", handlers.CopyMealPlan(db))
+		mealPlans.POST("/:id/entries", handlers.AddMealPlanEntry(db))
+		mealPlans.PUT("/:id/entries/:entry_id", handlers.UpdateMealPlanEntry(db))
+		mealPlans.DELETE("/:id/entries/:entry_id", handlers.DeleteMealPlanEntry(db))
 	}
 }
 
-func setupRecipeRatingRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
-	recipeRatings := rg.Group("/recipe-ratings")
+func setupOrderRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	orders := rg.Group("/orders")
 	{
-		recipeRatings.POST("", handlers.CreateRecipeRating(db))
-		recipeRatings.PUT("/:id", handlers.UpdateRecipeRating(db))
-		recipeRatings.DELETE("/:id", handlers.DeleteRecipeRating(db))
-		recipeRatings.GET("/recipe/:id", handlers.GetRecipeRatingByRecipeID(db))
+		orders.GET("", handlers.ListOrders(db))
+		orders.GET("/:id", handlers.GetOrder(db))
+		orders.POST("/:id/confirm", handlers.ConfirmOrder(db))
+		orders.POST("/:id/cancel", handlers.CancelOrder(db))
+	}
+}
+
+func setupPantryRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	pantry := rg.Group("/pantry")
+	{
+		pantry.GET("", handlers.ListPantryItems(db))
+		pantry.POST("", handlers.CreatePantryItem(db))
+		pantry.GET("/expiring", handlers.ListExpiringPantryItems(db))
+		pantry.PUT("/:id", handlers.UpdatePantryItem(db))
+		pantry.DELETE("/:id", handlers.DeletePantryItem(db))
 	}
 }
 
@@ -145,13 +251,30 @@ func setupProductRatingRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 	productRatings := rg.Group("/product-ratings")
 	{
 		productRatings.POST("", handlers.CreateProductRating(db))
-		productRatings.GET("/reply", handlers.ReplyRating(db))
+		productRatings.POST("/:id/reply", handlers.ReplyRating(db))
 		productRatings.DELETE("/:id", handlers.DeleteProductRating(db))
 		productRatings.PUT("/:id", handlers.UpdateProductRating(db))
 		productRatings.GET("/product/:id", handlers.GetProductRatingByProductID(db))
 	}
 }
 
+func setupNotificationRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	notifications := rg.Group("/notifications")
+	{
+		notifications.GET("", handlers.ListNotifications(db))
+		notifications.POST("/read-all", handlers.MarkAllNotificationsRead(db))
+		notifications.POST("/:id/read", handlers.MarkNotificationRead(db))
+	}
+}
+
+func setupSellerRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
+	sellers := rg.Group("/sellers")
+	{
+		sellers.GET("/dashboard", handlers.GetSellerDashboard(db))
+		sellers.GET("/:id/storefront", handlers.GetSellerStorefront(db))
+	}
+}
+
 func setupSearchRoutes(rg *gin.RouterGroup, db *pgxpool.Pool) {
 	search := rg.Group("/search")
 	{
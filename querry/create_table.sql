@@ -15,7 +15,38 @@ CREATE TABLE ingredients (
     sub_categories TEXT[],
     description TEXT NOT NULL,
     image_urls TEXT[],
-    unit VARCHAR(255) NOT NULL
+    unit VARCHAR(255) NOT NULL,
+    is_vegetarian BOOLEAN NOT NULL DEFAULT FALSE,
+    is_vegan BOOLEAN NOT NULL DEFAULT FALSE,
+    allergens TEXT[] NOT NULL DEFAULT '{}'
+);
+
+-- Create ingredient nutrition table (values per 100 g or per ingredient unit; sodium in mg, the rest in g)
+CREATE TABLE ingredient_nutrition (
+    ingredient_id INTEGER PRIMARY KEY REFERENCES ingredients(id),
+    basis VARCHAR(20) NOT NULL DEFAULT 'per_100g',
+    grams_per_unit DECIMAL(10, 3),
+    kcal DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    protein DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    fat DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    carbs DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    fiber DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    sugar DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    sodium DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    CONSTRAINT basis_check CHECK (basis IN ('per_100g', 'per_unit'))
+);
+
+-- Create ingredient substitutions table (ratio = substitute units per unit of the original ingredient)
+CREATE TABLE ingredient_substitutions (
+    id SERIAL PRIMARY KEY,
+    ingredient_id INTEGER NOT NULL REFERENCES ingredients(id),
+    substitute_id INTEGER NOT NULL REFERENCES ingredients(id),
+    ratio DECIMAL(10, 3) NOT NULL DEFAULT 1,
+    notes TEXT,
+    diet_reasons TEXT[] NOT NULL DEFAULT '{}',
+    CONSTRAINT substitution_ratio_check CHECK (ratio > 0),
+    CONSTRAINT substitution_distinct_check CHECK (ingredient_id <> substitute_id),
+    UNIQUE (ingredient_id, substitute_id)
 );
 
 -- Create tools table
@@ -39,9 +70,57 @@ CREATE TABLE products (
     title VARCHAR(255) NOT NULL,
     description TEXT,
     price DECIMAL(10, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    stock INTEGER NOT NULL,
+    image_urls TEXT[],
+    pack_quantity DECIMAL(10, 3),
+    pack_unit VARCHAR(50),
+    -- draft, published or archived; publish_at and unpublish_at schedule the next change, deleted_at soft-deletes
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    publish_at TIMESTAMP WITH TIME ZONE,
+    unpublish_at TIMESTAMP WITH TIME ZONE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    -- Only published products that are not deleted can be bought
+    is_active BOOLEAN GENERATED ALWAYS AS (status = 'published' AND deleted_at IS NULL) STORED,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pack_quantity_check CHECK (pack_quantity IS NULL OR pack_quantity > 0),
+    CONSTRAINT stock_check CHECK (stock >= 0),
+    CONSTRAINT product_status_check CHECK (status IN ('draft', 'published', 'archived')),
+    CONSTRAINT product_schedule_check CHECK (publish_at IS NULL OR unpublish_at IS NULL OR publish_at < unpublish_at)
+);
+CREATE INDEX products_publish_at_idx ON products (publish_at) WHERE publish_at IS NOT NULL AND deleted_at IS NULL;
+CREATE INDEX products_unpublish_at_idx ON products (unpublish_at) WHERE unpublish_at IS NOT NULL AND deleted_at IS NULL;
+
+-- The dimensions a product's variants differ in, e.g. size with the values 250 g, 500 g and 1 kg
+CREATE TABLE product_options (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    option_values TEXT[] NOT NULL,
+    position INTEGER NOT NULL,
+    UNIQUE (product_id, name)
+);
+
+-- A variant is one purchasable SKU of a product with one value per option. A product with variants is sold
+-- only through them, so their price and stock replace the product's own.
+CREATE TABLE product_variants (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR(100),
+    options JSONB NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
     stock INTEGER NOT NULL,
     image_urls TEXT[],
-    is_active BOOLEAN NOT NULL
+    pack_quantity DECIMAL(10, 3),
+    pack_unit VARCHAR(50),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (product_id, options),
+    CONSTRAINT variant_price_check CHECK (price >= 0),
+    CONSTRAINT variant_stock_check CHECK (stock >= 0),
+    CONSTRAINT variant_pack_quantity_check CHECK (pack_quantity IS NULL OR pack_quantity > 0)
 );
 
 CREATE TABLE recipes (
@@ -57,6 +136,10 @@ CREATE TABLE recipes (
     sub_categories TEXT[],
     image_urls TEXT[],
     is_public BOOLEAN NOT NULL,
+    diet_labels TEXT[] NOT NULL DEFAULT '{}',
+    allergens TEXT[] NOT NULL DEFAULT '{}',
+    version INTEGER NOT NULL DEFAULT 1,
+    forked_from_id INTEGER,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
@@ -65,7 +148,8 @@ CREATE TABLE recipe_ingredient (
     id SERIAL PRIMARY KEY,
     recipe_id INTEGER NOT NULL,
     ingredient_id INTEGER NOT NULL,
-    quantity INTEGER NOT NULL
+    quantity DECIMAL(10, 3) NOT NULL,
+    non_scalable BOOLEAN NOT NULL DEFAULT FALSE
 );
 
 CREATE TABLE recipe_tool (
@@ -80,7 +164,36 @@ CREATE TABLE steps (
     recipe_id INTEGER NOT NULL,
     step_number INTEGER NOT NULL,
     title VARCHAR(255) NOT NULL,
-    description TEXT
+    description TEXT,
+    duration_seconds INTEGER,
+    timer_label VARCHAR(255),
+    temperature DECIMAL(5, 1),
+    temperature_unit VARCHAR(1),
+    image_urls TEXT[] NOT NULL DEFAULT '{}',
+    video_url TEXT
+);
+
+CREATE TABLE step_ingredients (
+    step_id INTEGER NOT NULL REFERENCES steps(id) ON DELETE CASCADE,
+    recipe_ingredient_id INTEGER NOT NULL REFERENCES recipe_ingredient(id) ON DELETE CASCADE,
+    PRIMARY KEY (step_id, recipe_ingredient_id)
+);
+
+CREATE TABLE step_tools (
+    step_id INTEGER NOT NULL REFERENCES steps(id) ON DELETE CASCADE,
+    recipe_tool_id INTEGER NOT NULL REFERENCES recipe_tool(id) ON DELETE CASCADE,
+    PRIMARY KEY (step_id, recipe_tool_id)
+);
+
+CREATE TABLE recipe_revisions (
+    id SERIAL PRIMARY KEY,
+    recipe_id INTEGER NOT NULL,
+    revision_number INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    snapshot JSONB NOT NULL,
+    restored_from INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (recipe_id, revision_number)
 );
 
 CREATE TABLE recipe_rating (
@@ -92,9 +205,171 @@ CREATE TABLE recipe_rating (
     CONSTRAINT rating_check CHECK (rating >= 0 AND rating <= 5)
 );
 
+CREATE TABLE product_rating (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    rating DECIMAL(3, 2),
+    comment TEXT,
+    reply_id INTEGER REFERENCES product_rating(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT product_rating_check CHECK (rating >= 0 AND rating <= 5),
+    CONSTRAINT product_rating_reply_check CHECK ((reply_id IS NULL) = (rating IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX product_rating_user_idx ON product_rating (user_id, product_id) WHERE reply_id IS NULL;
+
 CREATE TABLE carts (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id INTEGER REFERENCES product_variants(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL,
+    price_at_add DECIMAL(10, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT cart_quantity_check CHECK (quantity > 0)
+);
+-- One cart line per product, or per variant for products with variants
+CREATE UNIQUE INDEX carts_product_line_idx ON carts (user_id, product_id) WHERE variant_id IS NULL;
+CREATE UNIQUE INDEX carts_variant_line_idx ON carts (user_id, variant_id) WHERE variant_id IS NOT NULL;
+
+-- Promotions: coupons are redeemed with a code, promotions without one are automatic sale prices.
+-- seller_id is NULL for platform promotions; seller promotions only ever apply to that seller's products.
+CREATE TABLE promotions (
+    id SERIAL PRIMARY KEY,
+    seller_id INTEGER,
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50) UNIQUE,
+    discount_type VARCHAR(20) NOT NULL,
+    percentage DECIMAL(5, 2),
+    amount DECIMAL(10, 2),
+    currency VARCHAR(3) NOT NULL,
+    min_cart_value DECIMAL(10, 2),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    usage_limit INTEGER,
+    per_user_limit INTEGER,
+    seller_ids INTEGER[] NOT NULL DEFAULT '{}',
+    product_ids INTEGER[] NOT NULL DEFAULT '{}',
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT promotion_discount_check CHECK (
+        (discount_type = 'percentage' AND percentage > 0 AND percentage <= 100 AND amount IS NULL) OR
+        (discount_type = 'fixed' AND amount > 0 AND percentage IS NULL)
+    ),
+    CONSTRAINT promotion_window_check CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+-- The coupon a user applied to their cart, checked again whenever the cart is priced
+CREATE TABLE cart_coupons (
+    user_id INTEGER PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Orders start pending when checkout begins, holding stock reservations until they are placed, cancelled or expire
+-- Totals are wider than prices, since a cart line can hold up to 99 units at the highest price
+CREATE TABLE orders (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    currency VARCHAR(3) NOT NULL,
+    subtotal DECIMAL(14, 2) NOT NULL,
+    discount DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(14, 2) NOT NULL,
+    promotion_id INTEGER REFERENCES promotions(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    placed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT order_status_check CHECK (status IN ('pending', 'placed', 'cancelled', 'expired'))
+);
+
+-- Order items keep the title and price paid, so they outlive changes to the product
+CREATE TABLE order_items (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
     product_id INTEGER NOT NULL,
-    quantity INTEGER NOT NULL
-);
\ No newline at end of file
+    variant_id INTEGER,
+    seller_id INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL,
+    unit_price DECIMAL(10, 2) NOT NULL,
+    line_total DECIMAL(14, 2) NOT NULL,
+    sale_promotion_id INTEGER REFERENCES promotions(id) ON DELETE SET NULL,
+    CONSTRAINT order_item_quantity_check CHECK (quantity > 0)
+);
+CREATE INDEX order_items_seller_idx ON order_items (seller_id, order_id);
+
+-- Stock held for a pending order, on the variant when variant_id is set; available stock is the stock minus the unexpired reservations
+CREATE TABLE stock_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id INTEGER REFERENCES product_variants(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT reservation_quantity_check CHECK (quantity > 0)
+);
+CREATE INDEX stock_reservations_product_idx ON stock_reservations (product_id, expires_at);
+CREATE INDEX stock_reservations_variant_idx ON stock_reservations (variant_id, expires_at) WHERE variant_id IS NOT NULL;
+
+CREATE TABLE promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+    discount DECIMAL(14, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE meal_plans (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    week_start DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, week_start)
+);
+
+CREATE TABLE meal_plan_entries (
+    id SERIAL PRIMARY KEY,
+    meal_plan_id INTEGER NOT NULL REFERENCES meal_plans(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    meal_slot VARCHAR(20) NOT NULL,
+    recipe_id INTEGER NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+    servings INTEGER NOT NULL,
+    note TEXT,
+    CONSTRAINT meal_slot_check CHECK (meal_slot IN ('breakfast', 'lunch', 'dinner', 'snack')),
+    CONSTRAINT meal_servings_check CHECK (servings > 0)
+);
+
+CREATE TABLE pantry_items (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    ingredient_id INTEGER NOT NULL REFERENCES ingredients(id),
+    quantity DECIMAL(10, 3) NOT NULL,
+    unit VARCHAR(50) NOT NULL,
+    expires_on DATE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pantry_quantity_check CHECK (quantity >= 0)
+);
+
+-- Messages for users, e.g. when a product in their cart or pending checkout stops selling
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    message TEXT NOT NULL,
+    product_id INTEGER REFERENCES products(id) ON DELETE SET NULL,
+    order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX notifications_user_idx ON notifications (user_id, created_at);